@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+	"gitlab.com/slon/shad-go/distbuild/pkg/dist"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+)
+
+var (
+	addr     = flag.String("addr", "127.0.0.1:8080", "listen address")
+	grpcAddr = flag.String("grpc-addr", "", "listen address for gRPC build and heartbeat services; disabled if empty")
+	rootDir  = flag.String("root", "distbuild-coordinator", "directory for coordinator caches")
+	journal  = flag.String("journal", "", "coordinator journal file; enables recovery of running builds after restart")
+
+	tokens  = flag.String("tokens", "", "file with client and worker tokens; enables authentication")
+	tlsCert = flag.String("tls-cert", "", "server certificate; enables TLS")
+	tlsKey  = flag.String("tls-key", "", "server certificate key")
+	tlsCA   = flag.String("tls-ca", "", "CA of client certificates; enables authentication with certificates")
+
+	quotaBuilds = flag.Int("quota-builds", 0, "max concurrent builds per user, 0 means unlimited")
+	quotaJobs   = flag.Int("quota-jobs", 0, "max jobs in concurrent builds per user, 0 means unlimited")
+)
+
+// newChecker возвращает nil, если аутентификация не включена.
+func newChecker() (auth.TokenChecker, error) {
+	switch {
+	case *tokens != "":
+		return auth.LoadTokens(*tokens)
+	case *tlsCA != "":
+		// Только клиентские сертификаты, токены не принимаются.
+		return auth.NewTokens(), nil
+	default:
+		return nil, nil
+	}
+}
+
+func main() {
+	flag.Parse()
+
+	log, err := zap.NewDevelopment()
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = log.Sync() }()
+
+	fileCache, err := filecache.New(*rootDir)
+	if err != nil {
+		log.Fatal("failed to open file cache", zap.Error(err))
+	}
+
+	coordinator := dist.NewCoordinator(log, fileCache)
+	defer coordinator.Stop()
+
+	if *journal != "" {
+		if err := coordinator.SetJournal(*journal); err != nil {
+			log.Fatal("failed to open journal", zap.Error(err))
+		}
+	}
+
+	checker, err := newChecker()
+	if err != nil {
+		log.Fatal("failed to load tokens", zap.Error(err))
+	}
+
+	var grpcOptions []grpc.ServerOption
+	if checker != nil {
+		quotas := auth.NewQuotas(auth.Quota{Builds: *quotaBuilds, Jobs: *quotaJobs}, nil)
+		coordinator.SetAuth(checker, quotas)
+
+		grpcOptions = append(grpcOptions,
+			grpc.UnaryInterceptor(auth.UnaryServerInterceptor(checker)),
+			grpc.StreamInterceptor(auth.StreamServerInterceptor(checker)))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: *addr, Handler: coordinator}
+	if *tlsCert != "" {
+		if server.TLSConfig, err = auth.ServerTLS(*tlsCert, *tlsKey, *tlsCA); err != nil {
+			log.Fatal("failed to load TLS config", zap.Error(err))
+		}
+		grpcOptions = append(grpcOptions, grpc.Creds(credentials.NewTLS(server.TLSConfig)))
+	}
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	if *grpcAddr != "" {
+		lis, err := net.Listen("tcp", *grpcAddr)
+		if err != nil {
+			log.Fatal("failed to listen", zap.Error(err))
+		}
+
+		grpcServer := grpc.NewServer(grpcOptions...)
+		coordinator.RegisterGRPC(grpcServer)
+		go func() {
+			<-ctx.Done()
+			grpcServer.GracefulStop()
+		}()
+
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Fatal("grpc server stopped", zap.Error(err))
+			}
+		}()
+
+		log.Info("grpc server started", zap.String("addr", *grpcAddr))
+	}
+
+	log.Info("coordinator started", zap.String("addr", *addr))
+	if server.TLSConfig != nil {
+		err = server.ListenAndServeTLS("", "")
+	} else {
+		err = server.ListenAndServe()
+	}
+	if !errors.Is(err, http.ErrServerClosed) {
+		log.Fatal("http server stopped", zap.Error(err))
+	}
+}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+	"gitlab.com/slon/shad-go/distbuild/pkg/sandbox"
+	"gitlab.com/slon/shad-go/distbuild/pkg/worker"
+)
+
+var (
+	addr        = flag.String("addr", "127.0.0.1:8081", "listen address")
+	id          = flag.String("id", "", "worker endpoint reachable from other workers; defaults to http(s)://<addr>")
+	coordinator = flag.String("coordinator", "http://127.0.0.1:8080", "coordinator endpoint")
+	rootDir     = flag.String("root", "distbuild-worker", "directory for worker caches")
+	cpu         = flag.Int("cpu", runtime.NumCPU(), "number of cores available to jobs")
+	memory      = flag.Int64("memory", 0, "memory available to jobs, in bytes")
+	tags        = flag.String("tags", "", "comma separated worker tags, like race,cgo")
+
+	artifactBudget = flag.Int64("artifact-cache-budget", 0, "size of the artifact cache in bytes, 0 means unlimited")
+	fileBudget     = flag.Int64("file-cache-budget", 0, "size of the file cache in bytes, 0 means unlimited")
+
+	sandboxEnabled    = flag.Bool("sandbox", false, "run job commands in sandbox with cleared environment")
+	sandboxUser       = flag.String("sandbox-user", "", "user that runs job commands, like nobody; requires root")
+	sandboxNamespaces = flag.Bool("sandbox-namespaces", false, "run job commands in private namespaces "+
+		"with read-only source and dependencies; requires root")
+	sandboxCPUTime   = flag.Duration("sandbox-cpu-time", 0, "cpu time limit of each job command process, 0 means unlimited")
+	sandboxMemory    = flag.Uint64("sandbox-memory", 0, "address space limit of each job command process in bytes, 0 means unlimited")
+	sandboxWallClock = flag.Duration("sandbox-wall-clock", 0, "wall-clock limit of each job command, 0 means unlimited")
+
+	tokenFile = flag.String("token-file", "", "file with the token this worker sends to the coordinator")
+	tlsCert   = flag.String("tls-cert", "", "worker certificate; enables TLS for both the server and the client side")
+	tlsKey    = flag.String("tls-key", "", "worker certificate key")
+	tlsCA     = flag.String("tls-ca", "", "CA of the coordinator, worker and client certificates; "+
+		"enables authentication of requests to this worker by client certificates")
+)
+
+func setupAuth(w *worker.Worker, server *http.Server) error {
+	var creds auth.Credentials
+	if *tokenFile != "" {
+		token, err := auth.LoadToken(*tokenFile)
+		if err != nil {
+			return err
+		}
+		creds.Token = token
+	}
+
+	// Токены отправляются только координатору, поэтому воркер проверяет только клиентские сертификаты.
+	var checker auth.TokenChecker
+	if *tlsCA != "" {
+		checker = auth.NewTokens()
+	}
+
+	if *tlsCert != "" {
+		var err error
+		if server.TLSConfig, err = auth.ServerTLS(*tlsCert, *tlsKey, *tlsCA); err != nil {
+			return err
+		}
+		if creds.TLS, err = auth.ClientTLS(*tlsCert, *tlsKey, *tlsCA); err != nil {
+			return err
+		}
+	} else if *tlsCA != "" {
+		var err error
+		if creds.TLS, err = auth.ClientTLS("", "", *tlsCA); err != nil {
+			return err
+		}
+	}
+
+	if creds != (auth.Credentials{}) || checker != nil {
+		w.SetAuth(creds, checker)
+	}
+	return nil
+}
+
+func main() {
+	sandbox.Init()
+	flag.Parse()
+
+	log, err := zap.NewDevelopment()
+	if err != nil {
+		panic(err)
+	}
+	defer func() { _ = log.Sync() }()
+
+	workerID := api.WorkerID(*id)
+	if workerID == "" && *tlsCert != "" {
+		workerID = api.WorkerID("https://" + *addr)
+	} else if workerID == "" {
+		workerID = api.WorkerID("http://" + *addr)
+	}
+
+	fileCache, err := filecache.New(filepath.Join(*rootDir, "filecache"))
+	if err != nil {
+		log.Fatal("failed to open file cache", zap.Error(err))
+	}
+
+	artifacts, err := artifact.NewCache(filepath.Join(*rootDir, "artifacts"))
+	if err != nil {
+		log.Fatal("failed to open artifact cache", zap.Error(err))
+	}
+
+	w := worker.New(workerID, *coordinator, log, fileCache, artifacts)
+
+	resources := build.Resources{CPU: *cpu, Memory: *memory}
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			resources.Tags = append(resources.Tags, tag)
+		}
+	}
+	w.SetResources(resources)
+	w.SetCacheBudget(*artifactBudget, *fileBudget)
+
+	if *sandboxEnabled {
+		w.SetSandbox(sandbox.Config{
+			User:       *sandboxUser,
+			Namespaces: *sandboxNamespaces,
+			CPUTime:    *sandboxCPUTime,
+			Memory:     *sandboxMemory,
+			WallClock:  *sandboxWallClock,
+		})
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	server := &http.Server{Addr: *addr, Handler: w}
+	if err := setupAuth(w, server); err != nil {
+		log.Fatal("failed to set up authentication", zap.Error(err))
+	}
+
+	go func() {
+		<-ctx.Done()
+		_ = server.Shutdown(context.Background())
+	}()
+
+	go func() {
+		var err error
+		if server.TLSConfig != nil {
+			err = server.ListenAndServeTLS("", "")
+		} else {
+			err = server.ListenAndServe()
+		}
+		if !errors.Is(err, http.ErrServerClosed) {
+			log.Fatal("http server stopped", zap.Error(err))
+		}
+	}()
+
+	log.Info("worker started", zap.String("id", workerID.String()), zap.String("coordinator", *coordinator))
+	if err := w.Run(ctx); !errors.Is(err, context.Canceled) {
+		log.Fatal("worker stopped", zap.Error(err))
+	}
+}
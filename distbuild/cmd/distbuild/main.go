@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/client"
+	"gitlab.com/slon/shad-go/distbuild/pkg/gobuild"
+)
+
+var (
+	coordinator = flag.String("coordinator", "http://127.0.0.1:8080", "coordinator endpoint")
+	dir         = flag.String("C", ".", "directory inside the module to build")
+	vet         = flag.Bool("vet", false, "run go vet on every package")
+	test        = flag.Bool("test", false, "run go test on every package")
+	verbose     = flag.Bool("v", false, "log client events to stderr")
+	output      = flag.String("o", "", "download binaries into this directory")
+	remoteOnly  = flag.Bool("remote-only", false, "never download intermediate artifacts")
+	timeout     = flag.Duration("timeout", 0, "cancel the build after this duration, 0 means no limit")
+	user        = flag.String("user", os.Getenv("USER"), "user for fair scheduling; ignored when the coordinator checks auth")
+	priority    = flag.Int("priority", 0, "build priority for fair scheduling, capped by the coordinator")
+	tokenFile   = flag.String("token-file", "", "file with the client token; $DISTBUILD_TOKEN is used if empty")
+	tlsCert     = flag.String("tls-cert", "", "client certificate")
+	tlsKey      = flag.String("tls-key", "", "client certificate key")
+	tlsCA       = flag.String("tls-ca", "", "CA of the coordinator and worker certificates")
+)
+
+func loadCredentials() (auth.Credentials, error) {
+	creds := auth.Credentials{Token: os.Getenv("DISTBUILD_TOKEN")}
+	if *tokenFile != "" {
+		token, err := auth.LoadToken(*tokenFile)
+		if err != nil {
+			return creds, err
+		}
+		creds.Token = token
+	}
+
+	if *tlsCert != "" || *tlsCA != "" {
+		var err error
+		if creds.TLS, err = auth.ClientTLS(*tlsCert, *tlsKey, *tlsCA); err != nil {
+			return creds, err
+		}
+	}
+	return creds, nil
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: distbuild [flags] [packages]\n")
+		fmt.Fprintf(os.Stderr, "       distbuild [flags] cancel build-id\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	var err error
+	if args := flag.Args(); len(args) != 0 && args[0] == "cancel" {
+		err = cancel(args[1:])
+	} else {
+		if len(args) == 0 {
+			args = []string{"./..."}
+		}
+		err = run(args)
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "distbuild:", err)
+		os.Exit(1)
+	}
+}
+
+func newLogger() (*zap.Logger, error) {
+	if *verbose {
+		return zap.NewDevelopment()
+	}
+	return zap.NewNop(), nil
+}
+
+// cancel отменяет сборку, запущенную другим вызовом distbuild.
+func cancel(args []string) error {
+	if len(args) != 1 {
+		return fmt.Errorf("cancel expects exactly one build id")
+	}
+
+	var buildID build.ID
+	if err := buildID.UnmarshalText([]byte(args[0])); err != nil {
+		return fmt.Errorf("invalid build id %q: %w", args[0], err)
+	}
+
+	log, err := newLogger()
+	if err != nil {
+		return err
+	}
+
+	creds, err := loadCredentials()
+	if err != nil {
+		return err
+	}
+
+	c := client.NewClient(log, *coordinator, *dir)
+	if creds != (auth.Credentials{}) {
+		c.SetCredentials(creds)
+	}
+	return c.Cancel(context.Background(), buildID)
+}
+
+func run(patterns []string) error {
+	log, err := newLogger()
+	if err != nil {
+		return err
+	}
+
+	root, err := gobuild.ModuleRoot(*dir)
+	if err != nil {
+		return err
+	}
+
+	pkgs, err := gobuild.List(*dir, patterns...)
+	if err != nil {
+		return err
+	}
+
+	toolchain, err := gobuild.CurrentToolchain()
+	if err != nil {
+		return err
+	}
+
+	graph, err := gobuild.NewGraph(root, pkgs, gobuild.Config{
+		Toolchain: *toolchain,
+		Environ: []string{
+			"PATH=" + os.Getenv("PATH"),
+			"HOME=" + os.Getenv("HOME"),
+		},
+		Vet:  *vet,
+		Test: *test,
+	})
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	creds, err := loadCredentials()
+	if err != nil {
+		return err
+	}
+
+	p := newProgress(graph)
+	c := client.NewClient(log, *coordinator, root)
+	if creds != (auth.Credentials{}) {
+		c.SetCredentials(creds)
+	}
+	c.SetOutputs(client.Outputs{Dir: *output, RemoteOnly: *remoteOnly})
+	c.SetTimeout(*timeout)
+	c.SetPriority(*user, *priority)
+	if err := c.Build(ctx, *graph, p); err != nil {
+		return err
+	}
+
+	if p.failed != 0 {
+		return fmt.Errorf("%d of %d jobs failed", p.failed, len(graph.Jobs))
+	}
+	return nil
+}
+
+// progress печатает вывод джобов и сообщения об их завершении.
+type progress struct {
+	names    map[build.ID]string
+	total    int
+	finished int
+	failed   int
+}
+
+func newProgress(graph *build.Graph) *progress {
+	p := &progress{names: map[build.ID]string{}, total: len(graph.Jobs)}
+	for _, job := range graph.Jobs {
+		p.names[job.ID] = job.Name
+	}
+	return p
+}
+
+func (p *progress) OnBuildStarted(buildID build.ID) error {
+	fmt.Fprintf(os.Stderr, "build %s started, cancel with: distbuild cancel %s\n", buildID, buildID)
+	return nil
+}
+
+func (p *progress) OnJobStdout(jobID build.ID, stdout []byte) error {
+	_, err := os.Stdout.Write(stdout)
+	return err
+}
+
+func (p *progress) OnJobStderr(jobID build.ID, stderr []byte) error {
+	_, err := os.Stderr.Write(stderr)
+	return err
+}
+
+func (p *progress) OnJobFinished(jobID build.ID) error {
+	p.finished++
+	fmt.Fprintf(os.Stderr, "[%d/%d] %s\n", p.finished, p.total, p.names[jobID])
+	return nil
+}
+
+func (p *progress) OnJobFailed(jobID build.ID, code int, error string) error {
+	p.finished++
+	p.failed++
+	fmt.Fprintf(os.Stderr, "[%d/%d] %s FAILED (exit code %d): %s\n", p.finished, p.total, p.names[jobID], code, error)
+	return nil
+}
@@ -2,12 +2,42 @@ package api
 
 import (
 	"context"
+	"time"
 
 	"gitlab.com/slon/shad-go/distbuild/pkg/build"
 )
 
 type BuildRequest struct {
 	Graph build.Graph
+
+	// BuildID задаётся, когда клиент переподключается к уже запущенной сборке,
+	// например после перезапуска координатора. В этом случае Graph не используется,
+	// а координатор присылает BuildStarted с тем же ID.
+	BuildID *build.ID
+
+	// Timeout ограничивает время работы сборки. Нулевое значение означает отсутствие ограничения.
+	//
+	// По истечении Timeout координатор отменяет сборку так же, как при получении сигнала Cancel.
+	Timeout time.Duration
+
+	// User и Priority используются планировщиком для честного разделения воркеров между сборками.
+	//
+	// Сборки одного пользователя делят между собой его долю. Доля пользователя пропорциональна Priority,
+	// нулевой Priority считается равным единице. Слишком большой Priority планировщик ограничивает
+	// сверху, см. scheduler.FairPolicy.
+	//
+	// Клиент задаёт их через Client.SetPriority. Если координатор проверяет аутентификацию,
+	// User заменяется на имя из auth.ContextIdentity.
+	User     string
+	Priority int
+
+	// Outputs перечисляет джобы, артефакты которых клиент скачает после завершения сборки.
+	// Координатор сообщает, где их взять, в BuildFinished.Artifacts.
+	Outputs []build.ID
+
+	// RemoteOnly запрещает выдавать клиенту артефакты промежуточных джобов. В Outputs можно указывать
+	// только джобы верхнего уровня (build.TopLevel), иначе координатор отклоняет сборку.
+	RemoteOnly bool
 }
 
 type BuildStarted struct {
@@ -16,6 +46,7 @@ type BuildStarted struct {
 }
 
 type StatusUpdate struct {
+	JobOutput     *JobOutput
 	JobFinished   *JobResult
 	BuildFailed   *BuildFailed
 	BuildFinished *BuildFinished
@@ -26,12 +57,23 @@ type BuildFailed struct {
 }
 
 type BuildFinished struct {
+	// Artifacts перечисляет воркеров, с которых можно скачать артефакты джобов из BuildRequest.Outputs.
+	Artifacts map[build.ID][]WorkerID
 }
 
 type UploadDone struct{}
 
+// Cancel просит координатора остановить сборку.
+//
+// Координатор убирает из планировщика джобы сборки, которые ещё не начали выполняться,
+// просит воркеров убить бегущие джобы и присылает клиенту BuildFailed с Reason.
+type Cancel struct {
+	Reason string
+}
+
 type SignalRequest struct {
 	UploadDone *UploadDone
+	Cancel     *Cancel
 }
 
 type SignalResponse struct {
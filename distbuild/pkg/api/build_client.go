@@ -4,6 +4,7 @@ package api
 
 import (
 	"context"
+	"net/http"
 
 	"go.uber.org/zap"
 
@@ -17,6 +18,12 @@ func NewBuildClient(l *zap.Logger, endpoint string) *BuildClient {
 	panic("implement me")
 }
 
+// SetHTTPClient задаёт http.Client для запросов к координатору, например auth.Credentials.HTTPClient(endpoint).
+// По умолчанию используется http.DefaultClient.
+func (c *BuildClient) SetHTTPClient(client *http.Client) {
+	panic("implement me")
+}
+
 func (c *BuildClient) StartBuild(ctx context.Context, request *BuildRequest) (*BuildStarted, StatusReader, error) {
 	panic("implement me")
 }
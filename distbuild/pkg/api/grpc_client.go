@@ -0,0 +1,148 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api/apipb"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// BuildServiceClient описывает клиентскую сторону Service.
+//
+// Реализуется *BuildClient и *GRPCBuildClient.
+type BuildServiceClient interface {
+	StartBuild(ctx context.Context, request *BuildRequest) (*BuildStarted, StatusReader, error)
+	SignalBuild(ctx context.Context, buildID build.ID, signal *SignalRequest) (*SignalResponse, error)
+}
+
+var (
+	_ BuildServiceClient = (*BuildClient)(nil)
+	_ BuildServiceClient = (*GRPCBuildClient)(nil)
+	_ HeartbeatService   = (*GRPCHeartbeatClient)(nil)
+)
+
+// fromGRPCError превращает gRPC статус обратно в ошибку с тем же текстом, что вернул сервис.
+func fromGRPCError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+
+	switch st.Code() {
+	case codes.Canceled:
+		return context.Canceled
+	case codes.DeadlineExceeded:
+		return context.DeadlineExceeded
+	default:
+		return errors.New(st.Message())
+	}
+}
+
+type GRPCBuildClient struct {
+	l      *zap.Logger
+	client apipb.BuildServiceClient
+}
+
+// NewGRPCBuildClient создаёт клиента поверх соединения conn. Закрывать conn должен вызывающий код.
+func NewGRPCBuildClient(l *zap.Logger, conn grpc.ClientConnInterface) *GRPCBuildClient {
+	return &GRPCBuildClient{l: l, client: apipb.NewBuildServiceClient(conn)}
+}
+
+type grpcStatusReader struct {
+	stream apipb.BuildService_StartBuildClient
+	cancel context.CancelFunc
+}
+
+func (r *grpcStatusReader) Close() error {
+	r.cancel()
+	return nil
+}
+
+func (r *grpcStatusReader) Next() (*StatusUpdate, error) {
+	msg, err := r.stream.Recv()
+	if errors.Is(err, io.EOF) {
+		return nil, io.EOF
+	} else if err != nil {
+		return nil, fromGRPCError(err)
+	}
+
+	if msg.Update == nil {
+		return nil, fmt.Errorf("unexpected message in build status stream")
+	}
+	return statusUpdateFromPB(msg.Update)
+}
+
+func (c *GRPCBuildClient) StartBuild(ctx context.Context, request *BuildRequest) (*BuildStarted, StatusReader, error) {
+	ctx, cancel := context.WithCancel(ctx)
+
+	c.l.Debug("starting build")
+	stream, err := c.client.StartBuild(ctx, buildRequestToPB(request))
+	if err != nil {
+		cancel()
+		return nil, nil, fromGRPCError(err)
+	}
+
+	msg, err := stream.Recv()
+	if err != nil {
+		cancel()
+		if errors.Is(err, io.EOF) {
+			return nil, nil, fmt.Errorf("build status stream closed before build started")
+		}
+
+		c.l.Error("build failed to start", zap.Error(err))
+		return nil, nil, fromGRPCError(err)
+	}
+
+	if msg.Started == nil {
+		cancel()
+		return nil, nil, fmt.Errorf("first message in build status stream is not BuildStarted")
+	}
+
+	started, err := buildStartedFromPB(msg.Started)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+
+	c.l.Debug("build started", zap.Stringer("build_id", started.ID))
+	return started, &grpcStatusReader{stream: stream, cancel: cancel}, nil
+}
+
+func (c *GRPCBuildClient) SignalBuild(ctx context.Context, buildID build.ID, signal *SignalRequest) (*SignalResponse, error) {
+	c.l.Debug("sending signal", zap.Stringer("build_id", buildID))
+	if _, err := c.client.SignalBuild(ctx, signalToPB(buildID, signal)); err != nil {
+		c.l.Error("signal failed", zap.Stringer("build_id", buildID), zap.Error(err))
+		return nil, fromGRPCError(err)
+	}
+
+	return &SignalResponse{}, nil
+}
+
+type GRPCHeartbeatClient struct {
+	l      *zap.Logger
+	client apipb.HeartbeatServiceClient
+}
+
+// NewGRPCHeartbeatClient создаёт клиента поверх соединения conn. Закрывать conn должен вызывающий код.
+func NewGRPCHeartbeatClient(l *zap.Logger, conn grpc.ClientConnInterface) *GRPCHeartbeatClient {
+	return &GRPCHeartbeatClient{l: l, client: apipb.NewHeartbeatServiceClient(conn)}
+}
+
+func (c *GRPCHeartbeatClient) Heartbeat(ctx context.Context, req *HeartbeatRequest) (*HeartbeatResponse, error) {
+	c.l.Debug("sending heartbeat", zap.Stringer("worker_id", req.WorkerID))
+	rsp, err := c.client.Heartbeat(ctx, heartbeatRequestToPB(req))
+	if err != nil {
+		c.l.Error("heartbeat failed", zap.Error(err))
+		return nil, fromGRPCError(err)
+	}
+
+	return heartbeatResponseFromPB(rsp)
+}
@@ -0,0 +1,498 @@
+package api
+
+import (
+	"fmt"
+	"time"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api/apipb"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+func idToPB(id build.ID) []byte {
+	return append([]byte(nil), id[:]...)
+}
+
+func idFromPB(b []byte) (build.ID, error) {
+	var id build.ID
+	if len(b) != len(id) {
+		return id, fmt.Errorf("invalid id size: %d", len(b))
+	}
+	copy(id[:], b)
+	return id, nil
+}
+
+func idsToPB(ids []build.ID) [][]byte {
+	var out [][]byte
+	for _, id := range ids {
+		out = append(out, idToPB(id))
+	}
+	return out
+}
+
+func idsFromPB(b [][]byte) ([]build.ID, error) {
+	var out []build.ID
+	for _, raw := range b {
+		id, err := idFromPB(raw)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+func sourceFilesToPB(files map[build.ID]string) []*apipb.SourceFile {
+	var out []*apipb.SourceFile
+	for id, path := range files {
+		out = append(out, &apipb.SourceFile{Id: idToPB(id), Path: path})
+	}
+	return out
+}
+
+func sourceFilesFromPB(files []*apipb.SourceFile) (map[build.ID]string, error) {
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	out := map[build.ID]string{}
+	for _, f := range files {
+		id, err := idFromPB(f.Id)
+		if err != nil {
+			return nil, err
+		}
+		out[id] = f.Path
+	}
+	return out, nil
+}
+
+func resourcesToPB(r build.Resources) *apipb.Resources {
+	if r.CPU == 0 && r.Memory == 0 && len(r.Tags) == 0 {
+		return nil
+	}
+	return &apipb.Resources{Cpu: int64(r.CPU), Memory: r.Memory, Tags: r.Tags}
+}
+
+func resourcesFromPB(pb *apipb.Resources) build.Resources {
+	return build.Resources{CPU: int(pb.GetCpu()), Memory: pb.GetMemory(), Tags: pb.GetTags()}
+}
+
+func jobToPB(job *build.Job) *apipb.Job {
+	pb := &apipb.Job{
+		Id:           idToPB(job.ID),
+		Name:         job.Name,
+		Inputs:       job.Inputs,
+		Deps:         idsToPB(job.Deps),
+		Outputs:      job.Outputs,
+		Requirements: resourcesToPB(job.Requirements),
+	}
+
+	for _, cmd := range job.Cmds {
+		pb.Cmds = append(pb.Cmds, &apipb.Cmd{
+			Exec:             cmd.Exec,
+			Environ:          cmd.Environ,
+			WorkingDirectory: cmd.WorkingDirectory,
+			CatTemplate:      cmd.CatTemplate,
+			CatOutput:        cmd.CatOutput,
+		})
+	}
+	return pb
+}
+
+func jobFromPB(pb *apipb.Job) (build.Job, error) {
+	var err error
+	job := build.Job{
+		Name:         pb.GetName(),
+		Inputs:       pb.GetInputs(),
+		Outputs:      pb.GetOutputs(),
+		Requirements: resourcesFromPB(pb.GetRequirements()),
+	}
+
+	if job.ID, err = idFromPB(pb.GetId()); err != nil {
+		return job, err
+	}
+	if job.Deps, err = idsFromPB(pb.GetDeps()); err != nil {
+		return job, err
+	}
+
+	for _, cmd := range pb.GetCmds() {
+		job.Cmds = append(job.Cmds, build.Cmd{
+			Exec:             cmd.Exec,
+			Environ:          cmd.Environ,
+			WorkingDirectory: cmd.WorkingDirectory,
+			CatTemplate:      cmd.CatTemplate,
+			CatOutput:        cmd.CatOutput,
+		})
+	}
+	return job, nil
+}
+
+func buildRequestToPB(req *BuildRequest) *apipb.BuildRequest {
+	pb := &apipb.BuildRequest{
+		Graph:      &apipb.Graph{SourceFiles: sourceFilesToPB(req.Graph.SourceFiles)},
+		Timeout:    int64(req.Timeout),
+		User:       req.User,
+		Priority:   int64(req.Priority),
+		Outputs:    idsToPB(req.Outputs),
+		RemoteOnly: req.RemoteOnly,
+	}
+
+	if req.BuildID != nil {
+		pb.BuildId = idToPB(*req.BuildID)
+	}
+
+	for i := range req.Graph.Jobs {
+		pb.Graph.Jobs = append(pb.Graph.Jobs, jobToPB(&req.Graph.Jobs[i]))
+	}
+	return pb
+}
+
+func buildRequestFromPB(pb *apipb.BuildRequest) (*BuildRequest, error) {
+	var err error
+	req := &BuildRequest{
+		Timeout:    time.Duration(pb.Timeout),
+		User:       pb.User,
+		Priority:   int(pb.Priority),
+		RemoteOnly: pb.RemoteOnly,
+	}
+
+	if req.Outputs, err = idsFromPB(pb.Outputs); err != nil {
+		return nil, err
+	}
+
+	if pb.BuildId != nil {
+		id, err := idFromPB(pb.BuildId)
+		if err != nil {
+			return nil, err
+		}
+		req.BuildID = &id
+	}
+
+	if req.Graph.SourceFiles, err = sourceFilesFromPB(pb.GetGraph().GetSourceFiles()); err != nil {
+		return nil, err
+	}
+
+	for _, jobPB := range pb.GetGraph().GetJobs() {
+		job, err := jobFromPB(jobPB)
+		if err != nil {
+			return nil, err
+		}
+		req.Graph.Jobs = append(req.Graph.Jobs, job)
+	}
+	return req, nil
+}
+
+func buildStartedToPB(rsp *BuildStarted) *apipb.BuildStarted {
+	return &apipb.BuildStarted{Id: idToPB(rsp.ID), MissingFiles: idsToPB(rsp.MissingFiles)}
+}
+
+func buildStartedFromPB(pb *apipb.BuildStarted) (*BuildStarted, error) {
+	var err error
+	rsp := &BuildStarted{}
+	if rsp.ID, err = idFromPB(pb.Id); err != nil {
+		return nil, err
+	}
+	if rsp.MissingFiles, err = idsFromPB(pb.MissingFiles); err != nil {
+		return nil, err
+	}
+	return rsp, nil
+}
+
+func jobOutputToPB(out *JobOutput) *apipb.JobOutput {
+	return &apipb.JobOutput{Id: idToPB(out.ID), Stdout: out.Stdout, Stderr: out.Stderr}
+}
+
+func jobOutputFromPB(pb *apipb.JobOutput) (*JobOutput, error) {
+	id, err := idFromPB(pb.Id)
+	if err != nil {
+		return nil, err
+	}
+	return &JobOutput{ID: id, Stdout: pb.Stdout, Stderr: pb.Stderr}, nil
+}
+
+func jobResultToPB(res *JobResult) *apipb.JobResult {
+	return &apipb.JobResult{
+		Id:       idToPB(res.ID),
+		Stdout:   res.Stdout,
+		Stderr:   res.Stderr,
+		ExitCode: int64(res.ExitCode),
+		Error:    res.Error,
+		Cached:   res.Cached,
+	}
+}
+
+func jobResultFromPB(pb *apipb.JobResult) (*JobResult, error) {
+	id, err := idFromPB(pb.Id)
+	if err != nil {
+		return nil, err
+	}
+
+	return &JobResult{
+		ID:       id,
+		Stdout:   pb.Stdout,
+		Stderr:   pb.Stderr,
+		ExitCode: int(pb.ExitCode),
+		Error:    pb.Error,
+		Cached:   pb.Cached,
+	}, nil
+}
+
+func statusUpdateToPB(update *StatusUpdate) *apipb.StatusUpdate {
+	pb := &apipb.StatusUpdate{}
+	if update.JobOutput != nil {
+		pb.JobOutput = jobOutputToPB(update.JobOutput)
+	}
+	if update.JobFinished != nil {
+		pb.JobFinished = jobResultToPB(update.JobFinished)
+	}
+	if update.BuildFailed != nil {
+		pb.BuildFailed = &apipb.BuildFailed{Error: update.BuildFailed.Error}
+	}
+	if update.BuildFinished != nil {
+		pb.BuildFinished = &apipb.BuildFinished{Artifacts: locationsToPB(update.BuildFinished.Artifacts)}
+	}
+	return pb
+}
+
+func statusUpdateFromPB(pb *apipb.StatusUpdate) (*StatusUpdate, error) {
+	var err error
+	update := &StatusUpdate{}
+	if pb.JobOutput != nil {
+		if update.JobOutput, err = jobOutputFromPB(pb.JobOutput); err != nil {
+			return nil, err
+		}
+	}
+	if pb.JobFinished != nil {
+		if update.JobFinished, err = jobResultFromPB(pb.JobFinished); err != nil {
+			return nil, err
+		}
+	}
+	if pb.BuildFailed != nil {
+		update.BuildFailed = &BuildFailed{Error: pb.BuildFailed.Error}
+	}
+	if pb.BuildFinished != nil {
+		update.BuildFinished = &BuildFinished{}
+		if update.BuildFinished.Artifacts, err = locationsFromPB(pb.BuildFinished.Artifacts); err != nil {
+			return nil, err
+		}
+	}
+	return update, nil
+}
+
+// locationsToPB кладёт первого воркера в worker_id, а остальных в mirrors.
+func locationsToPB(locations map[build.ID][]WorkerID) []*apipb.Artifact {
+	var pb []*apipb.Artifact
+	for id, workers := range locations {
+		a := &apipb.Artifact{Id: idToPB(id)}
+		for i, workerID := range workers {
+			if i == 0 {
+				a.WorkerId = workerID.String()
+			} else {
+				a.Mirrors = append(a.Mirrors, workerID.String())
+			}
+		}
+		pb = append(pb, a)
+	}
+	return pb
+}
+
+func locationsFromPB(pb []*apipb.Artifact) (map[build.ID][]WorkerID, error) {
+	if len(pb) == 0 {
+		return nil, nil
+	}
+
+	locations := map[build.ID][]WorkerID{}
+	for _, a := range pb {
+		id, err := idFromPB(a.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		var workers []WorkerID
+		if a.WorkerId != "" {
+			workers = append(workers, WorkerID(a.WorkerId))
+		}
+		for _, mirror := range a.Mirrors {
+			workers = append(workers, WorkerID(mirror))
+		}
+		locations[id] = workers
+	}
+	return locations, nil
+}
+
+func signalToPB(buildID build.ID, signal *SignalRequest) *apipb.SignalBuildRequest {
+	pb := &apipb.SignalBuildRequest{BuildId: idToPB(buildID), Signal: &apipb.SignalRequest{}}
+	if signal.UploadDone != nil {
+		pb.Signal.UploadDone = &apipb.UploadDone{}
+	}
+	if signal.Cancel != nil {
+		pb.Signal.Cancel = &apipb.Cancel{Reason: signal.Cancel.Reason}
+	}
+	return pb
+}
+
+func signalFromPB(pb *apipb.SignalBuildRequest) (build.ID, *SignalRequest, error) {
+	buildID, err := idFromPB(pb.BuildId)
+	if err != nil {
+		return buildID, nil, err
+	}
+
+	signal := &SignalRequest{}
+	if pb.GetSignal().GetUploadDone() != nil {
+		signal.UploadDone = &UploadDone{}
+	}
+	if pb.GetSignal().GetCancel() != nil {
+		signal.Cancel = &Cancel{Reason: pb.Signal.Cancel.Reason}
+	}
+	return buildID, signal, nil
+}
+
+func heartbeatRequestToPB(req *HeartbeatRequest) *apipb.HeartbeatRequest {
+	pb := &apipb.HeartbeatRequest{
+		WorkerId:         req.WorkerID.String(),
+		RunningJobs:      idsToPB(req.RunningJobs),
+		FreeSlots:        int64(req.FreeSlots),
+		AddedArtifacts:   idsToPB(req.AddedArtifacts),
+		RemovedArtifacts: idsToPB(req.RemovedArtifacts),
+		Resources:        resourcesToPB(req.Resources),
+	}
+
+	for i := range req.FinishedJob {
+		pb.FinishedJob = append(pb.FinishedJob, jobResultToPB(&req.FinishedJob[i]))
+	}
+	for i := range req.JobOutput {
+		pb.JobOutput = append(pb.JobOutput, jobOutputToPB(&req.JobOutput[i]))
+	}
+	return pb
+}
+
+func heartbeatRequestFromPB(pb *apipb.HeartbeatRequest) (*HeartbeatRequest, error) {
+	var err error
+	req := &HeartbeatRequest{
+		WorkerID:  WorkerID(pb.WorkerId),
+		FreeSlots: int(pb.FreeSlots),
+		Resources: resourcesFromPB(pb.Resources),
+	}
+
+	if req.RunningJobs, err = idsFromPB(pb.RunningJobs); err != nil {
+		return nil, err
+	}
+	if req.AddedArtifacts, err = idsFromPB(pb.AddedArtifacts); err != nil {
+		return nil, err
+	}
+	if req.RemovedArtifacts, err = idsFromPB(pb.RemovedArtifacts); err != nil {
+		return nil, err
+	}
+
+	for _, resPB := range pb.FinishedJob {
+		res, err := jobResultFromPB(resPB)
+		if err != nil {
+			return nil, err
+		}
+		req.FinishedJob = append(req.FinishedJob, *res)
+	}
+	for _, outPB := range pb.JobOutput {
+		out, err := jobOutputFromPB(outPB)
+		if err != nil {
+			return nil, err
+		}
+		req.JobOutput = append(req.JobOutput, *out)
+	}
+	return req, nil
+}
+
+func jobSpecToPB(spec *JobSpec) *apipb.JobSpec {
+	pb := &apipb.JobSpec{
+		SourceFiles: sourceFilesToPB(spec.SourceFiles),
+		BuildId:     idToPB(spec.BuildID),
+		User:        spec.User,
+		Priority:    int64(spec.Priority),
+		Job:         jobToPB(&spec.Job),
+	}
+
+	for id, workerID := range spec.Artifacts {
+		a := &apipb.Artifact{Id: idToPB(id), WorkerId: workerID.String()}
+		for _, mirror := range spec.ArtifactMirrors[id] {
+			a.Mirrors = append(a.Mirrors, mirror.String())
+		}
+		pb.Artifacts = append(pb.Artifacts, a)
+	}
+	return pb
+}
+
+func jobSpecFromPB(pb *apipb.JobSpec) (*JobSpec, error) {
+	var err error
+	spec := &JobSpec{
+		User:     pb.User,
+		Priority: int(pb.Priority),
+	}
+
+	if spec.SourceFiles, err = sourceFilesFromPB(pb.SourceFiles); err != nil {
+		return nil, err
+	}
+	if spec.BuildID, err = idFromPB(pb.BuildId); err != nil {
+		return nil, err
+	}
+	if spec.Job, err = jobFromPB(pb.Job); err != nil {
+		return nil, err
+	}
+
+	if len(pb.Artifacts) != 0 {
+		spec.Artifacts = map[build.ID]WorkerID{}
+	}
+	for _, a := range pb.Artifacts {
+		id, err := idFromPB(a.Id)
+		if err != nil {
+			return nil, err
+		}
+		spec.Artifacts[id] = WorkerID(a.WorkerId)
+
+		if len(a.Mirrors) == 0 {
+			continue
+		}
+		if spec.ArtifactMirrors == nil {
+			spec.ArtifactMirrors = map[build.ID][]WorkerID{}
+		}
+		for _, mirror := range a.Mirrors {
+			spec.ArtifactMirrors[id] = append(spec.ArtifactMirrors[id], WorkerID(mirror))
+		}
+	}
+	return spec, nil
+}
+
+func heartbeatResponseToPB(rsp *HeartbeatResponse) *apipb.HeartbeatResponse {
+	pb := &apipb.HeartbeatResponse{
+		JobsToCancel: idsToPB(rsp.JobsToCancel),
+		Resync:       rsp.Resync,
+	}
+
+	for id, spec := range rsp.JobsToRun {
+		pb.JobsToRun = append(pb.JobsToRun, &apipb.JobToRun{Id: idToPB(id), Spec: jobSpecToPB(&spec)})
+	}
+	return pb
+}
+
+func heartbeatResponseFromPB(pb *apipb.HeartbeatResponse) (*HeartbeatResponse, error) {
+	var err error
+	rsp := &HeartbeatResponse{Resync: pb.Resync}
+
+	if rsp.JobsToCancel, err = idsFromPB(pb.JobsToCancel); err != nil {
+		return nil, err
+	}
+
+	if len(pb.JobsToRun) != 0 {
+		rsp.JobsToRun = map[build.ID]JobSpec{}
+	}
+	for _, job := range pb.JobsToRun {
+		id, err := idFromPB(job.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		spec, err := jobSpecFromPB(job.Spec)
+		if err != nil {
+			return nil, err
+		}
+		rsp.JobsToRun[id] = *spec
+	}
+	return rsp, nil
+}
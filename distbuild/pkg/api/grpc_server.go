@@ -0,0 +1,114 @@
+package api
+
+import (
+	"context"
+
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api/apipb"
+)
+
+// GRPCBuildHandler реализует Service поверх gRPC.
+type GRPCBuildHandler struct {
+	apipb.UnimplementedBuildServiceServer
+
+	l *zap.Logger
+	s Service
+}
+
+func NewGRPCBuildHandler(l *zap.Logger, s Service) *GRPCBuildHandler {
+	return &GRPCBuildHandler{l: l, s: s}
+}
+
+func (h *GRPCBuildHandler) Register(server *grpc.Server) {
+	apipb.RegisterBuildServiceServer(server, h)
+}
+
+type grpcStatusWriter struct {
+	stream  apipb.BuildService_StartBuildServer
+	started bool
+}
+
+func (w *grpcStatusWriter) Started(rsp *BuildStarted) error {
+	w.started = true
+	return w.stream.Send(&apipb.BuildStatus{Started: buildStartedToPB(rsp)})
+}
+
+func (w *grpcStatusWriter) Updated(update *StatusUpdate) error {
+	return w.stream.Send(&apipb.BuildStatus{Update: statusUpdateToPB(update)})
+}
+
+func (h *GRPCBuildHandler) StartBuild(pb *apipb.BuildRequest, stream apipb.BuildService_StartBuildServer) error {
+	req, err := buildRequestFromPB(pb)
+	if err != nil {
+		h.l.Error("invalid build request", zap.Error(err))
+		return status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	h.l.Debug("build started")
+
+	w := &grpcStatusWriter{stream: stream}
+	err = h.s.StartBuild(stream.Context(), req, w)
+	if err == nil {
+		return nil
+	}
+
+	h.l.Error("build failed", zap.Error(err))
+	if !w.started {
+		return err
+	}
+
+	return w.Updated(&StatusUpdate{BuildFailed: &BuildFailed{Error: err.Error()}})
+}
+
+func (h *GRPCBuildHandler) SignalBuild(ctx context.Context, pb *apipb.SignalBuildRequest) (*apipb.SignalResponse, error) {
+	buildID, signal, err := signalFromPB(pb)
+	if err != nil {
+		h.l.Error("invalid signal request", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	h.l.Debug("signal received", zap.Stringer("build_id", buildID))
+	if _, err := h.s.SignalBuild(ctx, buildID, signal); err != nil {
+		h.l.Error("signal failed", zap.Stringer("build_id", buildID), zap.Error(err))
+		return nil, err
+	}
+
+	return &apipb.SignalResponse{}, nil
+}
+
+// GRPCHeartbeatHandler реализует HeartbeatService поверх gRPC.
+type GRPCHeartbeatHandler struct {
+	apipb.UnimplementedHeartbeatServiceServer
+
+	l *zap.Logger
+	s HeartbeatService
+}
+
+func NewGRPCHeartbeatHandler(l *zap.Logger, s HeartbeatService) *GRPCHeartbeatHandler {
+	return &GRPCHeartbeatHandler{l: l, s: s}
+}
+
+func (h *GRPCHeartbeatHandler) Register(server *grpc.Server) {
+	apipb.RegisterHeartbeatServiceServer(server, h)
+}
+
+func (h *GRPCHeartbeatHandler) Heartbeat(ctx context.Context, pb *apipb.HeartbeatRequest) (*apipb.HeartbeatResponse, error) {
+	req, err := heartbeatRequestFromPB(pb)
+	if err != nil {
+		h.l.Error("invalid heartbeat request", zap.Error(err))
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	h.l.Debug("heartbeat received", zap.Stringer("worker_id", req.WorkerID))
+	rsp, err := h.s.Heartbeat(ctx, req)
+	if err != nil {
+		h.l.Error("heartbeat failed", zap.Stringer("worker_id", req.WorkerID), zap.Error(err))
+		return nil, err
+	}
+
+	return heartbeatResponseToPB(rsp), nil
+}
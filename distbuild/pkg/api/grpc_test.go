@@ -0,0 +1,208 @@
+package api_test
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/api/mock"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+func newGRPCConn(t *testing.T, register func(s *grpc.Server)) *grpc.ClientConn {
+	lis := bufconn.Listen(1 << 20)
+
+	server := grpc.NewServer()
+	register(server)
+	go func() { _ = server.Serve(lis) }()
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+
+	return conn
+}
+
+func newGRPCBuildEnv(t *testing.T) (*mock.MockService, *api.GRPCBuildClient) {
+	l := zaptest.NewLogger(t)
+	m := mock.NewMockService(gomock.NewController(t))
+
+	conn := newGRPCConn(t, api.NewGRPCBuildHandler(l, m).Register)
+	return m, api.NewGRPCBuildClient(l, conn)
+}
+
+func TestGRPCBuildSignal(t *testing.T) {
+	m, client := newGRPCBuildEnv(t)
+
+	buildID := build.ID{01}
+	req := &api.SignalRequest{Cancel: &api.Cancel{Reason: "timeout"}}
+
+	gomock.InOrder(
+		m.EXPECT().SignalBuild(gomock.Any(), buildID, req).Return(&api.SignalResponse{}, nil),
+		m.EXPECT().SignalBuild(gomock.Any(), buildID, req).Return(nil, fmt.Errorf("foo bar error")),
+	)
+
+	_, err := client.SignalBuild(context.Background(), buildID, req)
+	require.NoError(t, err)
+
+	_, err = client.SignalBuild(context.Background(), buildID, req)
+	require.EqualError(t, err, "foo bar error")
+}
+
+func TestGRPCBuildStartError(t *testing.T) {
+	m, client := newGRPCBuildEnv(t)
+
+	m.EXPECT().StartBuild(gomock.Any(), gomock.Any(), gomock.Any()).Return(fmt.Errorf("foo bar error"))
+
+	_, _, err := client.StartBuild(context.Background(), &api.BuildRequest{})
+	require.EqualError(t, err, "foo bar error")
+}
+
+func TestGRPCBuildRunning(t *testing.T) {
+	m, client := newGRPCBuildEnv(t)
+
+	buildID := build.ID{02}
+	errMsg := "exit status 1"
+	req := &api.BuildRequest{
+		Graph: build.Graph{
+			SourceFiles: map[build.ID]string{{01}: "a.txt"},
+			Jobs: []build.Job{{
+				ID:           build.ID{03},
+				Name:         "cat",
+				Inputs:       []string{"a.txt"},
+				Deps:         []build.ID{{04}},
+				Cmds:         []build.Cmd{{Exec: []string{"cat", "a.txt"}, Environ: []string{"A=B"}}},
+				Outputs:      []string{"bin/cat"},
+				Requirements: build.Resources{CPU: 1, Tags: []string{"race"}},
+			}},
+		},
+		User:       "alice",
+		Priority:   2,
+		Outputs:    []build.ID{{03}},
+		RemoteOnly: true,
+	}
+
+	started := &api.BuildStarted{ID: buildID, MissingFiles: []build.ID{{01}}}
+	updates := []*api.StatusUpdate{
+		{JobOutput: &api.JobOutput{ID: build.ID{03}, Stdout: []byte("a")}},
+		{JobFinished: &api.JobResult{ID: build.ID{03}, Stderr: []byte("b"), ExitCode: 1, Error: &errMsg}},
+		{BuildFinished: &api.BuildFinished{
+			Artifacts: map[build.ID][]api.WorkerID{{03}: {"worker1", "worker2"}},
+		}},
+	}
+
+	m.EXPECT().StartBuild(gomock.Any(), req, gomock.Any()).
+		DoAndReturn(func(_ context.Context, _ *api.BuildRequest, w api.StatusWriter) error {
+			if err := w.Started(started); err != nil {
+				return err
+			}
+
+			for _, u := range updates {
+				if err := w.Updated(u); err != nil {
+					return err
+				}
+			}
+
+			return fmt.Errorf("foo bar error")
+		})
+
+	rsp, r, err := client.StartBuild(context.Background(), req)
+	require.NoError(t, err)
+	defer func() { _ = r.Close() }()
+
+	require.Equal(t, started, rsp)
+
+	for _, expected := range updates {
+		u, err := r.Next()
+		require.NoError(t, err)
+		require.Equal(t, expected, u)
+	}
+
+	u, err := r.Next()
+	require.NoError(t, err)
+	require.Equal(t, "foo bar error", u.BuildFailed.Error)
+
+	_, err = r.Next()
+	require.Equal(t, io.EOF, err)
+}
+
+func TestGRPCBuildClientCancel(t *testing.T) {
+	m, client := newGRPCBuildEnv(t)
+
+	canceled := make(chan struct{})
+	m.EXPECT().StartBuild(gomock.Any(), gomock.Any(), gomock.Any()).
+		DoAndReturn(func(ctx context.Context, _ *api.BuildRequest, w api.StatusWriter) error {
+			if err := w.Started(&api.BuildStarted{}); err != nil {
+				return err
+			}
+
+			<-ctx.Done()
+			close(canceled)
+			return ctx.Err()
+		})
+
+	_, r, err := client.StartBuild(context.Background(), &api.BuildRequest{})
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+
+	<-canceled
+}
+
+func TestGRPCHeartbeat(t *testing.T) {
+	l := zaptest.NewLogger(t)
+	m := mock.NewMockHeartbeatService(gomock.NewController(t))
+
+	conn := newGRPCConn(t, api.NewGRPCHeartbeatHandler(l, m).Register)
+	client := api.NewGRPCHeartbeatClient(l, conn)
+
+	req := &api.HeartbeatRequest{
+		WorkerID:         "worker0",
+		RunningJobs:      []build.ID{{01}},
+		FreeSlots:        4,
+		Resources:        build.Resources{CPU: 8, Memory: 16 << 30, Tags: []string{"race", "cgo"}},
+		FinishedJob:      []api.JobResult{{ID: build.ID{02}, Stdout: []byte("ok"), Cached: true}},
+		JobOutput:        []api.JobOutput{{ID: build.ID{01}, Stderr: []byte("warning")}},
+		AddedArtifacts:   []build.ID{{02}},
+		RemovedArtifacts: []build.ID{{03}},
+	}
+	rsp := &api.HeartbeatResponse{
+		JobsToRun: map[build.ID]api.JobSpec{
+			{0x01}: {
+				SourceFiles: map[build.ID]string{{0x05}: "a.c"},
+				Artifacts:   map[build.ID]api.WorkerID{{0x06}: "worker1"},
+				ArtifactMirrors: map[build.ID][]api.WorkerID{
+					{0x06}: {"worker2", "worker3"},
+				},
+				BuildID: build.ID{0x07},
+				Job:     build.Job{Name: "cc a.c"},
+			},
+		},
+		JobsToCancel: []build.ID{{0x08}},
+		Resync:       true,
+	}
+
+	gomock.InOrder(
+		m.EXPECT().Heartbeat(gomock.Any(), gomock.Eq(req)).Times(1).Return(rsp, nil),
+		m.EXPECT().Heartbeat(gomock.Any(), gomock.Eq(req)).Times(1).Return(nil, fmt.Errorf("build error: foo bar")),
+	)
+
+	clientRsp, err := client.Heartbeat(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, rsp, clientRsp)
+
+	_, err = client.Heartbeat(context.Background(), req)
+	require.EqualError(t, err, "build error: foo bar")
+}
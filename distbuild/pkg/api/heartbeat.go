@@ -18,6 +18,21 @@ type JobResult struct {
 	//
 	// Если Error == nil, значит джоб завершился успешно.
 	Error *string
+
+	// Cached равен true, если джоб не запускался, а результат взят из кеша координатора.
+	Cached bool
+}
+
+// JobOutput описывает очередной кусок вывода бегущего джоба.
+//
+// Куски одного джоба передаются по порядку и всегда раньше, чем его JobResult.
+// Если часть вывода была передана через JobOutput, то JobResult.Stdout и JobResult.Stderr
+// в HeartbeatRequest и StatusUpdate содержат только оставшийся хвост. В кеш результатов
+// и в журнал координатор сохраняет склеенные куски и хвост, обрезанные по лимиту, см. joblog.Collector.
+type JobOutput struct {
+	ID build.ID
+
+	Stdout, Stderr []byte
 }
 
 type WorkerID string
@@ -41,12 +56,22 @@ type HeartbeatRequest struct {
 	// FreeSlots сообщает, сколько еще процессов можно запустить на этом воркере.
 	FreeSlots int
 
+	// Resources описывает все ресурсы воркера: число ядер, память и метки, например race или cgo.
+	// Планировщик сам вычитает из них требования джобов, которые выполняются на воркере.
+	Resources build.Resources
+
 	// JobResult сообщает координатору, какие джобы завершили исполнение на этом воркере
 	// на этой итерации цикла.
 	FinishedJob []JobResult
 
+	// JobOutput содержит вывод бегущих джобов, накопившийся с прошлой итерации цикла.
+	JobOutput []JobOutput
+
 	// AddedArtifacts говорит, какие артефакты появились в кеше на этой итерации цикла.
 	AddedArtifacts []build.ID
+
+	// RemovedArtifacts говорит, какие артефакты были удалены из кеша на этой итерации цикла.
+	RemovedArtifacts []build.ID
 }
 
 // JobSpec описывает джоб, который нужно запустить.
@@ -57,11 +82,33 @@ type JobSpec struct {
 	// Artifacts задаёт воркеров, с которых можно скачать артефакты необходимые этому джобу.
 	Artifacts map[build.ID]WorkerID
 
+	// ArtifactMirrors перечисляет других воркеров, у которых есть тот же артефакт.
+	// Если скачивание с воркера из Artifacts прервалось, его можно продолжить с любого из них.
+	//
+	// Ключи ArtifactMirrors - подмножество ключей Artifacts.
+	ArtifactMirrors map[build.ID][]WorkerID
+
+	// BuildID, User и Priority описывают сборку, к которой относится джоб.
+	// Воркер эти поля не использует, они нужны планировщику.
+	BuildID  build.ID
+	User     string
+	Priority int
+
 	build.Job
 }
 
 type HeartbeatResponse struct {
 	JobsToRun map[build.ID]JobSpec
+
+	// JobsToCancel перечисляет джобы, которые воркер должен убить.
+	//
+	// Убитые джобы воркер сообщает в FinishedJob с заполненным полем Error.
+	JobsToCancel []build.ID
+
+	// Resync просит воркера перечислить в AddedArtifacts следующего heartbeat-а
+	// все артефакты из своего кеша. Координатор выставляет этот флаг, когда видит
+	// воркера впервые, например после своего перезапуска.
+	Resync bool
 }
 
 type HeartbeatService interface {
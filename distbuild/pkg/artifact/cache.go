@@ -1,14 +1,19 @@
 package artifact
 
 import (
+	"bytes"
 	"encoding/hex"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/metrics"
 )
 
 var (
@@ -25,6 +30,14 @@ type Cache struct {
 	mu          sync.Mutex
 	writeLocked map[build.ID]struct{}
 	readLocked  map[build.ID]int
+
+	sizes    map[build.ID]int64
+	lastUsed map[build.ID]time.Time
+	hashes   map[build.ID]build.ID
+	// streamSizes запоминает длину потока tarstream, см. Cache.StreamSize.
+	streamSizes map[build.ID]int64
+
+	hits, misses atomic.Int64
 }
 
 func NewCache(root string) (*Cache, error) {
@@ -49,12 +62,53 @@ func NewCache(root string) (*Cache, error) {
 		}
 	}
 
-	return &Cache{
+	c := &Cache{
 		tmpDir:      tmpDir,
 		cacheDir:    cacheDir,
 		writeLocked: make(map[build.ID]struct{}),
 		readLocked:  make(map[build.ID]int),
-	}, nil
+		sizes:       make(map[build.ID]int64),
+		lastUsed:    make(map[build.ID]time.Time),
+		hashes:      make(map[build.ID]build.ID),
+		streamSizes: make(map[build.ID]int64),
+	}
+
+	err := c.Range(func(id build.ID) error {
+		path := filepath.Join(cacheDir, id.Path())
+
+		st, err := os.Stat(path)
+		if err != nil {
+			return err
+		}
+
+		size, err := dirSize(path)
+		if err != nil {
+			return err
+		}
+
+		c.sizes[id] = size
+		c.lastUsed[id] = st.ModTime()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func dirSize(dir string) (int64, error) {
+	var size int64
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size, err
 }
 
 func (c *Cache) readLock(id build.ID) error {
@@ -77,6 +131,10 @@ func (c *Cache) readUnlock(id build.ID) {
 	if c.readLocked[id] == 0 {
 		delete(c.readLocked, id)
 	}
+
+	if _, ok := c.lastUsed[id]; ok {
+		c.lastUsed[id] = time.Now()
+	}
 }
 
 func (c *Cache) writeLock(id build.ID, remove bool) error {
@@ -141,7 +199,18 @@ func (c *Cache) Remove(artifact build.ID) error {
 	}
 	defer c.writeUnlock(artifact)
 
-	return os.RemoveAll(filepath.Join(c.cacheDir, artifact.Path()))
+	if err := os.RemoveAll(filepath.Join(c.cacheDir, artifact.Path())); err != nil {
+		return err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.sizes, artifact)
+	delete(c.lastUsed, artifact)
+	delete(c.hashes, artifact)
+	delete(c.streamSizes, artifact)
+	return nil
 }
 
 func (c *Cache) Create(artifact build.ID) (path string, commit, abort func() error, err error) {
@@ -162,7 +231,22 @@ func (c *Cache) Create(artifact build.ID) (path string, commit, abort func() err
 
 	commit = func() error {
 		defer c.writeUnlock(artifact)
-		return os.Rename(path, filepath.Join(c.cacheDir, artifact.Path()))
+
+		size, err := dirSize(path)
+		if err != nil {
+			return err
+		}
+
+		if err := os.Rename(path, filepath.Join(c.cacheDir, artifact.Path())); err != nil {
+			return err
+		}
+
+		c.mu.Lock()
+		defer c.mu.Unlock()
+
+		c.sizes[artifact] = size
+		c.lastUsed[artifact] = time.Now()
+		return nil
 	}
 
 	return
@@ -178,13 +262,99 @@ func (c *Cache) Get(artifact build.ID) (path string, unlock func(), err error) {
 		c.readUnlock(artifact)
 
 		if os.IsNotExist(err) {
+			c.misses.Add(1)
 			err = ErrNotFound
 		}
 		return
 	}
 
+	c.hits.Add(1)
 	unlock = func() {
 		c.readUnlock(artifact)
 	}
 	return
 }
+
+// Size возвращает суммарный размер всех закоммиченных артефактов в байтах.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var total int64
+	for _, size := range c.sizes {
+		total += size
+	}
+	return total
+}
+
+// RegisterMetrics экспортирует в r размер кеша и долю попаданий Get. Имена метрик начинаются с prefix.
+func (c *Cache) RegisterMetrics(r *metrics.Registry, prefix string) {
+	r.GaugeFunc(prefix+"_size_bytes", "Total size of committed artifacts.", func() float64 {
+		return float64(c.Size())
+	})
+	r.GaugeFunc(prefix+"_artifacts", "Number of committed artifacts.", func() float64 {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return float64(len(c.sizes))
+	})
+	r.CounterFunc(prefix+"_hits_total", "Get calls that found the artifact.", func() float64 {
+		return float64(c.hits.Load())
+	})
+	r.CounterFunc(prefix+"_misses_total", "Get calls that did not find the artifact.", func() float64 {
+		return float64(c.misses.Load())
+	})
+}
+
+// Evict удаляет давно не использовавшиеся артефакты, пока суммарный размер кеша не уложится в budget.
+//
+// Артефакты, на которые взят лок на чтение или запись, и артефакты, для которых pinned вернул true,
+// не удаляются. pinned может быть nil. Evict возвращает ID удалённых артефактов, даже если
+// уложиться в budget не удалось.
+//
+// Время использования не сохраняется между перезапусками: после NewCache оно равно mtime директории
+// артефакта. Артефакты с одинаковым временем удаляются в порядке ID, чтобы Evict был детерминированным.
+func (c *Cache) Evict(budget int64, pinned func(artifact build.ID) bool) (removed []build.ID, err error) {
+	type entry struct {
+		id       build.ID
+		size     int64
+		lastUsed time.Time
+	}
+
+	c.mu.Lock()
+	var total int64
+	entries := make([]entry, 0, len(c.sizes))
+	for id, size := range c.sizes {
+		total += size
+		entries = append(entries, entry{id: id, size: size, lastUsed: c.lastUsed[id]})
+	}
+	c.mu.Unlock()
+
+	sort.Slice(entries, func(i, j int) bool {
+		if !entries[i].lastUsed.Equal(entries[j].lastUsed) {
+			return entries[i].lastUsed.Before(entries[j].lastUsed)
+		}
+		return bytes.Compare(entries[i].id[:], entries[j].id[:]) < 0
+	})
+
+	for _, e := range entries {
+		if total <= budget {
+			break
+		}
+
+		if pinned != nil && pinned(e.id) {
+			continue
+		}
+
+		switch err = c.Remove(e.id); {
+		case err == nil:
+			removed = append(removed, e.id)
+			total -= e.size
+		case errors.Is(err, ErrReadLocked), errors.Is(err, ErrWriteLocked):
+			err = nil
+		default:
+			return
+		}
+	}
+
+	return
+}
@@ -4,12 +4,15 @@ import (
 	"errors"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
 	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
 	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/metrics"
 )
 
 type testCache struct {
@@ -96,3 +99,106 @@ func TestArtifactExists(t *testing.T) {
 	_, _, _, err = c.Create(idA)
 	require.Truef(t, errors.Is(err, artifact.ErrExists), "%v", err)
 }
+
+func createArtifact(t *testing.T, c *testCache, id build.ID, size int) {
+	t.Helper()
+
+	path, commit, _, err := c.Create(id)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(path, "a.bin"), make([]byte, size), 0666))
+	require.NoError(t, commit())
+}
+
+func TestEvict(t *testing.T) {
+	c := newTestCache(t)
+
+	idA, idB, idC, idD := build.ID{'a'}, build.ID{'b'}, build.ID{'c'}, build.ID{'d'}
+
+	createArtifact(t, c, idA, 100)
+	createArtifact(t, c, idB, 100)
+	createArtifact(t, c, idC, 100)
+	createArtifact(t, c, idD, 100)
+	require.Equal(t, int64(400), c.Size())
+
+	// A is the least recently used, but it is locked.
+	_, unlockA, err := c.Get(idA)
+	require.NoError(t, err)
+	defer unlockA()
+
+	// B becomes most recently used.
+	_, unlockB, err := c.Get(idB)
+	require.NoError(t, err)
+	unlockB()
+
+	pinned := func(id build.ID) bool { return id == idC }
+
+	removed, err := c.Evict(300, pinned)
+	require.NoError(t, err)
+	require.Equal(t, []build.ID{idD}, removed)
+	require.Equal(t, int64(300), c.Size())
+
+	removed, err = c.Evict(0, pinned)
+	require.NoError(t, err)
+	require.Equal(t, []build.ID{idB}, removed)
+
+	_, _, err = c.Get(idB)
+	require.Truef(t, errors.Is(err, artifact.ErrNotFound), "%v", err)
+}
+
+func TestEvictSameLastUsed(t *testing.T) {
+	c := newTestCache(t)
+
+	ids := []build.ID{{'c'}, {'a'}, {'d'}, {'b'}}
+	for _, id := range ids {
+		createArtifact(t, c, id, 100)
+	}
+
+	// After restart last use time comes from mtime, which may be the same for many artifacts.
+	mtime := time.Now().Add(-time.Hour)
+	for _, id := range ids {
+		path := filepath.Join(c.tmpDir, "c", id.Path())
+		require.NoError(t, os.Chtimes(path, mtime, mtime))
+	}
+
+	reopened, err := artifact.NewCache(c.tmpDir)
+	require.NoError(t, err)
+
+	removed, err := reopened.Evict(200, nil)
+	require.NoError(t, err)
+	require.Equal(t, []build.ID{{'a'}, {'b'}}, removed)
+}
+
+func TestSizeAfterRestart(t *testing.T) {
+	c := newTestCache(t)
+	createArtifact(t, c, build.ID{'a'}, 100)
+
+	reopened, err := artifact.NewCache(c.tmpDir)
+	require.NoError(t, err)
+	require.Equal(t, int64(100), reopened.Size())
+}
+
+func TestMetrics(t *testing.T) {
+	c := newTestCache(t)
+	r := metrics.NewRegistry()
+	c.RegisterMetrics(r, "cache")
+
+	path, commit, _, err := c.Create(build.ID{'a'})
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(filepath.Join(path, "a.txt"), []byte("hello"), 0666))
+	require.NoError(t, commit())
+
+	_, unlock, err := c.Get(build.ID{'a'})
+	require.NoError(t, err)
+	unlock()
+
+	_, _, err = c.Get(build.ID{'b'})
+	require.Truef(t, errors.Is(err, artifact.ErrNotFound), "%v", err)
+
+	var out strings.Builder
+	require.NoError(t, r.WriteText(&out))
+
+	require.Contains(t, out.String(), "cache_artifacts 1\n")
+	require.Contains(t, out.String(), "cache_size_bytes 5\n")
+	require.Contains(t, out.String(), "cache_hits_total 1\n")
+	require.Contains(t, out.String(), "cache_misses_total 1\n")
+}
@@ -0,0 +1,143 @@
+package artifact
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// Identity означает передачу потока без сжатия.
+const Identity = "identity"
+
+type encoding struct {
+	name      string
+	newWriter func(w io.Writer) (io.WriteCloser, error)
+	newReader func(r io.Reader) (io.ReadCloser, error)
+}
+
+var (
+	encodingsMu sync.Mutex
+	encodings   []encoding
+)
+
+// Из коробки поддерживаются gzip и zstd. zstd регистрируется последним и поэтому предпочтительнее:
+// он быстрее сжимает и распаковывает при той же степени сжатия.
+func init() {
+	RegisterEncoding("gzip",
+		func(w io.Writer) (io.WriteCloser, error) {
+			return gzip.NewWriterLevel(w, gzip.BestSpeed)
+		},
+		func(r io.Reader) (io.ReadCloser, error) {
+			return gzip.NewReader(r)
+		})
+
+	RegisterEncoding("zstd",
+		func(w io.Writer) (io.WriteCloser, error) {
+			return zstd.NewWriter(w, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		},
+		func(r io.Reader) (io.ReadCloser, error) {
+			d, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1))
+			if err != nil {
+				return nil, err
+			}
+			return d.IOReadCloser(), nil
+		})
+}
+
+// RegisterEncoding добавляет алгоритм сжатия, который можно использовать для передачи артефактов.
+//
+// Алгоритмы, зарегистрированные позже, считаются более предпочтительными. Повторная регистрация
+// под тем же именем заменяет реализацию, например на версию с другим уровнем сжатия.
+func RegisterEncoding(
+	name string,
+	newWriter func(w io.Writer) (io.WriteCloser, error),
+	newReader func(r io.Reader) (io.ReadCloser, error),
+) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	for i := range encodings {
+		if encodings[i].name == name {
+			encodings = append(encodings[:i], encodings[i+1:]...)
+			break
+		}
+	}
+	encodings = append([]encoding{{name: name, newWriter: newWriter, newReader: newReader}}, encodings...)
+}
+
+func lookupEncoding(name string) (encoding, bool) {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	for _, e := range encodings {
+		if e.name == name {
+			return e, true
+		}
+	}
+	return encoding{}, false
+}
+
+// AcceptEncoding возвращает значение заголовка Accept-Encoding со всеми зарегистрированными алгоритмами
+// в порядке предпочтения.
+func AcceptEncoding() string {
+	encodingsMu.Lock()
+	defer encodingsMu.Unlock()
+
+	var names []string
+	for _, e := range encodings {
+		names = append(names, e.name)
+	}
+	return strings.Join(append(names, Identity), ", ")
+}
+
+// NegotiateEncoding выбирает алгоритм сжатия по заголовку Accept-Encoding клиента.
+//
+// Выбирается первый алгоритм из списка клиента, который поддерживает сервер. Веса (;q=) игнорируются.
+// Если общих алгоритмов нет, возвращается Identity.
+func NegotiateEncoding(accept string) string {
+	for _, part := range strings.Split(accept, ",") {
+		name := strings.TrimSpace(strings.SplitN(part, ";", 2)[0])
+		if _, ok := lookupEncoding(name); ok {
+			return name
+		}
+	}
+	return Identity
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
+
+// NewEncoder оборачивает w в алгоритм сжатия name. Close на результате не закрывает w.
+func NewEncoder(name string, w io.Writer) (io.WriteCloser, error) {
+	if name == Identity || name == "" {
+		return nopWriteCloser{w}, nil
+	}
+
+	e, ok := lookupEncoding(name)
+	if !ok {
+		return nil, fmt.Errorf("unsupported encoding %q", name)
+	}
+	return e.newWriter(w)
+}
+
+// NewDecoder возвращает поток, распакованный алгоритмом name.
+func NewDecoder(name string, r io.Reader) (io.ReadCloser, error) {
+	if name == Identity || name == "" {
+		return io.NopCloser(r), nil
+	}
+
+	e, ok := lookupEncoding(name)
+	if !ok {
+		return nil, fmt.Errorf("unsupported encoding %q", name)
+	}
+	return e.newReader(r)
+}
@@ -0,0 +1,454 @@
+package artifact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"sync"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/tarstream"
+)
+
+// HashHeader - заголовок ответа GET /artifact, в котором сервер передаёт Hash артефакта.
+const HashHeader = "X-Artifact-Hash"
+
+// SizeHeader - заголовок ответа GET /artifact, в котором сервер передаёт длину всего потока
+// tarstream до сжатия, см. StreamSize.
+const SizeHeader = "X-Artifact-Size"
+
+// DefaultPartSize - размер части потока, которую Fetcher качает с одного воркера, если Fetcher.PartSize не задан.
+const DefaultPartSize = 4 << 20
+
+// ErrCorrupted возвращается, если Hash скачанного артефакта не совпал с хешем, который прислал сервер.
+var ErrCorrupted = errors.New("artifact is corrupted")
+
+var errLimitReached = errors.New("limit reached")
+
+// rangeWriter пропускает первые skip байт и передаёт в w не больше limit следующих.
+type rangeWriter struct {
+	w     io.Writer
+	skip  int64
+	limit int64
+}
+
+func (s *rangeWriter) Write(p []byte) (int, error) {
+	n := len(p)
+	if s.skip >= int64(n) {
+		s.skip -= int64(n)
+		return n, nil
+	}
+
+	p = p[s.skip:]
+	s.skip = 0
+
+	if s.limit >= 0 && int64(len(p)) >= s.limit {
+		if _, err := s.w.Write(p[:s.limit]); err != nil {
+			return 0, err
+		}
+		s.limit = 0
+		return n, errLimitReached
+	}
+
+	if _, err := s.w.Write(p); err != nil {
+		return 0, err
+	}
+	if s.limit >= 0 {
+		s.limit -= int64(len(p))
+	}
+	return n, nil
+}
+
+// Stream пишет в w содержимое директории dir в формате tarstream, пропуская первые offset байт.
+// Если limit не отрицательный, Stream записывает не больше limit байт.
+//
+// Поток tarstream для одинакового содержимого всегда одинаковый, поэтому клиент может продолжить
+// прерванное скачивание с того же или с другого воркера и качать разные части потока с разных воркеров.
+func Stream(dir string, w io.Writer, offset, limit int64) error {
+	if limit == 0 {
+		return nil
+	}
+
+	err := tarstream.Send(dir, &rangeWriter{w: w, skip: offset, limit: limit})
+	if errors.Is(err, errLimitReached) {
+		return nil
+	}
+	return err
+}
+
+type countingWriter struct {
+	n int64
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.n += int64(len(p))
+	return len(p), nil
+}
+
+// StreamSize возвращает длину потока tarstream для директории dir.
+func StreamSize(dir string) (int64, error) {
+	var w countingWriter
+	if err := tarstream.Send(dir, &w); err != nil {
+		return 0, err
+	}
+	return w.n, nil
+}
+
+// StreamSize возвращает длину потока tarstream артефакта и запоминает её так же, как Hash.
+func (c *Cache) StreamSize(artifact build.ID) (int64, error) {
+	c.mu.Lock()
+	size, ok := c.streamSizes[artifact]
+	c.mu.Unlock()
+
+	if ok {
+		return size, nil
+	}
+
+	path, unlock, err := c.Get(artifact)
+	if err != nil {
+		return 0, err
+	}
+	defer unlock()
+
+	if size, err = StreamSize(path); err != nil {
+		return 0, err
+	}
+
+	c.mu.Lock()
+	c.streamSizes[artifact] = size
+	c.mu.Unlock()
+	return size, nil
+}
+
+// download хранит состояние одной попытки скачать артефакт, общее для всех воркеров.
+type download struct {
+	artifactID build.ID
+	client     *http.Client
+
+	mu sync.Mutex
+	// hash и size - хеш артефакта и длина потока, которые прислал первый ответивший воркер.
+	// size равен -1, если воркер не прислал SizeHeader.
+	hash *build.ID
+	size int64
+	// sources - воркеры, от которых получены данные.
+	sources map[string]struct{}
+}
+
+// Fetcher скачивает артефакты с воркеров.
+type Fetcher struct {
+	// Client выполняет запросы к воркерам. nil означает http.DefaultClient.
+	//
+	// Если воркеры требуют аутентификации, сюда передаётся auth.Credentials.PeerHTTPClient.
+	Client *http.Client
+
+	// PartSize - размер части потока, которую Fetch качает с одного воркера. 0 означает DefaultPartSize.
+	PartSize int64
+}
+
+func (f Fetcher) client() *http.Client {
+	if f.Client == nil {
+		return http.DefaultClient
+	}
+	return f.Client
+}
+
+func (f Fetcher) partSize() int64 {
+	if f.PartSize <= 0 {
+		return DefaultPartSize
+	}
+	return f.PartSize
+}
+
+// Fetch скачивает артефакт так же, как Fetcher.Fetch, используя http.DefaultClient.
+func Fetch(ctx context.Context, c *Cache, artifactID build.ID, endpoints ...string) error {
+	return Fetcher{}.Fetch(ctx, c, artifactID, endpoints...)
+}
+
+// Fetch скачивает артефакт в локальный кеш c, используя endpoints воркеров, у которых этот артефакт есть.
+//
+// Первую часть потока Fetch качает с первого доступного воркера и узнаёт из ответа длину потока.
+// Остальной поток делится на части по числу воркеров, но не меньше PartSize, и части качаются
+// параллельно с разных воркеров.
+// Если скачивание части с одного воркера прервалось, Fetch продолжает его со следующего воркера
+// с того же места. Перед commit проверяется, что Hash полученной директории совпадает с хешем,
+// который прислали воркеры.
+//
+// Если хеш не совпал, а данные пришли от нескольких воркеров, воркеры могли отдать разное содержимое
+// под одним хешем. Тогда Fetch скачивает артефакт заново с нулевого смещения, каждый раз целиком
+// с одного воркера. ErrCorrupted возвращается, только если не удалось и это.
+func (f Fetcher) Fetch(ctx context.Context, c *Cache, artifactID build.ID, endpoints ...string) error {
+	if len(endpoints) == 0 {
+		return fmt.Errorf("artifact %s: no endpoints", artifactID)
+	}
+
+	sources, err := f.fetch(ctx, c, artifactID, endpoints, true)
+	if err == nil || sources < 2 || !errors.Is(err, ErrCorrupted) {
+		return err
+	}
+
+	for _, endpoint := range endpoints {
+		if ctx.Err() != nil {
+			break
+		}
+
+		if _, err = f.fetch(ctx, c, artifactID, []string{endpoint}, false); err == nil {
+			return nil
+		}
+	}
+	return err
+}
+
+// fetch делает одну попытку скачать артефакт и возвращает число воркеров, от которых пришли данные.
+func (f Fetcher) fetch(ctx context.Context, c *Cache, artifactID build.ID, endpoints []string, parallel bool) (int, error) {
+	path, commit, abort, err := c.Create(artifactID)
+	if err != nil {
+		return 0, err
+	}
+
+	pr, pw := io.Pipe()
+	received := make(chan error, 1)
+	go func() {
+		err := tarstream.Receive(path, pr)
+		if err == nil {
+			// Дочитываем хвост потока, чтобы запись последнего блока не зависла.
+			_, err = io.Copy(io.Discard, pr)
+		}
+		_ = pr.CloseWithError(err)
+		received <- err
+	}()
+
+	d := &download{
+		artifactID: artifactID,
+		client:     f.client(),
+		size:       -1,
+		sources:    map[string]struct{}{},
+	}
+
+	if err := d.fetchAll(ctx, c.tmpDir, endpoints, pw, parallel, f.partSize()); err != nil {
+		_ = pw.CloseWithError(err)
+		<-received
+		_ = abort()
+		return len(d.sources), err
+	}
+
+	_ = pw.Close()
+	if err := <-received; err != nil {
+		_ = abort()
+		if len(d.sources) > 1 {
+			// Поток, склеенный из частей разных воркеров, мог не разобраться именно из-за расхождения.
+			return len(d.sources), fmt.Errorf("download artifact %s: %w: %v", artifactID, ErrCorrupted, err)
+		}
+		return len(d.sources), fmt.Errorf("download artifact %s: %w", artifactID, err)
+	}
+
+	got, err := Hash(path)
+	if err != nil {
+		_ = abort()
+		return len(d.sources), err
+	}
+
+	if got != *d.hash {
+		_ = abort()
+		return len(d.sources), fmt.Errorf("artifact %s: %w", artifactID, ErrCorrupted)
+	}
+
+	return len(d.sources), commit()
+}
+
+// fetchAll пишет в w весь поток артефакта.
+func (d *download) fetchAll(ctx context.Context, tmpDir string, endpoints []string, w io.Writer, parallel bool, partSize int64) error {
+	if !parallel || len(endpoints) == 1 {
+		return d.fetchRange(ctx, endpoints, w, 0, -1)
+	}
+
+	if err := d.fetchRange(ctx, endpoints, w, 0, partSize); err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	size := d.size
+	d.mu.Unlock()
+
+	switch {
+	case size < 0:
+		return d.fetchRange(ctx, endpoints, w, partSize, -1)
+	case size <= partSize:
+		return nil
+	}
+
+	return d.fetchParts(ctx, tmpDir, endpoints, w, partSize, size)
+}
+
+type part struct {
+	start, end int64
+
+	file *os.File
+	done chan error
+}
+
+// fetchParts параллельно качает поток с partSize до size во временные файлы и пишет их в w по порядку.
+//
+// Часть i начинается с воркера i, так что части расходятся по разным воркерам.
+func (d *download) fetchParts(ctx context.Context, tmpDir string, endpoints []string, w io.Writer, partSize, size int64) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	n := (size - partSize + partSize - 1) / partSize
+	parallel := min(n, int64(len(endpoints)))
+	partLen := (size - partSize + parallel - 1) / parallel
+
+	var parts []*part
+	for start := partSize; start < size; start += partLen {
+		parts = append(parts, &part{start: start, end: min(start+partLen, size), done: make(chan error, 1)})
+	}
+
+	var wg sync.WaitGroup
+	defer func() {
+		cancel()
+		wg.Wait()
+
+		for _, p := range parts {
+			if p.file != nil {
+				_ = p.file.Close()
+				_ = os.Remove(p.file.Name())
+			}
+		}
+	}()
+
+	for i, p := range parts {
+		file, err := os.CreateTemp(tmpDir, "part-*")
+		if err != nil {
+			return err
+		}
+		p.file = file
+
+		order := append(append([]string(nil), endpoints[i%len(endpoints):]...), endpoints[:i%len(endpoints)]...)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.done <- d.fetchRange(ctx, order, p.file, p.start, p.end)
+		}()
+	}
+
+	for _, p := range parts {
+		if err := <-p.done; err != nil {
+			return err
+		}
+
+		if _, err := p.file.Seek(0, io.SeekStart); err != nil {
+			return err
+		}
+		if _, err := io.Copy(w, p.file); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fetchRange пишет в w байты потока с offset до end, обходя endpoints по очереди. Если скачивание
+// с воркера прервалось, следующий воркер продолжает с того же места. end < 0 означает конец потока.
+func (d *download) fetchRange(ctx context.Context, endpoints []string, w io.Writer, offset, end int64) error {
+	var lastErr error
+	for _, endpoint := range endpoints {
+		n, err := d.fetchFrom(ctx, endpoint, w, offset, end)
+		offset += n
+		if n != 0 {
+			d.mu.Lock()
+			d.sources[endpoint] = struct{}{}
+			d.mu.Unlock()
+		}
+
+		if err == nil {
+			return nil
+		}
+
+		lastErr = fmt.Errorf("download artifact %s from %s: %w", d.artifactID, endpoint, err)
+		if ctx.Err() != nil {
+			break
+		}
+	}
+	return lastErr
+}
+
+// fetchFrom запрашивает у endpoint поток артефакта с offset до end и дописывает его в w.
+// Возвращает число записанных байт.
+//
+// Если хеш уже известен, данные принимаются только от воркера с тем же хешем артефакта.
+func (d *download) fetchFrom(ctx context.Context, endpoint string, w io.Writer, offset, end int64) (int64, error) {
+	query := url.Values{}
+	query.Set("id", d.artifactID.String())
+	query.Set("offset", strconv.FormatInt(offset, 10))
+	if end >= 0 {
+		query.Set("limit", strconv.FormatInt(end-offset, 10))
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/artifact?"+query.Encode(), nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Accept-Encoding", AcceptEncoding())
+
+	rsp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Body.Close()
+
+	if rsp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(rsp.Body, 1024))
+		return 0, fmt.Errorf("%s: %s", rsp.Status, msg)
+	}
+
+	var h build.ID
+	if err := h.UnmarshalText([]byte(rsp.Header.Get(HashHeader))); err != nil {
+		return 0, fmt.Errorf("invalid %s header: %w", HashHeader, err)
+	}
+
+	size := int64(-1)
+	if v := rsp.Header.Get(SizeHeader); v != "" {
+		if size, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return 0, fmt.Errorf("invalid %s header: %w", SizeHeader, err)
+		}
+	}
+
+	d.mu.Lock()
+	if d.hash == nil {
+		d.hash = &h
+		d.size = size
+	} else if *d.hash != h {
+		d.mu.Unlock()
+		return 0, fmt.Errorf("worker has different version of artifact: %w", ErrCorrupted)
+	}
+	size = d.size
+	d.mu.Unlock()
+
+	if end >= 0 && size >= 0 {
+		end = min(end, size)
+	}
+
+	body, err := NewDecoder(rsp.Header.Get("Content-Encoding"), rsp.Body)
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+
+	if end < 0 {
+		return io.Copy(w, body)
+	}
+
+	n, err := io.CopyN(w, body, max(end-offset, 0))
+	if errors.Is(err, io.EOF) {
+		if size < 0 {
+			// Без SizeHeader конец потока раньше end означает, что поток короче.
+			return n, nil
+		}
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
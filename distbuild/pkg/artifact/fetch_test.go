@@ -0,0 +1,334 @@
+package artifact_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// testServer реализует GET /artifact так, как описано в README.
+type testServer struct {
+	cache *artifact.Cache
+
+	// encoding переопределяет выбор алгоритма сжатия, cutAfter обрывает ответ после заданного числа байт.
+	encoding string
+	cutAfter int
+	hash     *build.ID
+
+	mu        sync.Mutex
+	offsets   []int64
+	encodings []string
+}
+
+type cutWriter struct {
+	w     http.ResponseWriter
+	limit int
+}
+
+func (c *cutWriter) Write(p []byte) (int, error) {
+	if len(p) > c.limit {
+		_, _ = c.w.Write(p[:c.limit])
+		http.NewResponseController(c.w).Flush()
+		panic(http.ErrAbortHandler)
+	}
+
+	c.limit -= len(p)
+	return c.w.Write(p)
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var id build.ID
+	if err := id.UnmarshalText([]byte(r.URL.Query().Get("id"))); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.URL.Query().Get("offset"), 10, 64)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	limit := int64(-1)
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if limit, err = strconv.ParseInt(v, 10, 64); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	path, unlock, err := s.cache.Get(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer unlock()
+
+	hash, err := s.cache.Hash(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if s.hash != nil {
+		hash = *s.hash
+	}
+
+	size, err := s.cache.StreamSize(id)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	encoding := artifact.NegotiateEncoding(r.Header.Get("Accept-Encoding"))
+	if s.encoding != "" {
+		encoding = s.encoding
+	}
+
+	s.mu.Lock()
+	s.offsets = append(s.offsets, offset)
+	s.encodings = append(s.encodings, encoding)
+	s.mu.Unlock()
+
+	w.Header().Set(artifact.HashHeader, hash.String())
+	w.Header().Set(artifact.SizeHeader, strconv.FormatInt(size, 10))
+	if encoding != artifact.Identity {
+		w.Header().Set("Content-Encoding", encoding)
+	}
+
+	var out io.Writer = w
+	if s.cutAfter != 0 {
+		out = &cutWriter{w: w, limit: s.cutAfter}
+	}
+
+	enc, err := artifact.NewEncoder(encoding, out)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if err := artifact.Stream(path, enc, offset, limit); err != nil {
+		panic(http.ErrAbortHandler)
+	}
+	_ = enc.Close()
+}
+
+var testArtifact = build.ID{'x'}
+
+func newTestServer(t *testing.T) (*testServer, []byte) {
+	return newTestServerSeed(t, 0)
+}
+
+// newTestServerSeed создаёт сервер с артефактом testArtifact, содержимое которого зависит от seed,
+// а длина потока - нет.
+func newTestServerSeed(t *testing.T, seed int64) (*testServer, []byte) {
+	c := newTestCache(t)
+
+	path, commit, _, err := c.Create(testArtifact)
+	require.NoError(t, err)
+
+	data := make([]byte, 64<<10)
+	_, _ = rand.New(rand.NewSource(seed)).Read(data)
+
+	require.NoError(t, os.Mkdir(filepath.Join(path, "bin"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(path, "bin", "tool"), []byte("#!/bin/sh\n"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(path, "data"), data, 0644))
+	require.NoError(t, commit())
+
+	return &testServer{cache: c.Cache}, data
+}
+
+func checkArtifact(t *testing.T, c *artifact.Cache, data []byte) {
+	path, unlock, err := c.Get(testArtifact)
+	require.NoError(t, err)
+	defer unlock()
+
+	got, err := os.ReadFile(filepath.Join(path, "data"))
+	require.NoError(t, err)
+	require.True(t, bytes.Equal(data, got))
+
+	st, err := os.Stat(filepath.Join(path, "bin", "tool"))
+	require.NoError(t, err)
+	require.NotZero(t, st.Mode()&0100)
+}
+
+func TestFetch(t *testing.T) {
+	s, data := newTestServer(t)
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	local := newTestCache(t)
+	require.NoError(t, artifact.Fetch(context.Background(), local.Cache, testArtifact, server.URL))
+
+	checkArtifact(t, local.Cache, data)
+	require.Equal(t, []string{"zstd"}, s.encodings)
+}
+
+func TestFetchGzip(t *testing.T) {
+	s, data := newTestServer(t)
+	s.encoding = "gzip"
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	local := newTestCache(t)
+	require.NoError(t, artifact.Fetch(context.Background(), local.Cache, testArtifact, server.URL))
+	checkArtifact(t, local.Cache, data)
+}
+
+func TestFetchParallel(t *testing.T) {
+	first, data := newTestServer(t)
+	servers := []*testServer{first, {cache: first.cache}, {cache: first.cache}}
+
+	var endpoints []string
+	for _, s := range servers {
+		server := httptest.NewServer(s)
+		defer server.Close()
+		endpoints = append(endpoints, server.URL)
+	}
+
+	local := newTestCache(t)
+	f := artifact.Fetcher{PartSize: 16 << 10}
+	require.NoError(t, f.Fetch(context.Background(), local.Cache, testArtifact, endpoints...))
+	checkArtifact(t, local.Cache, data)
+
+	require.Equal(t, []int64{0, 16 << 10}, first.offsets)
+	for _, s := range servers[1:] {
+		require.Len(t, s.offsets, 1, "every worker serves its own part")
+		require.Greater(t, s.offsets[0], int64(16<<10))
+	}
+}
+
+func TestFetchRestart(t *testing.T) {
+	good, data := newTestServer(t)
+
+	hash, err := good.cache.Hash(testArtifact)
+	require.NoError(t, err)
+
+	// Второй воркер отдаёт другое содержимое под тем же хешем.
+	bad, _ := newTestServerSeed(t, 1)
+	bad.hash = &hash
+
+	goodServer := httptest.NewServer(good)
+	defer goodServer.Close()
+	badServer := httptest.NewServer(bad)
+	defer badServer.Close()
+
+	local := newTestCache(t)
+	f := artifact.Fetcher{PartSize: 16 << 10}
+	require.NoError(t, f.Fetch(context.Background(), local.Cache, testArtifact, goodServer.URL, badServer.URL))
+	checkArtifact(t, local.Cache, data)
+
+	require.Len(t, bad.offsets, 1)
+	require.Equal(t, []int64{0, 16 << 10, 0}, good.offsets, "download restarts from zero on a single worker")
+}
+
+func TestFetchResume(t *testing.T) {
+	broken, data := newTestServer(t)
+	broken.encoding = artifact.Identity
+	broken.cutAfter = 10000
+
+	healthy := &testServer{cache: broken.cache}
+
+	missing := httptest.NewServer(&testServer{cache: newTestCache(t).Cache})
+	defer missing.Close()
+	brokenServer := httptest.NewServer(broken)
+	defer brokenServer.Close()
+	healthyServer := httptest.NewServer(healthy)
+	defer healthyServer.Close()
+
+	local := newTestCache(t)
+	err := artifact.Fetch(context.Background(), local.Cache, testArtifact, missing.URL, brokenServer.URL, healthyServer.URL)
+	require.NoError(t, err)
+
+	checkArtifact(t, local.Cache, data)
+
+	require.Equal(t, []int64{0}, broken.offsets)
+	require.Len(t, healthy.offsets, 1)
+	require.Greater(t, healthy.offsets[0], int64(0), "download must continue from the received offset")
+}
+
+func TestFetchCorrupted(t *testing.T) {
+	s, _ := newTestServer(t)
+	s.hash = &build.ID{'b', 'a', 'd'}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	local := newTestCache(t)
+	err := artifact.Fetch(context.Background(), local.Cache, testArtifact, server.URL)
+	require.Truef(t, errors.Is(err, artifact.ErrCorrupted), "%v", err)
+
+	_, _, err = local.Get(testArtifact)
+	require.Truef(t, errors.Is(err, artifact.ErrNotFound), "%v", err)
+
+	_, _, abort, err := local.Create(testArtifact)
+	require.NoError(t, err, "failed download must release write lock")
+	require.NoError(t, abort())
+}
+
+func TestFetchAllFailed(t *testing.T) {
+	server := httptest.NewServer(&testServer{cache: newTestCache(t).Cache})
+	defer server.Close()
+
+	local := newTestCache(t)
+	err := artifact.Fetch(context.Background(), local.Cache, testArtifact, server.URL)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "404")
+}
+
+func TestFetcherClient(t *testing.T) {
+	tokens := auth.NewTokens()
+	tokens.Add("worker-token", auth.Identity{Name: "w", Role: auth.RoleWorker})
+
+	s, data := newTestServer(t)
+	server := httptest.NewServer(auth.CheckAuth(tokens)(s))
+	defer server.Close()
+
+	local := newTestCache(t)
+	err := artifact.Fetch(context.Background(), local.Cache, testArtifact, server.URL)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "401")
+
+	f := artifact.Fetcher{Client: auth.Credentials{Token: "worker-token"}.HTTPClient(server.URL)}
+	require.NoError(t, f.Fetch(context.Background(), local.Cache, testArtifact, server.URL))
+	checkArtifact(t, local.Cache, data)
+}
+
+func TestHashIgnoresPermissions(t *testing.T) {
+	a, b := t.TempDir(), t.TempDir()
+
+	require.NoError(t, os.WriteFile(filepath.Join(a, "f"), []byte("x"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(b, "f"), []byte("x"), 0600))
+
+	ha, err := artifact.Hash(a)
+	require.NoError(t, err)
+	hb, err := artifact.Hash(b)
+	require.NoError(t, err)
+	require.Equal(t, ha, hb)
+
+	require.NoError(t, os.Chmod(filepath.Join(b, "f"), 0700))
+	hb, err = artifact.Hash(b)
+	require.NoError(t, err)
+	require.NotEqual(t, ha, hb, "exec bit is a part of the artifact")
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	require.Equal(t, "gzip", artifact.NegotiateEncoding("br, gzip;q=0.5, identity"))
+	require.Equal(t, "zstd", artifact.NegotiateEncoding("zstd, gzip"))
+	require.Equal(t, artifact.Identity, artifact.NegotiateEncoding("br"))
+	require.Equal(t, artifact.Identity, artifact.NegotiateEncoding(""))
+	require.Equal(t, "zstd, gzip, identity", artifact.AcceptEncoding())
+}
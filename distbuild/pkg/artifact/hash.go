@@ -0,0 +1,103 @@
+package artifact
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// Hash вычисляет хеш содержимого директории.
+//
+// Хеш зависит от имён, типов и содержимого файлов, целей симлинков и бита исполнения.
+// Остальные права доступа, владелец и время модификации не учитываются, поэтому одинаковые
+// артефакты на разных воркерах имеют одинаковый хеш.
+func Hash(dir string) (build.ID, error) {
+	h := sha1.New()
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		if rel == "." {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case info.IsDir():
+			_, err = fmt.Fprintf(h, "d %q\n", filepath.ToSlash(rel))
+			return err
+
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			_, err = fmt.Fprintf(h, "l %q %q\n", filepath.ToSlash(rel), target)
+			return err
+
+		case info.Mode().IsRegular():
+			f, err := os.Open(path)
+			if err != nil {
+				return err
+			}
+			defer f.Close()
+
+			content := sha1.New()
+			if _, err := io.Copy(content, f); err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintf(h, "f %q %t %d %x\n", filepath.ToSlash(rel), info.Mode()&0111 != 0, info.Size(), content.Sum(nil))
+			return err
+
+		default:
+			return fmt.Errorf("%s: unsupported file type %s", rel, info.Mode().Type())
+		}
+	})
+	if err != nil {
+		return build.ID{}, err
+	}
+
+	return build.ID(h.Sum(nil)), nil
+}
+
+// Hash возвращает Hash директории артефакта. Результат запоминается до удаления артефакта.
+func (c *Cache) Hash(artifact build.ID) (build.ID, error) {
+	c.mu.Lock()
+	h, ok := c.hashes[artifact]
+	c.mu.Unlock()
+
+	if ok {
+		return h, nil
+	}
+
+	path, unlock, err := c.Get(artifact)
+	if err != nil {
+		return build.ID{}, err
+	}
+	defer unlock()
+
+	if h, err = Hash(path); err != nil {
+		return build.ID{}, err
+	}
+
+	c.mu.Lock()
+	c.hashes[artifact] = h
+	c.mu.Unlock()
+	return h, nil
+}
@@ -0,0 +1,166 @@
+package artifact
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// PruneOutputs оставляет в выходной директории джоба dir только пути из outputs (build.Job.Outputs)
+// и удаляет всё остальное.
+//
+// PruneOutputs возвращает ошибку и ничего не удаляет, если какого-то из outputs нет в dir.
+// Пустой outputs означает, что артефактом является вся директория.
+func PruneOutputs(dir string, outputs []string) error {
+	if len(outputs) == 0 {
+		return nil
+	}
+
+	keep := map[string]bool{}
+	parents := map[string]bool{}
+	for _, out := range outputs {
+		if !fs.ValidPath(out) || out == "." {
+			return fmt.Errorf("invalid output %q", out)
+		}
+
+		if _, err := os.Lstat(filepath.Join(dir, filepath.FromSlash(out))); err != nil {
+			return fmt.Errorf("output %q is missing: %w", out, err)
+		}
+
+		keep[out] = true
+		for p := path.Dir(out); p != "."; p = path.Dir(p) {
+			parents[p] = true
+		}
+	}
+
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+
+		rel, err := filepath.Rel(dir, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		switch {
+		case rel == "." || parents[rel]:
+			return nil
+		case keep[rel]:
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if err := os.RemoveAll(p); err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// FetchOutputs скачивает выходы так же, как Fetcher.FetchOutputs, используя http.DefaultClient.
+func FetchOutputs(ctx context.Context, dst string, artifactID build.ID, outputs []string, endpoints ...string) error {
+	return Fetcher{}.FetchOutputs(ctx, dst, artifactID, outputs, endpoints...)
+}
+
+// FetchOutputs скачивает артефакт с endpoints так же, как Fetch, и переносит пути outputs из артефакта в dst.
+//
+// Пустой outputs означает всё содержимое артефакта. Существующие в dst пути заменяются, как при go build -o:
+// файл заменяется атомарно через os.Rename, а директория сначала переносится во временную директорию
+// и удаляется после переноса нового выхода. Клиент использует FetchOutputs, чтобы скачать выходы сборки
+// в локальную директорию.
+func (f Fetcher) FetchOutputs(ctx context.Context, dst string, artifactID build.ID, outputs []string, endpoints ...string) error {
+	if err := os.MkdirAll(dst, 0777); err != nil {
+		return err
+	}
+
+	// Временный кеш лежит внутри dst, чтобы выходы можно было перенести через os.Rename.
+	tmp, err := os.MkdirTemp(dst, ".distbuild-")
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.RemoveAll(tmp) }()
+
+	c, err := NewCache(tmp)
+	if err != nil {
+		return err
+	}
+
+	if err := f.Fetch(ctx, c, artifactID, endpoints...); err != nil {
+		return err
+	}
+
+	dir, unlock, err := c.Get(artifactID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if len(outputs) == 0 {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			return err
+		}
+
+		for _, e := range entries {
+			outputs = append(outputs, e.Name())
+		}
+	}
+
+	for i, out := range outputs {
+		if !fs.ValidPath(out) || out == "." {
+			return fmt.Errorf("invalid output %q", out)
+		}
+
+		from := filepath.Join(dir, filepath.FromSlash(out))
+		to := filepath.Join(dst, filepath.FromSlash(out))
+
+		if err := os.MkdirAll(filepath.Dir(to), 0777); err != nil {
+			return err
+		}
+
+		if err := moveAside(from, to, filepath.Join(tmp, "old-"+strconv.Itoa(i))); err != nil {
+			return fmt.Errorf("output %q: %w", out, err)
+		}
+
+		if err := os.Rename(from, to); err != nil {
+			return fmt.Errorf("output %q: %w", out, err)
+		}
+	}
+
+	return nil
+}
+
+// moveAside переносит существующий путь to в old, если os.Rename(from, to) не сможет его заменить:
+// rename заменяет только файл файлом.
+func moveAside(from, to, old string) error {
+	toInfo, err := os.Lstat(to)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	fromInfo, err := os.Lstat(from)
+	if err != nil {
+		return err
+	}
+
+	if !toInfo.IsDir() && !fromInfo.IsDir() {
+		return nil
+	}
+	return os.Rename(to, old)
+}
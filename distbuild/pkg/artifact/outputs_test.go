@@ -0,0 +1,80 @@
+package artifact_test
+
+import (
+	"context"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+)
+
+func listFiles(t *testing.T, dir string) []string {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		require.NoError(t, err)
+
+		rel, err := filepath.Rel(dir, path)
+		require.NoError(t, err)
+		if rel != "." {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	sort.Strings(files)
+	return files
+}
+
+func TestPruneOutputs(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"bin/app", "bin/app.o", "lib/a/x", "lib/a/y", "importcfg"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, filepath.Dir(name)), 0777))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0666))
+	}
+
+	require.Error(t, artifact.PruneOutputs(dir, []string{"bin/app", "missing"}))
+	require.Len(t, listFiles(t, dir), 8, "failed call must not remove anything")
+
+	require.Error(t, artifact.PruneOutputs(dir, []string{"../bin"}))
+
+	require.NoError(t, artifact.PruneOutputs(dir, []string{"bin/app", "lib/a"}))
+	require.Equal(t, []string{"bin", "bin/app", "lib", "lib/a", "lib/a/x", "lib/a/y"}, listFiles(t, dir))
+
+	require.NoError(t, artifact.PruneOutputs(dir, nil))
+	require.Len(t, listFiles(t, dir), 6)
+}
+
+func TestFetchOutputs(t *testing.T) {
+	s, data := newTestServer(t)
+	ts := httptest.NewServer(s)
+	defer ts.Close()
+	server := ts.URL
+
+	dst := t.TempDir()
+	require.NoError(t, artifact.FetchOutputs(context.Background(), dst, testArtifact, []string{"bin/tool"}, server))
+	require.Equal(t, []string{"bin", "bin/tool"}, listFiles(t, dst))
+
+	// Существующие выходы заменяются, как при go build -o.
+	require.NoError(t, os.WriteFile(filepath.Join(dst, "bin", "tool"), []byte("old"), 0755))
+	require.NoError(t, artifact.FetchOutputs(context.Background(), dst, testArtifact, []string{"bin/tool"}, server))
+
+	tool, err := os.ReadFile(filepath.Join(dst, "bin", "tool"))
+	require.NoError(t, err)
+	require.Equal(t, "#!/bin/sh\n", string(tool))
+
+	all := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(all, "bin", "stale"), 0777))
+	require.NoError(t, os.Mkdir(filepath.Join(all, "data"), 0777))
+	require.NoError(t, artifact.FetchOutputs(context.Background(), all, testArtifact, nil, server))
+	require.Equal(t, []string{"bin", "bin/tool", "data"}, listFiles(t, all))
+
+	got, err := os.ReadFile(filepath.Join(all, "data"))
+	require.NoError(t, err)
+	require.Equal(t, data, got)
+}
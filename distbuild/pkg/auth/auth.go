@@ -0,0 +1,177 @@
+package auth
+
+import (
+	"context"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+)
+
+// Role определяет, к каким endpoint-ам координатора и воркеров есть доступ.
+type Role string
+
+const (
+	// RoleClient запускает сборки и скачивает их выходы.
+	RoleClient Role = "client"
+
+	// RoleWorker присылает heartbeat-ы и скачивает файлы и артефакты.
+	RoleWorker Role = "worker"
+)
+
+var (
+	// ErrInvalidToken возвращается из TokenChecker.CheckToken, если токен неизвестен.
+	ErrInvalidToken = errors.New("invalid token")
+
+	// ErrForbidden возвращается, если у Identity нет прав на действие.
+	ErrForbidden = errors.New("forbidden")
+)
+
+// Identity описывает того, кто прислал запрос.
+type Identity struct {
+	// Name - имя пользователя для RoleClient. Для RoleWorker это api.WorkerID, который воркеру
+	// разрешено присылать в heartbeat-ах.
+	Name string
+	Role Role
+}
+
+func (id *Identity) String() string {
+	return fmt.Sprintf("%s %s", id.Role, id.Name)
+}
+
+// CheckWorker проверяет, что запрос прислал воркер workerID.
+//
+// Координатор вызывает CheckWorker на каждый heartbeat, поэтому воркер не может выдать себя за другого.
+func (id *Identity) CheckWorker(workerID api.WorkerID) error {
+	if id.Role != RoleWorker {
+		return fmt.Errorf("%w: %s is not a worker", ErrForbidden, id)
+	}
+	if id.Name != workerID.String() {
+		return fmt.Errorf("%w: %s cannot send heartbeats as %s", ErrForbidden, id, workerID)
+	}
+	return nil
+}
+
+// TokenChecker проверяет bearer токен и возвращает его владельца.
+//
+// Если токен неизвестен, CheckToken возвращает ошибку, обёрнутую вокруг ErrInvalidToken.
+// Любая другая ошибка означает, что токен проверить не удалось.
+type TokenChecker interface {
+	CheckToken(ctx context.Context, token string) (*Identity, error)
+}
+
+type contextKey struct{}
+
+// WithIdentity возвращает контекст, из которого ContextIdentity достанет id.
+func WithIdentity(ctx context.Context, id *Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// ContextIdentity возвращает Identity, которую CheckAuth или интерсепторы gRPC положили в контекст запроса.
+func ContextIdentity(ctx context.Context) (*Identity, bool) {
+	id, ok := ctx.Value(contextKey{}).(*Identity)
+	return id, ok
+}
+
+// CertIdentity строит Identity по клиентскому сертификату.
+//
+// Имя берётся из первого URI в SAN сертификата, а если их нет - из CommonName.
+// Роль берётся из OrganizationalUnit.
+func CertIdentity(cert *x509.Certificate) (*Identity, error) {
+	id := &Identity{Name: cert.Subject.CommonName}
+	if len(cert.URIs) != 0 {
+		id.Name = cert.URIs[0].String()
+	}
+
+	for _, ou := range cert.Subject.OrganizationalUnit {
+		switch Role(ou) {
+		case RoleClient, RoleWorker:
+			id.Role = Role(ou)
+		}
+	}
+
+	if id.Name == "" || id.Role == "" {
+		return nil, fmt.Errorf("%w: certificate %q has no name or role", ErrInvalidToken, cert.Subject)
+	}
+	return id, nil
+}
+
+func bearerToken(header string) (string, error) {
+	if header == "" {
+		return "", errors.New("authorization token is missing")
+	}
+
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		return "", errors.New("invalid token format")
+	}
+	return token, nil
+}
+
+// authenticate проверяет клиентский сертификат, проверенный TLS, а если его нет - bearer токен.
+func authenticate(ctx context.Context, checker TokenChecker, chains [][]*x509.Certificate, header string) (*Identity, error) {
+	if len(chains) != 0 && len(chains[0]) != 0 {
+		return CertIdentity(chains[0][0])
+	}
+
+	token, err := bearerToken(header)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+
+	return checker.CheckToken(ctx, token)
+}
+
+// CheckAuth возвращает middleware, которая пропускает только запросы с проверенным клиентским
+// сертификатом или заголовком "Authorization: Bearer TOKEN" с валидным токеном.
+//
+// Неаутентифицированные запросы получают http.StatusUnauthorized, ошибки проверки токена -
+// http.StatusInternalServerError. Identity доступна следующим handler-ам через ContextIdentity.
+func CheckAuth(checker TokenChecker) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var chains [][]*x509.Certificate
+			if r.TLS != nil {
+				chains = r.TLS.VerifiedChains
+			}
+
+			id, err := authenticate(r.Context(), checker, chains, r.Header.Get("Authorization"))
+			switch {
+			case errors.Is(err, ErrInvalidToken):
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			case err != nil:
+				http.Error(w, "token check failed", http.StatusInternalServerError)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithIdentity(r.Context(), id)))
+		})
+	}
+}
+
+// RequireRole возвращает middleware, которая пропускает только запросы от Identity с одной из ролей roles.
+// Её нужно ставить после CheckAuth. Остальные запросы получают http.StatusForbidden.
+func RequireRole(roles ...Role) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id, ok := ContextIdentity(r.Context())
+			if !ok {
+				http.Error(w, "unauthenticated", http.StatusUnauthorized)
+				return
+			}
+
+			for _, role := range roles {
+				if id.Role == role {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+
+			http.Error(w, fmt.Sprintf("%v: %s", ErrForbidden, id), http.StatusForbidden)
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package auth_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+)
+
+const testTokens = `
+# test tokens
+client alice  alice-token
+worker http://127.0.0.1:8081 worker-token
+`
+
+func whoami(w http.ResponseWriter, r *http.Request) {
+	id, _ := auth.ContextIdentity(r.Context())
+	_, _ = fmt.Fprint(w, id)
+}
+
+type brokenChecker struct{}
+
+func (brokenChecker) CheckToken(ctx context.Context, token string) (*auth.Identity, error) {
+	return nil, errors.New("database is down")
+}
+
+func get(t *testing.T, client *http.Client, url string) (int, string) {
+	rsp, err := client.Get(url)
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+	return rsp.StatusCode, strings.TrimSpace(string(body))
+}
+
+func TestCheckAuth(t *testing.T) {
+	tokens, err := auth.ParseTokens(strings.NewReader(testTokens))
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle("/any", http.HandlerFunc(whoami))
+	mux.Handle("/worker", auth.RequireRole(auth.RoleWorker)(http.HandlerFunc(whoami)))
+
+	server := httptest.NewServer(auth.CheckAuth(tokens)(mux))
+	defer server.Close()
+
+	alice := auth.Credentials{Token: "alice-token"}.HTTPClient(server.URL)
+	worker := auth.Credentials{Token: "worker-token"}.HTTPClient(server.URL)
+
+	code, body := get(t, alice, server.URL+"/any")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "client alice", body)
+
+	code, _ = get(t, alice, server.URL+"/worker")
+	require.Equal(t, http.StatusForbidden, code)
+
+	code, body = get(t, worker, server.URL+"/worker")
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "worker http://127.0.0.1:8081", body)
+
+	code, _ = get(t, http.DefaultClient, server.URL+"/any")
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = get(t, auth.Credentials{Token: "alice-token-2"}.HTTPClient(server.URL), server.URL+"/any")
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	broken := httptest.NewServer(auth.CheckAuth(brokenChecker{})(mux))
+	defer broken.Close()
+
+	code, _ = get(t, alice, broken.URL+"/any")
+	require.Equal(t, http.StatusUnauthorized, code)
+
+	code, _ = get(t, auth.Credentials{Token: "alice-token"}.HTTPClient(broken.URL), broken.URL+"/any")
+	require.Equal(t, http.StatusInternalServerError, code)
+}
+
+func TestTokenIsSentOnlyToEndpoint(t *testing.T) {
+	var headers []string
+	peer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		headers = append(headers, r.Header.Get("Authorization"))
+	}))
+	defer peer.Close()
+
+	creds := auth.Credentials{Token: "worker-token"}
+
+	code, _ := get(t, creds.HTTPClient(peer.URL), peer.URL+"/heartbeat")
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = get(t, creds.HTTPClient("http://coordinator:8080"), peer.URL+"/artifact")
+	require.Equal(t, http.StatusOK, code)
+
+	code, _ = get(t, creds.PeerHTTPClient(), peer.URL+"/artifact")
+	require.Equal(t, http.StatusOK, code)
+
+	require.Equal(t, []string{"Bearer worker-token", "", ""}, headers)
+
+	require.True(t, creds.RequireTransportSecurity())
+	require.False(t, auth.Credentials{}.RequireTransportSecurity())
+}
+
+func TestParseTokensErrors(t *testing.T) {
+	_, err := auth.ParseTokens(strings.NewReader("admin bob token"))
+	require.Error(t, err)
+
+	_, err = auth.ParseTokens(strings.NewReader("client bob"))
+	require.Error(t, err)
+}
+
+func TestCheckWorker(t *testing.T) {
+	worker := &auth.Identity{Name: "http://127.0.0.1:8081", Role: auth.RoleWorker}
+	require.NoError(t, worker.CheckWorker(api.WorkerID("http://127.0.0.1:8081")))
+	require.ErrorIs(t, worker.CheckWorker(api.WorkerID("http://127.0.0.1:8082")), auth.ErrForbidden)
+
+	client := &auth.Identity{Name: "http://127.0.0.1:8081", Role: auth.RoleClient}
+	require.ErrorIs(t, client.CheckWorker(api.WorkerID("http://127.0.0.1:8081")), auth.ErrForbidden)
+}
+
+type testCA struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pool *x509.CertPool
+}
+
+func newTestCA(t *testing.T) *testCA {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "distbuild test ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	cert, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return &testCA{cert: cert, key: key, pool: pool}
+}
+
+func (ca *testCA) issue(t *testing.T, template *x509.Certificate) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	template.SerialNumber = big.NewInt(time.Now().UnixNano())
+	template.NotBefore = time.Now().Add(-time.Hour)
+	template.NotAfter = time.Now().Add(time.Hour)
+
+	der, err := x509.CreateCertificate(rand.Reader, template, ca.cert, &key.PublicKey, ca.key)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestMutualTLS(t *testing.T) {
+	ca := newTestCA(t)
+	tokens, err := auth.ParseTokens(strings.NewReader(testTokens))
+	require.NoError(t, err)
+
+	server := httptest.NewUnstartedServer(auth.CheckAuth(tokens)(http.HandlerFunc(whoami)))
+	server.TLS = &tls.Config{
+		ClientCAs:  ca.pool,
+		ClientAuth: tls.VerifyClientCertIfGiven,
+	}
+	server.StartTLS()
+	defer server.Close()
+
+	roots := server.Client().Transport.(*http.Transport).TLSClientConfig.RootCAs
+
+	workerURL, _ := url.Parse("http://10.0.0.5:8081")
+	workerCert := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "worker5", OrganizationalUnit: []string{"worker"}},
+		URIs:        []*url.URL{workerURL},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+
+	worker := auth.Credentials{TLS: &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{workerCert}}}
+	code, body := get(t, worker.PeerHTTPClient(), server.URL)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "worker http://10.0.0.5:8081", body)
+
+	// Без сертификата работает токен.
+	alice := auth.Credentials{Token: "alice-token", TLS: &tls.Config{RootCAs: roots}}
+	code, body = get(t, alice.HTTPClient(server.URL), server.URL)
+	require.Equal(t, http.StatusOK, code)
+	require.Equal(t, "client alice", body)
+
+	// Сертификат без роли не даёт доступа.
+	noRole := ca.issue(t, &x509.Certificate{
+		Subject:     pkix.Name{CommonName: "bob"},
+		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	})
+	bob := auth.Credentials{TLS: &tls.Config{RootCAs: roots, Certificates: []tls.Certificate{noRole}}}
+	code, _ = get(t, bob.PeerHTTPClient(), server.URL)
+	require.Equal(t, http.StatusUnauthorized, code)
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	tokens, err := auth.ParseTokens(strings.NewReader(testTokens))
+	require.NoError(t, err)
+
+	intercept := auth.UnaryServerInterceptor(tokens)
+	handler := func(ctx context.Context, req any) (any, error) {
+		id, _ := auth.ContextIdentity(ctx)
+		return id.String(), nil
+	}
+
+	md, err := auth.Credentials{Token: "worker-token"}.GetRequestMetadata(context.Background())
+	require.NoError(t, err)
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.New(md))
+	rsp, err := intercept(ctx, nil, &grpc.UnaryServerInfo{}, handler)
+	require.NoError(t, err)
+	require.Equal(t, "worker http://127.0.0.1:8081", rsp)
+
+	_, err = intercept(context.Background(), nil, &grpc.UnaryServerInfo{}, handler)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
@@ -0,0 +1,172 @@
+package auth
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// Credentials - то, чем клиент или воркер подтверждает свою личность.
+type Credentials struct {
+	// Token отправляется в заголовке "Authorization: Bearer TOKEN".
+	Token string
+
+	// TLS используется для https:// endpoint-ов. Если в TLS есть Certificates, клиентский
+	// сертификат заменяет токен. Перед воркерами клиентский сертификат - единственный способ
+	// подтвердить личность, см. PeerHTTPClient.
+	TLS *tls.Config
+}
+
+type bearerTransport struct {
+	token string
+	host  string
+	base  http.RoundTripper
+}
+
+func (t *bearerTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	// Токен не отправляется на другие адреса, в том числе после редиректа.
+	if r.URL.Scheme+"://"+r.URL.Host != t.host {
+		return t.base.RoundTrip(r)
+	}
+
+	r = r.Clone(r.Context())
+	r.Header.Set("Authorization", "Bearer "+t.token)
+	return t.base.RoundTrip(r)
+}
+
+func (c Credentials) transport() *http.Transport {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = c.TLS
+	return transport
+}
+
+// HTTPClient возвращает http.Client для запросов к координатору endpoint.
+//
+// Токен добавляется только к запросам с той же схемой и адресом, что у endpoint, иначе
+// воркер, к которому обратились с этим клиентом, смог бы повторить токен от чужого имени.
+// Для нулевых Credentials возвращается http.DefaultClient.
+func (c Credentials) HTTPClient(endpoint string) *http.Client {
+	if c.Token == "" && c.TLS == nil {
+		return http.DefaultClient
+	}
+
+	transport := c.transport()
+	if c.Token == "" {
+		return &http.Client{Transport: transport}
+	}
+
+	host := endpoint
+	if u, err := url.Parse(endpoint); err == nil {
+		host = u.Scheme + "://" + u.Host
+	}
+	return &http.Client{Transport: &bearerTransport{token: c.Token, host: host, base: transport}}
+}
+
+// PeerHTTPClient возвращает http.Client для запросов к воркерам.
+//
+// Токен воркерам никогда не отправляется: воркеры и клиенты подтверждают свою личность
+// перед другими воркерами только клиентским сертификатом из TLS.
+func (c Credentials) PeerHTTPClient() *http.Client {
+	if c.TLS == nil {
+		return http.DefaultClient
+	}
+	return &http.Client{Transport: c.transport()}
+}
+
+// GetRequestMetadata и RequireTransportSecurity реализуют credentials.PerRPCCredentials из gRPC,
+// поэтому Credentials можно передать в grpc.WithPerRPCCredentials.
+func (c Credentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	if c.Token == "" {
+		return nil, nil
+	}
+	return map[string]string{"authorization": "Bearer " + c.Token}, nil
+}
+
+// RequireTransportSecurity запрещает gRPC отправлять токен по соединению без TLS.
+func (c Credentials) RequireTransportSecurity() bool {
+	return c.Token != ""
+}
+
+// LoadToken читает токен из файла, пропуская пробелы в начале и в конце.
+func LoadToken(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	token := strings.TrimSpace(string(b))
+	if token == "" {
+		return "", fmt.Errorf("%s: empty token", path)
+	}
+	return token, nil
+}
+
+func loadPool(caFile string) (*x509.CertPool, error) {
+	pem, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, err
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, fmt.Errorf("%s: no certificates found", caFile)
+	}
+	return pool, nil
+}
+
+// ServerTLS загружает сертификат сервера и CA, которым подписаны клиентские сертификаты.
+//
+// Клиентский сертификат не обязателен, чтобы клиенты с токенами тоже могли подключиться.
+// Но если сертификат прислан, он должен быть подписан caFile.
+func ServerTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	config := &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		if config.ClientCAs, err = loadPool(caFile); err != nil {
+			return nil, err
+		}
+		config.ClientAuth = tls.VerifyClientCertIfGiven
+	}
+
+	return config, nil
+}
+
+// ClientTLS загружает CA, которым подписан сертификат сервера, и, если заданы certFile и keyFile,
+// клиентский сертификат.
+func ClientTLS(certFile, keyFile, caFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+
+	if caFile != "" {
+		var err error
+		if config.RootCAs, err = loadPool(caFile); err != nil {
+			return nil, err
+		}
+	}
+
+	switch {
+	case certFile != "" && keyFile != "":
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, err
+		}
+		config.Certificates = []tls.Certificate{cert}
+	case certFile != "" || keyFile != "":
+		return nil, errors.New("both certificate and key are required")
+	}
+
+	return config, nil
+}
@@ -0,0 +1,91 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// ErrQuotaExceeded возвращается из Quotas.Acquire, если новая сборка превышает квоту пользователя.
+var ErrQuotaExceeded = errors.New("quota exceeded")
+
+// Quota ограничивает сборки одного пользователя. Нулевое значение поля означает отсутствие ограничения.
+type Quota struct {
+	// Builds ограничивает число одновременно идущих сборок.
+	Builds int
+
+	// Jobs ограничивает суммарное число джобов в одновременно идущих сборках.
+	Jobs int
+}
+
+type usage struct {
+	builds, jobs int
+}
+
+// Quotas учитывает, сколько ресурсов координатора занимает каждый пользователь.
+//
+// Все методы Quotas безопасно вызывать из нескольких горутин.
+type Quotas struct {
+	defaults Quota
+	users    map[string]Quota
+
+	mu    sync.Mutex
+	usage map[string]*usage
+}
+
+// NewQuotas создаёт Quotas, в которых пользователи из users получают свою квоту, а остальные - defaults.
+func NewQuotas(defaults Quota, users map[string]Quota) *Quotas {
+	return &Quotas{
+		defaults: defaults,
+		users:    users,
+		usage:    map[string]*usage{},
+	}
+}
+
+func (q *Quotas) quota(user string) Quota {
+	if quota, ok := q.users[user]; ok {
+		return quota
+	}
+	return q.defaults
+}
+
+// Acquire резервирует квоту под сборку пользователя user из jobs джобов.
+//
+// Если сборка не помещается в квоту, Acquire возвращает ошибку, обёрнутую вокруг ErrQuotaExceeded.
+// Иначе возвращается функция, которую нужно вызвать по завершении сборки. Повторные вызовы release ничего не делают.
+func (q *Quotas) Acquire(user string, jobs int) (release func(), err error) {
+	quota := q.quota(user)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	u, ok := q.usage[user]
+	if !ok {
+		u = &usage{}
+	}
+
+	switch {
+	case quota.Builds != 0 && u.builds+1 > quota.Builds:
+		return nil, fmt.Errorf("%w: user %s already runs %d builds", ErrQuotaExceeded, user, u.builds)
+	case quota.Jobs != 0 && u.jobs+jobs > quota.Jobs:
+		return nil, fmt.Errorf("%w: user %s runs %d jobs, build with %d more jobs exceeds limit %d", ErrQuotaExceeded, user, u.jobs, jobs, quota.Jobs)
+	}
+
+	u.builds++
+	u.jobs += jobs
+	q.usage[user] = u
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			q.mu.Lock()
+			defer q.mu.Unlock()
+
+			u.builds--
+			u.jobs -= jobs
+			if u.builds == 0 {
+				delete(q.usage, user)
+			}
+		})
+	}, nil
+}
@@ -0,0 +1,37 @@
+package auth_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+)
+
+func TestQuotas(t *testing.T) {
+	q := auth.NewQuotas(auth.Quota{Builds: 1, Jobs: 100}, map[string]auth.Quota{
+		"ci": {Builds: 2},
+	})
+
+	release, err := q.Acquire("alice", 10)
+	require.NoError(t, err)
+
+	_, err = q.Acquire("alice", 10)
+	require.ErrorIs(t, err, auth.ErrQuotaExceeded, "second concurrent build")
+
+	_, err = q.Acquire("bob", 101)
+	require.ErrorIs(t, err, auth.ErrQuotaExceeded, "too many jobs")
+
+	release()
+	release()
+
+	_, err = q.Acquire("alice", 100)
+	require.NoError(t, err)
+
+	_, err = q.Acquire("ci", 1000)
+	require.NoError(t, err)
+	_, err = q.Acquire("ci", 1000)
+	require.NoError(t, err)
+	_, err = q.Acquire("ci", 1000)
+	require.ErrorIs(t, err, auth.ErrQuotaExceeded)
+}
@@ -0,0 +1,85 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Tokens - TokenChecker со статическим списком токенов.
+//
+// Токены хранятся только в виде sha256 хешей, поэтому время поиска не зависит от того,
+// насколько присланный токен похож на настоящий.
+type Tokens struct {
+	tokens map[[sha256.Size]byte]*Identity
+}
+
+func NewTokens() *Tokens {
+	return &Tokens{tokens: map[[sha256.Size]byte]*Identity{}}
+}
+
+// Add разрешает доступ с токеном token для id.
+func (t *Tokens) Add(token string, id Identity) {
+	t.tokens[sha256.Sum256([]byte(token))] = &id
+}
+
+func (t *Tokens) CheckToken(ctx context.Context, token string) (*Identity, error) {
+	id, ok := t.tokens[sha256.Sum256([]byte(token))]
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	cp := *id
+	return &cp, nil
+}
+
+// ParseTokens читает список токенов в формате:
+//
+//	# комментарий
+//	client alice   4f1d...
+//	worker http://10.0.0.5:8081 9a2c...
+//
+// Каждая строка содержит роль, имя и токен.
+func ParseTokens(r io.Reader) (*Tokens, error) {
+	t := NewTokens()
+
+	s := bufio.NewScanner(r)
+	for n := 1; s.Scan(); n++ {
+		line := strings.TrimSpace(s.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("tokens:%d: expected role, name and token", n)
+		}
+
+		role := Role(fields[0])
+		if role != RoleClient && role != RoleWorker {
+			return nil, fmt.Errorf("tokens:%d: unknown role %q", n, fields[0])
+		}
+
+		t.Add(fields[2], Identity{Name: fields[1], Role: role})
+	}
+
+	if err := s.Err(); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// LoadTokens читает список токенов из файла в формате ParseTokens.
+func LoadTokens(path string) (*Tokens, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	return ParseTokens(f)
+}
@@ -29,6 +29,16 @@ type Job struct {
 
 	// Cmds описывает список команд, которые нужно выполнить в рамках этого джоба.
 	Cmds []Cmd
+
+	// Outputs перечисляет именованные выходы джоба - пути к файлам или директориям относительно OutputDir.
+	//
+	// Если Outputs задан, в артефакт джоба попадают только перечисленные пути, остальное содержимое
+	// OutputDir удаляется после выполнения команд. Если Outputs пуст, артефактом становится вся OutputDir.
+	Outputs []string
+
+	// Requirements задаёт ресурсы, которые нужны джобу. Джоб запускается только на воркере,
+	// у которого хватает свободных ресурсов и есть все метки из Requirements.Tags.
+	Requirements Resources
 }
 
 // Cmd описывает одну команду сборки.
@@ -0,0 +1,53 @@
+package build
+
+// Resources описывает ресурсы воркера или требования джоба к ресурсам.
+//
+// Нулевое значение ничего не требует и подходит любому воркеру.
+type Resources struct {
+	// CPU - число ядер.
+	CPU int
+
+	// Memory - объём памяти в байтах.
+	Memory int64
+
+	// Tags - произвольные метки, например race или cgo. Джоб подходит воркеру,
+	// только если у воркера есть все метки, которые требует джоб.
+	Tags []string
+}
+
+// Fits возвращает true, если req помещается в r.
+func (r Resources) Fits(req Resources) bool {
+	if req.CPU > r.CPU || req.Memory > r.Memory {
+		return false
+	}
+
+	for _, tag := range req.Tags {
+		if !r.HasTag(tag) {
+			return false
+		}
+	}
+	return true
+}
+
+func (r Resources) HasTag(tag string) bool {
+	for _, t := range r.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// Sub возвращает r, из CPU и Memory которого вычтены CPU и Memory other. Tags остаются от r.
+func (r Resources) Sub(other Resources) Resources {
+	r.CPU -= other.CPU
+	r.Memory -= other.Memory
+	return r
+}
+
+// Add возвращает r, к CPU и Memory которого прибавлены CPU и Memory other. Tags остаются от r.
+func (r Resources) Add(other Resources) Resources {
+	r.CPU += other.CPU
+	r.Memory += other.Memory
+	return r
+}
@@ -0,0 +1,22 @@
+package build
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourcesFits(t *testing.T) {
+	worker := Resources{CPU: 4, Memory: 8 << 30, Tags: []string{"race", "cgo"}}
+
+	require.True(t, worker.Fits(Resources{}))
+	require.True(t, worker.Fits(Resources{CPU: 4, Memory: 8 << 30, Tags: []string{"cgo"}}))
+	require.False(t, worker.Fits(Resources{CPU: 5}))
+	require.False(t, worker.Fits(Resources{Memory: 9 << 30}))
+	require.False(t, worker.Fits(Resources{Tags: []string{"race", "gpu"}}))
+
+	free := worker.Sub(Resources{CPU: 3, Memory: 1 << 30, Tags: []string{"race"}})
+	require.Equal(t, Resources{CPU: 1, Memory: 7 << 30, Tags: []string{"race", "cgo"}}, free)
+	require.False(t, free.Fits(Resources{CPU: 2}))
+	require.Equal(t, worker, free.Add(Resources{CPU: 3, Memory: 1 << 30}))
+}
@@ -1,6 +1,9 @@
 package build
 
 // TopSort sorts jobs in topological order assuming dependency graph contains no cycles.
+//
+// On invalid graph TopSort still terminates, but the order is unspecified. Use Validate
+// to check the graph first.
 func TopSort(jobs []Job) []Job {
 	var sorted []Job
 	visited := make([]bool, len(jobs))
@@ -18,7 +21,9 @@ func TopSort(jobs []Job) []Job {
 
 		visited[jobIndex] = true
 		for _, dep := range jobs[jobIndex].Deps {
-			visit(jobIDIndex[dep])
+			if i, ok := jobIDIndex[dep]; ok {
+				visit(i)
+			}
 		}
 		sorted = append(sorted, jobs[jobIndex])
 	}
@@ -29,3 +34,21 @@ func TopSort(jobs []Job) []Job {
 
 	return sorted
 }
+
+// TopLevel returns IDs of jobs that no other job depends on, in the order of jobs.
+func TopLevel(jobs []Job) []ID {
+	used := map[ID]bool{}
+	for _, j := range jobs {
+		for _, dep := range j.Deps {
+			used[dep] = true
+		}
+	}
+
+	var top []ID
+	for _, j := range jobs {
+		if !used[j.ID] {
+			top = append(top, j.ID)
+		}
+	}
+	return top
+}
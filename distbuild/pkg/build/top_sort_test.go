@@ -27,3 +27,24 @@ func TestTopSort(t *testing.T) {
 	require.Equal(t, ID{'b'}, sorted[1].ID)
 	require.Equal(t, ID{'a'}, sorted[2].ID)
 }
+
+func TestTopSortInvalidGraph(t *testing.T) {
+	jobs := []Job{
+		{ID: ID{'a'}, Deps: []ID{{'b'}, {'x'}}},
+		{ID: ID{'b'}, Deps: []ID{{'a'}}},
+	}
+
+	sorted := TopSort(jobs)
+	require.Len(t, sorted, 2)
+}
+
+func TestTopLevel(t *testing.T) {
+	jobs := []Job{
+		{ID: ID{'a'}, Deps: []ID{{'c'}}},
+		{ID: ID{'b'}, Deps: []ID{{'c'}}},
+		{ID: ID{'c'}},
+		{ID: ID{'d'}},
+	}
+
+	require.Equal(t, []ID{{'a'}, {'b'}, {'d'}}, TopLevel(jobs))
+}
@@ -0,0 +1,251 @@
+package build
+
+import (
+	"fmt"
+	"io/fs"
+	"path"
+	"strings"
+)
+
+// CycleError reports a dependency cycle. Path starts and ends with the same job.
+type CycleError struct {
+	Path []ID
+}
+
+func (e *CycleError) Error() string {
+	var path []string
+	for _, id := range e.Path {
+		path = append(path, id.String())
+	}
+	return fmt.Sprintf("dependency cycle: %s", strings.Join(path, " -> "))
+}
+
+// DanglingDepError reports a dependency on a job that is not present in the graph.
+type DanglingDepError struct {
+	Job ID
+	Dep ID
+}
+
+func (e *DanglingDepError) Error() string {
+	return fmt.Sprintf("job %s depends on unknown job %s", e.Job, e.Dep)
+}
+
+// DuplicateJobError reports several jobs with the same ID.
+type DuplicateJobError struct {
+	Job ID
+}
+
+func (e *DuplicateJobError) Error() string {
+	return fmt.Sprintf("duplicate job %s", e.Job)
+}
+
+// MissingInputError reports an input file that is not listed in Graph.SourceFiles.
+type MissingInputError struct {
+	Job   ID
+	Input string
+}
+
+func (e *MissingInputError) Error() string {
+	return fmt.Sprintf("job %s: input %q is missing from source files", e.Job, e.Input)
+}
+
+// InvalidOutputError reports an output that is not a local slash-separated path,
+// or is listed twice, or is nested inside another output of the same job.
+type InvalidOutputError struct {
+	Job    ID
+	Output string
+}
+
+func (e *InvalidOutputError) Error() string {
+	return fmt.Sprintf("job %s: invalid output %q", e.Job, e.Output)
+}
+
+// InvalidRequirementsError reports negative resource requirements.
+type InvalidRequirementsError struct {
+	Job          ID
+	Requirements Resources
+}
+
+func (e *InvalidRequirementsError) Error() string {
+	return fmt.Sprintf("job %s: invalid requirements %+v", e.Job, e.Requirements)
+}
+
+// TemplateError reports a command that can't be rendered.
+type TemplateError struct {
+	Job ID
+	Cmd int
+	Err error
+}
+
+func (e *TemplateError) Error() string {
+	return fmt.Sprintf("job %s: cmd #%d: %v", e.Job, e.Cmd, e.Err)
+}
+
+func (e *TemplateError) Unwrap() error {
+	return e.Err
+}
+
+// ValidationError contains all problems found by Validate.
+type ValidationError struct {
+	Errors []error
+}
+
+func (e *ValidationError) Error() string {
+	var msgs []string
+	for _, err := range e.Errors {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("invalid build graph: %s", strings.Join(msgs, "; "))
+}
+
+func (e *ValidationError) Unwrap() []error {
+	return e.Errors
+}
+
+// Validate checks that graph can be scheduled.
+//
+// Returned error is either nil or *ValidationError.
+func Validate(graph Graph) error {
+	var errs []error
+
+	sources := map[string]struct{}{}
+	for _, path := range graph.SourceFiles {
+		sources[path] = struct{}{}
+	}
+
+	jobs := map[ID]*Job{}
+	for i := range graph.Jobs {
+		job := &graph.Jobs[i]
+
+		if _, ok := jobs[job.ID]; ok {
+			errs = append(errs, &DuplicateJobError{Job: job.ID})
+			continue
+		}
+		jobs[job.ID] = job
+	}
+
+	for _, job := range graph.Jobs {
+		for _, dep := range job.Deps {
+			if _, ok := jobs[dep]; !ok {
+				errs = append(errs, &DanglingDepError{Job: job.ID, Dep: dep})
+			}
+		}
+
+		for _, in := range job.Inputs {
+			if _, ok := sources[in]; !ok {
+				errs = append(errs, &MissingInputError{Job: job.ID, Input: in})
+			}
+		}
+
+		errs = append(errs, validateOutputs(&job)...)
+
+		if job.Requirements.CPU < 0 || job.Requirements.Memory < 0 {
+			errs = append(errs, &InvalidRequirementsError{Job: job.ID, Requirements: job.Requirements})
+		}
+
+		ctx := JobContext{SourceDir: "/source", OutputDir: "/output", Deps: map[ID]string{}}
+		for _, dep := range job.Deps {
+			ctx.Deps[dep] = "/deps/" + dep.String()
+		}
+
+		for i, cmd := range job.Cmds {
+			if _, err := cmd.Render(ctx); err != nil {
+				errs = append(errs, &TemplateError{Job: job.ID, Cmd: i, Err: err})
+			}
+		}
+	}
+
+	if cycle := findCycle(graph.Jobs, jobs); cycle != nil {
+		errs = append(errs, cycle)
+	}
+
+	if len(errs) != 0 {
+		return &ValidationError{Errors: errs}
+	}
+	return nil
+}
+
+func validateOutputs(job *Job) []error {
+	var errs []error
+
+	var valid []string
+	seen := map[string]struct{}{}
+	for _, out := range job.Outputs {
+		if !fs.ValidPath(out) || out == "." {
+			errs = append(errs, &InvalidOutputError{Job: job.ID, Output: out})
+			continue
+		}
+
+		if _, ok := seen[out]; ok {
+			errs = append(errs, &InvalidOutputError{Job: job.ID, Output: out})
+			continue
+		}
+		seen[out] = struct{}{}
+		valid = append(valid, out)
+	}
+
+	for _, out := range valid {
+		for dir := path.Dir(out); dir != "."; dir = path.Dir(dir) {
+			if _, ok := seen[dir]; ok {
+				errs = append(errs, &InvalidOutputError{Job: job.ID, Output: out})
+				break
+			}
+		}
+	}
+
+	return errs
+}
+
+func findCycle(order []Job, jobs map[ID]*Job) *CycleError {
+	const (
+		white = iota
+		grey
+		black
+	)
+
+	color := map[ID]int{}
+	var stack []ID
+
+	var visit func(id ID) *CycleError
+	visit = func(id ID) *CycleError {
+		color[id] = grey
+		stack = append(stack, id)
+
+		for _, dep := range jobs[id].Deps {
+			if _, ok := jobs[dep]; !ok {
+				continue
+			}
+
+			switch color[dep] {
+			case grey:
+				var path []ID
+				for i := len(stack) - 1; i >= 0; i-- {
+					if stack[i] == dep {
+						path = append(path, stack[i:]...)
+						break
+					}
+				}
+				return &CycleError{Path: append(path, dep)}
+
+			case white:
+				if err := visit(dep); err != nil {
+					return err
+				}
+			}
+		}
+
+		stack = stack[:len(stack)-1]
+		color[id] = black
+		return nil
+	}
+
+	for _, job := range order {
+		if color[job.ID] == white {
+			if err := visit(job.ID); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,100 @@
+package build
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	graph := Graph{
+		SourceFiles: map[ID]string{{'f'}: "a.go"},
+		Jobs: []Job{
+			{ID: ID{'a'}, Inputs: []string{"a.go"}, Deps: []ID{{'b'}}},
+			{ID: ID{'b'}, Cmds: []Cmd{{Exec: []string{"cat", "{{.SourceDir}}/a.go"}}}},
+		},
+	}
+
+	require.NoError(t, Validate(graph))
+}
+
+func TestValidateCycle(t *testing.T) {
+	graph := Graph{
+		Jobs: []Job{
+			{ID: ID{'a'}, Deps: []ID{{'b'}}},
+			{ID: ID{'b'}, Deps: []ID{{'c'}}},
+			{ID: ID{'c'}, Deps: []ID{{'b'}}},
+		},
+	}
+
+	err := Validate(graph)
+
+	var cycle *CycleError
+	require.Truef(t, errors.As(err, &cycle), "%v", err)
+	require.Equal(t, []ID{{'b'}, {'c'}, {'b'}}, cycle.Path)
+}
+
+func TestValidateSelfLoop(t *testing.T) {
+	err := Validate(Graph{Jobs: []Job{{ID: ID{'a'}, Deps: []ID{{'a'}}}}})
+
+	var cycle *CycleError
+	require.Truef(t, errors.As(err, &cycle), "%v", err)
+	require.Equal(t, []ID{{'a'}, {'a'}}, cycle.Path)
+}
+
+func TestValidateReportsAllErrors(t *testing.T) {
+	graph := Graph{
+		Jobs: []Job{
+			{ID: ID{'a'}, Inputs: []string{"missing.go"}, Deps: []ID{{'x'}}},
+			{ID: ID{'b'}, Cmds: []Cmd{{CatTemplate: "{{.Unknown"}}},
+			{ID: ID{'b'}},
+		},
+	}
+
+	err := Validate(graph)
+
+	var validationErr *ValidationError
+	require.True(t, errors.As(err, &validationErr))
+	require.Len(t, validationErr.Errors, 4)
+
+	var dangling *DanglingDepError
+	require.True(t, errors.As(err, &dangling))
+	require.Equal(t, &DanglingDepError{Job: ID{'a'}, Dep: ID{'x'}}, dangling)
+
+	var missing *MissingInputError
+	require.True(t, errors.As(err, &missing))
+	require.Equal(t, "missing.go", missing.Input)
+
+	var tmpl *TemplateError
+	require.True(t, errors.As(err, &tmpl))
+	require.Equal(t, ID{'b'}, tmpl.Job)
+
+	var duplicate *DuplicateJobError
+	require.True(t, errors.As(err, &duplicate))
+}
+
+func TestValidateOutputs(t *testing.T) {
+	valid := Job{ID: ID{'a'}, Outputs: []string{"bin/app", "lib"}}
+	require.NoError(t, Validate(Graph{Jobs: []Job{valid}}))
+
+	for _, out := range []string{"", ".", "..", "/abs", "../x", "a/../b", "a//b", "lib/x", "bin/app"} {
+		job := valid
+		job.Outputs = append(append([]string(nil), valid.Outputs...), out)
+
+		var invalid *InvalidOutputError
+		require.Truef(t, errors.As(Validate(Graph{Jobs: []Job{job}}), &invalid), "%q", out)
+		require.Equal(t, out, invalid.Output)
+	}
+}
+
+func TestValidateRequirements(t *testing.T) {
+	job := Job{ID: ID{'a'}, Requirements: Resources{CPU: 2, Memory: 1 << 30, Tags: []string{"race"}}}
+	require.NoError(t, Validate(Graph{Jobs: []Job{job}}))
+
+	job.Requirements.Memory = -1
+
+	var invalid *InvalidRequirementsError
+	require.True(t, errors.As(Validate(Graph{Jobs: []Job{job}}), &invalid))
+	require.Equal(t, ID{'a'}, invalid.Job)
+}
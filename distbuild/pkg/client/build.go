@@ -4,9 +4,11 @@ package client
 
 import (
 	"context"
+	"time"
 
 	"go.uber.org/zap"
 
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
 	"gitlab.com/slon/shad-go/distbuild/pkg/build"
 )
 
@@ -29,6 +31,56 @@ type BuildListener interface {
 	OnJobFailed(jobID build.ID, code int, error string) error
 }
 
+// BuildStartedListener может дополнительно реализовывать BuildListener. Build вызывает
+// OnBuildStarted, как только координатор выдал сборке ID, например чтобы сборку можно было
+// отменить из другого процесса через Cancel.
+type BuildStartedListener interface {
+	OnBuildStarted(buildID build.ID) error
+}
+
+// Outputs описывает выходы сборки, которые Build скачивает после её успешного завершения.
+type Outputs struct {
+	// Dir задаёт локальную директорию, в которую скачиваются выходы. Пустой Dir означает,
+	// что клиент ничего не скачивает.
+	Dir string
+
+	// Jobs перечисляет джобы, выходы которых нужно скачать. Пустой Jobs означает
+	// все джобы верхнего уровня, у которых объявлены build.Job.Outputs.
+	Jobs []build.ID
+
+	// RemoteOnly запрещает скачивать артефакты промежуточных джобов: в Jobs можно указывать
+	// только джобы верхнего уровня. Все остальные артефакты остаются на воркерах.
+	RemoteOnly bool
+}
+
+// SetOutputs задаёт выходы, которые будут скачиваться в следующих вызовах Build.
+func (c *Client) SetOutputs(outputs Outputs) {
+	panic("implement me")
+}
+
+// SetCredentials задаёт creds, с которыми клиент обращается к координатору и к воркерам.
+func (c *Client) SetCredentials(creds auth.Credentials) {
+	panic("implement me")
+}
+
+// SetTimeout задаёт BuildRequest.Timeout следующих вызовов Build. Ноль означает отсутствие ограничения.
+func (c *Client) SetTimeout(timeout time.Duration) {
+	panic("implement me")
+}
+
+// SetPriority задаёт BuildRequest.User и BuildRequest.Priority следующих вызовов Build.
+//
+// Если координатор проверяет аутентификацию, user игнорируется: пользователем сборки
+// считается Identity.Name из creds, см. SetCredentials.
+func (c *Client) SetPriority(user string, priority int) {
+	panic("implement me")
+}
+
 func (c *Client) Build(ctx context.Context, graph build.Graph, lsn BuildListener) error {
 	panic("implement me")
 }
+
+// Cancel посылает сигнал Cancel сборке buildID, которую запустил другой клиент.
+func (c *Client) Cancel(ctx context.Context, buildID build.ID) error {
+	panic("implement me")
+}
@@ -7,7 +7,9 @@ import (
 	"time"
 
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
 
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
 	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
 	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
 )
@@ -18,6 +20,10 @@ type Coordinator struct {
 var defaultConfig = scheduler.Config{
 	CacheTimeout: time.Millisecond * 10,
 	DepsTimeout:  time.Millisecond * 100,
+	MaxRetries:   3,
+
+	LivenessTimeout: time.Second * 5,
+	HeartbeatPoll:   time.Second,
 }
 
 func NewCoordinator(
@@ -29,6 +35,31 @@ func NewCoordinator(
 
 func (c *Coordinator) Stop() {}
 
+// SetAuth включает аутентификацию: все HTTP endpoint-ы координатора проверяют запросы через
+// auth.CheckAuth(checker), а heartbeat-ы принимаются только от воркера с тем же WorkerID.
+//
+// quotas ограничивают сборки каждого пользователя, nil означает отсутствие ограничений.
+// Метод вызывается до ServeHTTP и RegisterGRPC.
+func (c *Coordinator) SetAuth(checker auth.TokenChecker, quotas *auth.Quotas) {
+	panic("implement me")
+}
+
+// SetJournal включает журнал координатора в файле path.
+//
+// Координатор восстанавливает из журнала незавершённые сборки и расположение артефактов,
+// сжимает журнал через Journal.Compact и дальше записывает в него все изменения состояния.
+// Метод вызывается до ServeHTTP и RegisterGRPC.
+func (c *Coordinator) SetJournal(path string) error {
+	panic("implement me")
+}
+
+// RegisterGRPC регистрирует в server gRPC версии Service и HeartbeatService координатора.
+//
+// Передача файлов и артефактов по-прежнему идёт через HTTP.
+func (c *Coordinator) RegisterGRPC(server *grpc.Server) {
+	panic("implement me")
+}
+
 func (c *Coordinator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	panic("implement me")
 }
@@ -0,0 +1,52 @@
+package dist
+
+import (
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+	"gitlab.com/slon/shad-go/distbuild/pkg/metrics"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+)
+
+// Metrics содержит метрики координатора. Registry нужно отдавать на /metrics.
+type Metrics struct {
+	Registry *metrics.Registry
+
+	// HTTP оборачивает все handler-ы координатора и считает в том числе объём загруженных файлов.
+	HTTP *metrics.HTTPMetrics
+
+	// Builds считает завершившиеся сборки, метка status принимает значения ok, failed и canceled.
+	Builds         *metrics.CounterVec
+	BuildsRunning  *metrics.Gauge
+	BuildsRejected *metrics.Counter
+
+	// Jobs считает завершившиеся джобы, метка status принимает значения ok, failed и cached.
+	Jobs *metrics.CounterVec
+
+	Heartbeats        *metrics.Counter
+	WorkerFreeSlots   *metrics.GaugeVec
+	WorkerRunningJobs *metrics.GaugeVec
+	WorkersLost       *metrics.Counter
+}
+
+func NewMetrics(s *scheduler.Scheduler, fileCache *filecache.Cache) *Metrics {
+	r := metrics.NewRegistry()
+
+	m := &Metrics{
+		Registry: r,
+		HTTP:     metrics.NewHTTPMetrics(r, "distbuild_coordinator_http"),
+
+		Builds:         r.CounterVec("distbuild_coordinator_builds_total", "Finished builds.", "status"),
+		BuildsRunning:  r.Gauge("distbuild_coordinator_builds_running", "Builds in progress."),
+		BuildsRejected: r.Counter("distbuild_coordinator_builds_rejected_total", "Builds with invalid graph."),
+
+		Jobs: r.CounterVec("distbuild_coordinator_jobs_total", "Finished jobs.", "status"),
+
+		Heartbeats:        r.Counter("distbuild_coordinator_heartbeats_total", "Received heartbeats."),
+		WorkerFreeSlots:   r.GaugeVec("distbuild_coordinator_worker_free_slots", "Free slots reported by worker.", "worker"),
+		WorkerRunningJobs: r.GaugeVec("distbuild_coordinator_worker_running_jobs", "Running jobs reported by worker.", "worker"),
+		WorkersLost:       r.Counter("distbuild_coordinator_workers_lost_total", "Workers that stopped sending heartbeats."),
+	}
+
+	s.RegisterMetrics(r)
+	fileCache.RegisterMetrics(r, "distbuild_coordinator_filecache")
+	return m
+}
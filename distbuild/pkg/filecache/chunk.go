@@ -0,0 +1,107 @@
+package filecache
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"errors"
+	"io"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+const (
+	minChunkSize = 16 << 10
+	maxChunkSize = 256 << 10
+
+	// Граница куска ставится, когда старшие 16 бит хеша равны нулю. Средний размер
+	// куска получается около minChunkSize + 64KiB.
+	chunkMask = uint64(1<<16-1) << 48
+)
+
+var ErrChecksum = errors.New("checksum mismatch")
+
+// gear задаёт таблицу случайных чисел для rolling hash.
+//
+// Таблица должна совпадать у всех компонент системы, поэтому она генерируется из фиксированного seed.
+var gear = func() (t [256]uint64) {
+	// Генератор splitmix64.
+	x := uint64(0x6469737462756c64)
+	for i := range t {
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ (z >> 30)) * 0xbf58476d1ce4e5b9
+		z = (z ^ (z >> 27)) * 0x94d049bb133111eb
+		t[i] = z ^ (z >> 31)
+	}
+	return
+}()
+
+// Split режет поток r на куски, границы которых зависят только от содержимого потока.
+//
+// Вставка или удаление байт в середине файла меняет только соседние с изменением куски.
+// Слайс chunk переиспользуется и валиден только во время вызова chunkFn.
+func Split(r io.Reader, chunkFn func(chunk []byte) error) error {
+	br := bufio.NewReader(r)
+	buf := make([]byte, 0, maxChunkSize)
+
+	var h uint64
+	for {
+		b, err := br.ReadByte()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+
+		buf = append(buf, b)
+		h = (h << 1) + gear[b]
+
+		if (len(buf) >= minChunkSize && h&chunkMask == 0) || len(buf) == maxChunkSize {
+			if err := chunkFn(buf); err != nil {
+				return err
+			}
+
+			buf = buf[:0]
+			h = 0
+		}
+	}
+
+	if len(buf) != 0 {
+		return chunkFn(buf)
+	}
+	return nil
+}
+
+// Manifest описывает файл как последовательность кусков.
+type Manifest struct {
+	Chunks []build.ID
+	Size   int64
+
+	// Sum - sha1 от содержимого всего файла.
+	Sum build.ID
+}
+
+// NewManifest режет r на куски и вызывает chunkFn для каждого из них.
+func NewManifest(r io.Reader, chunkFn func(id build.ID, chunk []byte) error) (*Manifest, error) {
+	m := &Manifest{}
+	sum := sha1.New()
+
+	err := Split(r, func(chunk []byte) error {
+		id := build.ID(sha1.Sum(chunk))
+
+		m.Chunks = append(m.Chunks, id)
+		m.Size += int64(len(chunk))
+		_, _ = sum.Write(chunk)
+
+		if chunkFn != nil {
+			return chunkFn(id, chunk)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	copy(m.Sum[:], sum.Sum(nil))
+	return m, nil
+}
@@ -0,0 +1,146 @@
+package filecache_test
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+)
+
+func randomBytes(seed int64, n int) []byte {
+	b := make([]byte, n)
+	_, _ = rand.New(rand.NewSource(seed)).Read(b)
+	return b
+}
+
+func split(t *testing.T, data []byte) [][]byte {
+	var chunks [][]byte
+	require.NoError(t, filecache.Split(bytes.NewReader(data), func(chunk []byte) error {
+		chunks = append(chunks, append([]byte(nil), chunk...))
+		return nil
+	}))
+	return chunks
+}
+
+func TestSplit(t *testing.T) {
+	data := randomBytes(0, 4<<20)
+
+	chunks := split(t, data)
+	require.Greater(t, len(chunks), 4)
+	require.Equal(t, data, bytes.Join(chunks, nil))
+
+	// Insertion in the middle of the file must not shift boundaries of the following chunks.
+	edited := append(append(append([]byte(nil), data[:2<<20]...), []byte("foobar")...), data[2<<20:]...)
+	editedChunks := split(t, edited)
+
+	known := map[string]bool{}
+	for _, c := range chunks {
+		known[string(c)] = true
+	}
+
+	var changed int
+	for _, c := range editedChunks {
+		if !known[string(c)] {
+			changed++
+		}
+	}
+	require.LessOrEqual(t, changed, 2)
+}
+
+func TestSplitEmpty(t *testing.T) {
+	require.Empty(t, split(t, nil))
+}
+
+func TestWriteChunked(t *testing.T) {
+	cache := newCache(t)
+
+	data := randomBytes(1, 1<<20)
+
+	m, err := filecache.NewManifest(bytes.NewReader(data), nil)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(data)), m.Size)
+
+	require.Equal(t, m.Chunks, cache.MissingChunks(m.Chunks))
+
+	// Upload every other chunk.
+	var i int
+	_, err = filecache.NewManifest(bytes.NewReader(data), func(id build.ID, chunk []byte) error {
+		i++
+		if i%2 == 0 {
+			return nil
+		}
+		return cache.WriteChunk(id, chunk)
+	})
+	require.NoError(t, err)
+
+	err = cache.WriteChunked(m.Sum, m)
+	require.Truef(t, errors.Is(err, filecache.ErrNotFound), "%v", err)
+
+	missing := cache.MissingChunks(m.Chunks)
+	require.NotEmpty(t, missing)
+	require.Less(t, len(missing), len(m.Chunks))
+
+	_, err = filecache.NewManifest(bytes.NewReader(data), cache.WriteChunk)
+	require.NoError(t, err)
+	require.Empty(t, cache.MissingChunks(m.Chunks))
+
+	require.NoError(t, cache.WriteChunked(m.Sum, m))
+
+	path, unlock, err := cache.Get(m.Sum)
+	require.NoError(t, err)
+	defer unlock()
+
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, data, content)
+}
+
+func TestChecksum(t *testing.T) {
+	cache := newCache(t)
+
+	err := cache.WriteChunk(build.ID{0x01}, []byte("foo"))
+	require.Truef(t, errors.Is(err, filecache.ErrChecksum), "%v", err)
+
+	m, err := filecache.NewManifest(bytes.NewReader([]byte("foo")), cache.WriteChunk)
+	require.NoError(t, err)
+
+	// Клиент не может опубликовать содержимое под чужим ID.
+	err = cache.WriteChunked(build.ID{0x02}, m)
+	require.Truef(t, errors.Is(err, filecache.ErrChecksum), "%v", err)
+
+	forged := *m
+	forged.Sum = build.ID{0x02}
+	err = cache.WriteChunked(build.ID{0x02}, &forged)
+	require.Truef(t, errors.Is(err, filecache.ErrChecksum), "%v", err)
+
+	_, _, err = cache.Get(build.ID{0x02})
+	require.Truef(t, errors.Is(err, filecache.ErrNotFound), "%v", err)
+}
+
+func TestEvictChunks(t *testing.T) {
+	cache := newCache(t)
+
+	data := randomBytes(3, 1<<20)
+	m, err := filecache.NewManifest(bytes.NewReader(data), cache.WriteChunk)
+	require.NoError(t, err)
+	require.NoError(t, cache.WriteChunked(m.Sum, m))
+	require.Equal(t, 2*int64(len(data)), cache.Size())
+
+	// Сначала удаляются куски, файл остаётся в кеше.
+	removed, err := cache.Evict(int64(len(data)), nil)
+	require.NoError(t, err)
+	require.Empty(t, removed)
+	require.Equal(t, int64(len(data)), cache.Size())
+	require.Equal(t, m.Chunks, cache.MissingChunks(m.Chunks))
+
+	removed, err = cache.Evict(0, nil)
+	require.NoError(t, err)
+	require.Equal(t, []build.ID{m.Sum}, removed)
+	require.Zero(t, cache.Size())
+}
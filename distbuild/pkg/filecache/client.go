@@ -4,6 +4,7 @@ package filecache
 
 import (
 	"context"
+	"net/http"
 
 	"go.uber.org/zap"
 
@@ -17,6 +18,17 @@ func NewClient(l *zap.Logger, endpoint string) *Client {
 	panic("implement me")
 }
 
+// SetHTTPClient задаёт http.Client для запросов к координатору, например auth.Credentials.HTTPClient(endpoint).
+// По умолчанию используется http.DefaultClient.
+func (c *Client) SetHTTPClient(client *http.Client) {
+	panic("implement me")
+}
+
+// Upload заливает файл localPath в кеш координатора под ID id.
+//
+// Если id совпадает с sha1 содержимого файла, Upload заливает только отсутствующие куски и посылает
+// манифест. Иначе, например если вызывающий сам выбрал ID, файл заливается целиком через
+// PUT /file?id=, и содержимое с ID не сверяется.
 func (c *Client) Upload(ctx context.Context, id build.ID, localPath string) error {
 	panic("implement me")
 }
@@ -1,13 +1,16 @@
 package filecache
 
 import (
+	"crypto/sha1"
 	"errors"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 
 	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
 	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/metrics"
 )
 
 var (
@@ -35,7 +38,8 @@ func convertErr(err error) error {
 }
 
 type Cache struct {
-	cache *artifact.Cache
+	cache  *artifact.Cache
+	chunks *artifact.Cache
 }
 
 func New(rootDir string) (*Cache, error) {
@@ -44,7 +48,12 @@ func New(rootDir string) (*Cache, error) {
 		return nil, err
 	}
 
-	c := &Cache{cache: cache}
+	chunks, err := artifact.NewCache(filepath.Join(rootDir, "chunks"))
+	if err != nil {
+		return nil, err
+	}
+
+	c := &Cache{cache: cache, chunks: chunks}
 	return c, nil
 }
 
@@ -56,6 +65,34 @@ func (c *Cache) Remove(file build.ID) error {
 	return convertErr(c.cache.Remove(file))
 }
 
+// Size возвращает суммарный размер файлов и кусков.
+func (c *Cache) Size() int64 {
+	return c.cache.Size() + c.chunks.Size()
+}
+
+// RegisterMetrics экспортирует в r метрики хранилищ файлов и кусков. Имена метрик начинаются с prefix.
+func (c *Cache) RegisterMetrics(r *metrics.Registry, prefix string) {
+	c.cache.RegisterMetrics(r, prefix)
+	c.chunks.RegisterMetrics(r, prefix+"_chunks")
+}
+
+// Evict удаляет давно не использовавшиеся файлы и куски, пока их суммарный размер не уложится в budget.
+//
+// Куски удаляются первыми, потому что нужны только для сборки заливаемых файлов.
+// Evict возвращает ID удалённых файлов, pinned применяется только к файлам.
+func (c *Cache) Evict(budget int64, pinned func(file build.ID) bool) ([]build.ID, error) {
+	chunkBudget := budget - c.cache.Size()
+	if chunkBudget < 0 {
+		chunkBudget = 0
+	}
+
+	if _, err := c.chunks.Evict(chunkBudget, nil); err != nil {
+		return nil, err
+	}
+
+	return c.cache.Evict(budget-c.chunks.Size(), pinned)
+}
+
 type fileWriter struct {
 	f      *os.File
 	commit func() error
@@ -109,3 +146,101 @@ func (c *Cache) Get(file build.ID) (path string, unlock func(), err error) {
 	err = convertErr(err)
 	return
 }
+
+// WriteChunk сохраняет кусок в хранилище кусков. id должен совпадать с sha1 куска.
+//
+// Повторная запись существующего куска не считается ошибкой.
+func (c *Cache) WriteChunk(id build.ID, chunk []byte) error {
+	if build.ID(sha1.Sum(chunk)) != id {
+		return fmt.Errorf("chunk %s: %w", id, ErrChecksum)
+	}
+
+	path, commit, abort, err := c.chunks.Create(id)
+	if errors.Is(err, artifact.ErrExists) {
+		return nil
+	} else if err != nil {
+		return convertErr(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(path, fileName), chunk, 0666); err != nil {
+		_ = abort()
+		return err
+	}
+
+	return commit()
+}
+
+// MissingChunks возвращает ID кусков, которых нет в хранилище кусков.
+func (c *Cache) MissingChunks(ids []build.ID) []build.ID {
+	var missing []build.ID
+	for _, id := range ids {
+		_, unlock, err := c.chunks.Get(id)
+		if err != nil {
+			missing = append(missing, id)
+			continue
+		}
+		unlock()
+	}
+	return missing
+}
+
+func (c *Cache) readChunk(id build.ID) ([]byte, error) {
+	dir, unlock, err := c.chunks.Get(id)
+	if err != nil {
+		return nil, convertErr(err)
+	}
+	defer unlock()
+
+	chunk, err := os.ReadFile(filepath.Join(dir, fileName))
+	if err != nil {
+		return nil, err
+	}
+
+	if build.ID(sha1.Sum(chunk)) != id {
+		return nil, fmt.Errorf("chunk %s: %w", id, ErrChecksum)
+	}
+	return chunk, nil
+}
+
+// WriteChunked собирает файл из кусков, перечисленных в m.
+//
+// Все куски должны быть в хранилище кусков. Файл коммитится, только если file совпадает
+// с sha1 собранного содержимого, а размер и sha1 - с манифестом.
+//
+// Файлы, ID которых выбран вызывающим, а не посчитан по содержимому, записываются через Write.
+func (c *Cache) WriteChunked(file build.ID, m *Manifest) error {
+	if m.Sum != file {
+		return fmt.Errorf("file %s: manifest is for file %s: %w", file, m.Sum, ErrChecksum)
+	}
+
+	w, abort, err := c.Write(file)
+	if err != nil {
+		return err
+	}
+
+	sum := sha1.New()
+	var size int64
+
+	for _, id := range m.Chunks {
+		chunk, err := c.readChunk(id)
+		if err != nil {
+			_ = abort()
+			return err
+		}
+
+		if _, err := w.Write(chunk); err != nil {
+			_ = abort()
+			return err
+		}
+
+		_, _ = sum.Write(chunk)
+		size += int64(len(chunk))
+	}
+
+	if size != m.Size || build.ID(sum.Sum(nil)) != file {
+		_ = abort()
+		return fmt.Errorf("file %s: %w", file, ErrChecksum)
+	}
+
+	return w.Close()
+}
@@ -0,0 +1,460 @@
+package gobuild
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// Config управляет построением графа сборки.
+type Config struct {
+	Toolchain Toolchain
+
+	// Environ передаётся во все команды графа. Должен содержать PATH, в котором находится go,
+	// и HOME или GOCACHE.
+	Environ []string
+
+	// Vet и Test добавляют в граф джобы go vet и go test для каждого пакета.
+	Vet  bool
+	Test bool
+}
+
+// Имя джоба начинается с его типа.
+const (
+	stdJobName     = "std"
+	compilePrefix  = "compile "
+	linkPrefix     = "link "
+	vetPrefix      = "vet "
+	testPrefix     = "test "
+	stdListFile    = "std.list"
+	packageArchive = "pkg.a"
+)
+
+// stdScript собирает всю стандартную библиотеку и раскладывает export data пакетов
+// по путям вида {{.OutputDir}}/fmt.a.
+const stdScript = `set -e
+cd {{.OutputDir}}
+go list -export -f '{{"{{.ImportPath}} {{.Export}}"}}' std > ` + stdListFile + `
+while read -r p f; do
+	[ -n "$f" ] || continue
+	mkdir -p "$(dirname "$p")"
+	cp "$f" "$p.a"
+done < ` + stdListFile
+
+type graphBuilder struct {
+	root   string
+	config Config
+	pkgs   map[string]*Package
+
+	graph   build.Graph
+	sources map[string]build.ID
+
+	stdJob      build.ID
+	compileJobs map[string]build.ID
+
+	// unsupported хранит ошибки пакетов, которые не попали в шаблоны List, а нужны только
+	// как зависимости. Ошибка возвращается, только если пакет действительно понадобился.
+	unsupported map[string]error
+}
+
+// NewGraph строит граф сборки пакетов главного модуля из вывода List.
+//
+// Для каждого пакета создаётся джоб компиляции, для main пакетов - джоб линковки.
+// Стандартная библиотека собирается одним джобом. Зависимости из других модулей,
+// cgo, ассемблер и //go:embed не поддерживаются.
+//
+// root - корень главного модуля. Пути в Graph.SourceFiles задаются относительно root.
+func NewGraph(root string, pkgs []*Package, config Config) (*build.Graph, error) {
+	b := &graphBuilder{
+		root:        root,
+		config:      config,
+		pkgs:        map[string]*Package{},
+		sources:     map[string]build.ID{},
+		compileJobs: map[string]build.ID{},
+		unsupported: map[string]error{},
+	}
+	b.graph.SourceFiles = map[build.ID]string{}
+
+	for _, pkg := range pkgs {
+		b.pkgs[pkg.ImportPath] = pkg
+	}
+
+	b.addStdJob()
+
+	// go list -deps печатает пакеты в таком порядке, что зависимости идут раньше.
+	for _, pkg := range pkgs {
+		if pkg.Standard {
+			continue
+		}
+
+		if err := checkSupported(pkg, config); err != nil {
+			if !pkg.DepOnly {
+				return nil, err
+			}
+
+			// Например, пакет из другого модуля, который импортируют только тесты.
+			b.unsupported[pkg.ImportPath] = err
+			continue
+		}
+
+		if err := b.addCompileJob(pkg); err != nil {
+			return nil, err
+		}
+
+		if pkg.Name == "main" {
+			if err := b.addLinkJob(pkg); err != nil {
+				return nil, err
+			}
+		}
+
+		if b.config.Vet {
+			if err := b.addGoCommandJob(pkg, vetPrefix, "vet"); err != nil {
+				return nil, err
+			}
+		}
+
+		if b.config.Test && len(pkg.TestGoFiles)+len(pkg.XTestGoFiles) != 0 {
+			if err := b.addGoCommandJob(pkg, testPrefix, "test"); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return &b.graph, nil
+}
+
+func checkSupported(pkg *Package, config Config) error {
+	if pkg.Module == nil || !pkg.Module.Main {
+		return fmt.Errorf("package %s: only packages from the main module are supported", pkg.ImportPath)
+	}
+	if len(pkg.CgoFiles) != 0 || len(pkg.SFiles) != 0 {
+		return fmt.Errorf("package %s: cgo and assembly are not supported", pkg.ImportPath)
+	}
+
+	// Файлы из //go:embed не попадают во входы джобов, и без ошибки пакет собрался бы без них.
+	embed := pkg.EmbedFiles
+	if config.Test {
+		embed = append(append(append([]string(nil), embed...), pkg.TestEmbedFiles...), pkg.XTestEmbedFiles...)
+	}
+	if len(embed) != 0 {
+		return fmt.Errorf("package %s: //go:embed is not supported: %s", pkg.ImportPath, strings.Join(embed, ", "))
+	}
+	return nil
+}
+
+func (b *graphBuilder) environ() []string {
+	return append(append([]string(nil), b.config.Environ...), "CGO_ENABLED=0", "GOFLAGS=")
+}
+
+// addSource регистрирует файл с исходным кодом и возвращает его путь относительно корня модуля.
+//
+// ID файла - sha1 от пути и содержимого. Graph.SourceFiles хранит один путь на каждый ID,
+// поэтому файлы с одинаковым содержимым по разным путям должны получать разные ID.
+func (b *graphBuilder) addSource(absPath string) (string, error) {
+	rel, err := filepath.Rel(b.root, absPath)
+	if err != nil {
+		return "", err
+	}
+	rel = filepath.ToSlash(rel)
+
+	if rel == ".." || strings.HasPrefix(rel, "../") {
+		return "", fmt.Errorf("file %s is outside of module root %s", absPath, b.root)
+	}
+
+	if _, ok := b.sources[rel]; ok {
+		return rel, nil
+	}
+
+	content, err := os.ReadFile(absPath)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha1.New()
+	_, _ = io.WriteString(h, rel)
+	_, _ = h.Write([]byte{0})
+	_, _ = h.Write(content)
+
+	var id build.ID
+	copy(id[:], h.Sum(nil))
+
+	b.sources[rel] = id
+	b.graph.SourceFiles[id] = rel
+	return rel, nil
+}
+
+// addJob вычисляет ID джоба и добавляет его в граф.
+//
+// ID зависит от имени, команд, содержимого входных файлов, ID зависимостей и версии go.
+func (b *graphBuilder) addJob(job build.Job) build.ID {
+	var key struct {
+		Toolchain Toolchain
+		Name      string
+		Inputs    []build.ID
+		Deps      []build.ID
+		Cmds      []build.Cmd
+		Outputs   []string `json:",omitempty"`
+	}
+
+	key.Toolchain = b.config.Toolchain
+	key.Name = job.Name
+	for _, in := range job.Inputs {
+		key.Inputs = append(key.Inputs, b.sources[in])
+	}
+	key.Deps = job.Deps
+	key.Cmds = job.Cmds
+	key.Outputs = job.Outputs
+
+	js, err := json.Marshal(key)
+	if err != nil {
+		panic(err)
+	}
+
+	job.ID = build.ID(sha1.Sum(js))
+	b.graph.Jobs = append(b.graph.Jobs, job)
+	return job.ID
+}
+
+func (b *graphBuilder) addStdJob() {
+	b.stdJob = b.addJob(build.Job{
+		Name: stdJobName,
+		Cmds: []build.Cmd{
+			{Exec: []string{"sh", "-c", stdScript}, Environ: b.environ()},
+		},
+	})
+}
+
+func depDir(id build.ID) string {
+	return fmt.Sprintf("{{index .Deps %q}}", id)
+}
+
+func (b *graphBuilder) packageFile(importPath string) (string, build.ID, error) {
+	pkg, ok := b.pkgs[importPath]
+	if !ok {
+		return "", build.ID{}, fmt.Errorf("package %s is missing from go list output", importPath)
+	}
+	if err := b.unsupported[importPath]; err != nil {
+		return "", build.ID{}, err
+	}
+
+	if pkg.Standard {
+		return fmt.Sprintf("packagefile %s=%s/%s.a\n", importPath, depDir(b.stdJob), importPath), b.stdJob, nil
+	}
+
+	id, ok := b.compileJobs[importPath]
+	if !ok {
+		return "", build.ID{}, fmt.Errorf("package %s is listed after its dependents", importPath)
+	}
+	return fmt.Sprintf("packagefile %s=%s/%s\n", importPath, depDir(id), packageArchive), id, nil
+}
+
+// importcfg строит файл importcfg для пакетов imports и возвращает джобы, от которых он зависит.
+func (b *graphBuilder) importcfg(imports []string) (string, []build.ID, error) {
+	var cfg strings.Builder
+	deps := map[build.ID]struct{}{}
+
+	for _, imp := range imports {
+		if imp == "unsafe" || imp == "C" {
+			continue
+		}
+
+		line, dep, err := b.packageFile(imp)
+		if err != nil {
+			return "", nil, err
+		}
+
+		cfg.WriteString(line)
+		deps[dep] = struct{}{}
+	}
+
+	return cfg.String(), sortedIDs(deps), nil
+}
+
+func sortedIDs(set map[build.ID]struct{}) []build.ID {
+	var ids []build.ID
+	for id := range set {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].String() < ids[j].String()
+	})
+	return ids
+}
+
+func langVersion(m *Module) string {
+	parts := strings.SplitN(m.GoVersion, ".", 3)
+	if len(parts) < 2 {
+		return ""
+	}
+	return "-lang=go" + parts[0] + "." + parts[1]
+}
+
+func (b *graphBuilder) addCompileJob(pkg *Package) error {
+	cfg, deps, err := b.importcfg(pkg.Imports)
+	if err != nil {
+		return fmt.Errorf("package %s: %w", pkg.ImportPath, err)
+	}
+
+	var inputs, files []string
+	for _, f := range pkg.GoFiles {
+		rel, err := b.addSource(filepath.Join(pkg.Dir, f))
+		if err != nil {
+			return err
+		}
+
+		inputs = append(inputs, rel)
+		files = append(files, "{{.SourceDir}}/"+rel)
+	}
+
+	p := pkg.ImportPath
+	if pkg.Name == "main" {
+		p = "main"
+	}
+
+	compile := []string{"go", "tool", "compile", "-p", p, "-complete", "-pack", "-trimpath", "{{.SourceDir}}",
+		"-importcfg", "{{.OutputDir}}/importcfg", "-o", "{{.OutputDir}}/" + packageArchive}
+	if lang := langVersion(pkg.Module); lang != "" {
+		compile = append(compile, lang)
+	}
+
+	b.compileJobs[pkg.ImportPath] = b.addJob(build.Job{
+		Name:   compilePrefix + pkg.ImportPath,
+		Inputs: inputs,
+		Deps:   deps,
+		Cmds: []build.Cmd{
+			{CatTemplate: cfg, CatOutput: "{{.OutputDir}}/importcfg"},
+			{Exec: append(compile, files...), Environ: b.environ()},
+		},
+	})
+	return nil
+}
+
+func (b *graphBuilder) addLinkJob(pkg *Package) error {
+	cfg, deps, err := b.importcfg(pkg.Deps)
+	if err != nil {
+		return fmt.Errorf("package %s: %w", pkg.ImportPath, err)
+	}
+
+	mainArchive := b.compileJobs[pkg.ImportPath]
+	deps = append(deps, mainArchive)
+
+	b.addJob(build.Job{
+		Name: linkPrefix + pkg.ImportPath,
+		Deps: deps,
+		Cmds: []build.Cmd{
+			{CatTemplate: cfg, CatOutput: "{{.OutputDir}}/importcfg.link"},
+			{
+				Exec: []string{"go", "tool", "link", "-buildmode=exe", "-importcfg", "{{.OutputDir}}/importcfg.link",
+					"-o", "{{.OutputDir}}/" + path.Base(pkg.ImportPath), depDir(mainArchive) + "/" + packageArchive},
+				Environ: b.environ(),
+			},
+		},
+		Outputs: []string{path.Base(pkg.ImportPath)},
+	})
+	return nil
+}
+
+// addGoCommandJob добавляет джоб, который запускает go vet или go test на пакете.
+//
+// Такой джоб не использует артефакты других джобов. Go сам собирает все зависимости пакета,
+// поэтому во входы джоба попадают go.mod и исходники всех пакетов модуля, от которых зависит пакет.
+func (b *graphBuilder) addGoCommandJob(pkg *Package, prefix, command string) error {
+	inputs, err := b.moduleInputs(pkg)
+	if err != nil {
+		return err
+	}
+
+	rel, err := filepath.Rel(b.root, pkg.Dir)
+	if err != nil {
+		return err
+	}
+
+	b.addJob(build.Job{
+		Name:   prefix + pkg.ImportPath,
+		Inputs: inputs,
+		Cmds: []build.Cmd{
+			{
+				Exec:             []string{"go", command, "./" + filepath.ToSlash(rel)},
+				Environ:          b.environ(),
+				WorkingDirectory: "{{.SourceDir}}",
+			},
+		},
+	})
+	return nil
+}
+
+func (b *graphBuilder) moduleInputs(pkg *Package) ([]string, error) {
+	var inputs []string
+	addFile := func(absPath string) error {
+		rel, err := b.addSource(absPath)
+		if err != nil {
+			return err
+		}
+		inputs = append(inputs, rel)
+		return nil
+	}
+
+	for _, name := range []string{"go.mod", "go.sum"} {
+		if _, err := os.Stat(filepath.Join(b.root, name)); err == nil {
+			if err := addFile(filepath.Join(b.root, name)); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	visited := map[string]bool{}
+	var visit func(importPath string, withTests bool) error
+	visit = func(importPath string, withTests bool) error {
+		if visited[importPath] {
+			return nil
+		}
+		visited[importPath] = true
+
+		dep, ok := b.pkgs[importPath]
+		if !ok {
+			return fmt.Errorf("package %s is missing from go list output", importPath)
+		}
+		if dep.Standard || dep.Module == nil || !dep.Module.Main {
+			// Пакеты других модулей go берёт из своего кеша модулей, а не из директории с исходным кодом.
+			return nil
+		}
+		if err := b.unsupported[importPath]; err != nil {
+			return err
+		}
+
+		files := dep.GoFiles
+		imports := dep.Imports
+		if withTests {
+			files = append(append(append([]string(nil), files...), dep.TestGoFiles...), dep.XTestGoFiles...)
+			imports = append(append(append([]string(nil), imports...), dep.TestImports...), dep.XTestImports...)
+		}
+
+		for _, f := range files {
+			if err := addFile(filepath.Join(dep.Dir, f)); err != nil {
+				return err
+			}
+		}
+
+		for _, imp := range imports {
+			if err := visit(imp, false); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := visit(pkg.ImportPath, true); err != nil {
+		return nil, err
+	}
+
+	sort.Strings(inputs)
+	return inputs, nil
+}
@@ -0,0 +1,197 @@
+package gobuild_test
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/gobuild"
+)
+
+func newTestGraph(t *testing.T) (string, *build.Graph) {
+	root, err := filepath.Abs(filepath.Join("testdata", "hello"))
+	require.NoError(t, err)
+
+	pkgs, err := gobuild.List(root, "./...")
+	require.NoError(t, err)
+
+	toolchain, err := gobuild.CurrentToolchain()
+	require.NoError(t, err)
+
+	goCache, err := exec.Command("go", "env", "GOCACHE").Output()
+	require.NoError(t, err)
+
+	graph, err := gobuild.NewGraph(root, pkgs, gobuild.Config{
+		Toolchain: *toolchain,
+		Environ: []string{
+			"PATH=" + os.Getenv("PATH"),
+			"HOME=" + os.Getenv("HOME"),
+			"GOCACHE=" + strings.TrimSpace(string(goCache)),
+		},
+		Vet:  true,
+		Test: true,
+	})
+	require.NoError(t, err)
+
+	return root, graph
+}
+
+func TestNewGraph(t *testing.T) {
+	_, graph := newTestGraph(t)
+
+	var names []string
+	for _, job := range graph.Jobs {
+		names = append(names, job.Name)
+	}
+	sort.Strings(names)
+
+	require.Equal(t, []string{
+		"compile example.com/hello",
+		"compile example.com/hello/lib",
+		"link example.com/hello",
+		"std",
+		"test example.com/hello/lib",
+		"vet example.com/hello",
+		"vet example.com/hello/lib",
+	}, names)
+
+	var files []string
+	for _, path := range graph.SourceFiles {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	require.Equal(t, []string{"go.mod", "lib/lib.go", "lib/lib_test.go", "main.go"}, files)
+
+	require.NoError(t, build.Validate(*graph))
+	for _, job := range graph.Jobs {
+		if job.Name == "link example.com/hello" {
+			require.Equal(t, []string{"hello"}, job.Outputs)
+		} else {
+			require.Empty(t, job.Outputs, job.Name)
+		}
+	}
+
+	_, again := newTestGraph(t)
+	require.Equal(t, graph, again, "graph must be deterministic")
+}
+
+func TestUnsupportedPackages(t *testing.T) {
+	pkgs := []*gobuild.Package{
+		{ImportPath: "example.com/dep", Module: &gobuild.Module{Path: "example.com/dep"}},
+	}
+
+	_, err := gobuild.NewGraph(t.TempDir(), pkgs, gobuild.Config{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "main module")
+}
+
+func TestIdenticalSourceFiles(t *testing.T) {
+	root, err := filepath.Abs(filepath.Join("testdata", "dupcontent"))
+	require.NoError(t, err)
+
+	pkgs, err := gobuild.List(root, "./...")
+	require.NoError(t, err)
+
+	graph, err := gobuild.NewGraph(root, pkgs, gobuild.Config{})
+	require.NoError(t, err)
+
+	var files []string
+	for _, path := range graph.SourceFiles {
+		files = append(files, path)
+	}
+	sort.Strings(files)
+	require.Equal(t, []string{"a/x.go", "b/x.go", "main.go"}, files)
+}
+
+func TestTestOnlyImports(t *testing.T) {
+	root, err := filepath.Abs(filepath.Join("testdata", "testimports"))
+	require.NoError(t, err)
+
+	pkgs, err := gobuild.List(root, "./lib")
+	require.NoError(t, err)
+
+	graph, err := gobuild.NewGraph(root, pkgs, gobuild.Config{Test: true})
+	require.NoError(t, err)
+
+	for _, job := range graph.Jobs {
+		if job.Name == "test example.com/testimports/lib" {
+			require.Equal(t, []string{"go.mod", "lib/lib.go", "lib/lib_test.go", "testutil/testutil.go"}, job.Inputs)
+			return
+		}
+	}
+
+	t.Fatal("test job not found")
+}
+
+func TestEmbedUnsupported(t *testing.T) {
+	root, err := filepath.Abs(filepath.Join("testdata", "embed"))
+	require.NoError(t, err)
+
+	pkgs, err := gobuild.List(root, "./...")
+	require.NoError(t, err)
+
+	_, err = gobuild.NewGraph(root, pkgs, gobuild.Config{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "//go:embed is not supported: hello.txt")
+}
+
+// runLocally executes graph on the local machine the same way worker does.
+func runLocally(t *testing.T, sourceDir string, graph *build.Graph) map[build.ID]string {
+	outputs := map[build.ID]string{}
+
+	for _, job := range build.TopSort(graph.Jobs) {
+		outputDir := t.TempDir()
+		outputs[job.ID] = outputDir
+
+		ctx := build.JobContext{SourceDir: sourceDir, OutputDir: outputDir, Deps: map[build.ID]string{}}
+		for _, dep := range job.Deps {
+			ctx.Deps[dep] = outputs[dep]
+		}
+
+		for _, cmd := range job.Cmds {
+			rendered, err := cmd.Render(ctx)
+			require.NoError(t, err)
+
+			if rendered.CatOutput != "" {
+				require.NoError(t, os.WriteFile(rendered.CatOutput, []byte(rendered.CatTemplate), 0666))
+				continue
+			}
+
+			c := exec.Command(rendered.Exec[0], rendered.Exec[1:]...)
+			c.Env = rendered.Environ
+			c.Dir = rendered.WorkingDirectory
+			out, err := c.CombinedOutput()
+			require.NoErrorf(t, err, "job %q failed: %s", job.Name, out)
+		}
+	}
+
+	return outputs
+}
+
+func TestRunGraph(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds standard library")
+	}
+
+	root, graph := newTestGraph(t)
+	outputs := runLocally(t, root, graph)
+
+	for _, job := range graph.Jobs {
+		if job.Name != "link example.com/hello" {
+			continue
+		}
+
+		out, err := exec.Command(filepath.Join(outputs[job.ID], "hello")).Output()
+		require.NoError(t, err)
+		require.Equal(t, "hello\n", string(out))
+		return
+	}
+
+	t.Fatal("link job not found")
+}
@@ -0,0 +1,147 @@
+package gobuild
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Package содержит поля из вывода go list -json, которые нужны для построения графа сборки.
+type Package struct {
+	Dir        string
+	ImportPath string
+	Name       string
+	Standard   bool
+	DepOnly    bool
+	ForTest    string
+
+	Module *Module
+
+	GoFiles      []string
+	CgoFiles     []string
+	SFiles       []string
+	TestGoFiles  []string
+	XTestGoFiles []string
+
+	EmbedFiles      []string
+	TestEmbedFiles  []string
+	XTestEmbedFiles []string
+
+	Imports      []string
+	Deps         []string
+	TestImports  []string
+	XTestImports []string
+
+	Error *PackageError
+}
+
+type Module struct {
+	Path      string
+	Dir       string
+	GoVersion string
+	Main      bool
+}
+
+type PackageError struct {
+	Err string
+}
+
+// Toolchain описывает версию и платформу go, которыми будет собираться граф.
+type Toolchain struct {
+	GoVersion string
+	GOOS      string
+	GOARCH    string
+}
+
+func goEnv() []string {
+	return append(os.Environ(), "CGO_ENABLED=0", "GOFLAGS=")
+}
+
+// List запускает go list -json -deps -test в директории модуля dir и возвращает описание всех пакетов,
+// включая пакеты стандартной библиотеки и пакеты, которые импортируют только тесты.
+//
+// Тестовые варианты пакетов и сгенерированные go list пакеты *.test в результат не попадают.
+func List(dir string, patterns ...string) ([]*Package, error) {
+	args := append([]string{"list", "-json", "-deps", "-test"}, patterns...)
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("go", args...)
+	cmd.Dir = dir
+	cmd.Env = goEnv()
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("go list: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return parseList(&stdout)
+}
+
+func parseList(r io.Reader) ([]*Package, error) {
+	var pkgs []*Package
+
+	dec := json.NewDecoder(r)
+	for {
+		var pkg Package
+		if err := dec.Decode(&pkg); errors.Is(err, io.EOF) {
+			return pkgs, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("go list: %w", err)
+		}
+
+		if pkg.ForTest != "" || strings.Contains(pkg.ImportPath, " [") ||
+			(pkg.Name == "main" && strings.HasSuffix(pkg.ImportPath, ".test")) {
+			continue
+		}
+
+		if pkg.Error != nil {
+			return nil, fmt.Errorf("package %s: %s", pkg.ImportPath, pkg.Error.Err)
+		}
+
+		pkgs = append(pkgs, &pkg)
+	}
+}
+
+// CurrentToolchain возвращает версию и платформу go из go env.
+func CurrentToolchain() (*Toolchain, error) {
+	cmd := exec.Command("go", "env", "GOVERSION", "GOOS", "GOARCH")
+	cmd.Env = goEnv()
+
+	out, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("go env: %w", err)
+	}
+
+	fields := strings.Fields(string(out))
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("go env: unexpected output %q", out)
+	}
+
+	return &Toolchain{GoVersion: fields[0], GOOS: fields[1], GOARCH: fields[2]}, nil
+}
+
+// ModuleRoot возвращает корень модуля, в котором находится директория dir.
+func ModuleRoot(dir string) (string, error) {
+	cmd := exec.Command("go", "env", "GOMOD")
+	cmd.Dir = dir
+	cmd.Env = goEnv()
+
+	out, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("go env: %w", err)
+	}
+
+	goMod := strings.TrimSpace(string(out))
+	if goMod == "" || goMod == os.DevNull {
+		return "", fmt.Errorf("%s is not inside a go module", dir)
+	}
+
+	return filepath.Dir(goMod), nil
+}
@@ -0,0 +1,3 @@
+module example.com/dupcontent
+
+go 1.22
@@ -0,0 +1,8 @@
+package main
+
+import (
+	_ "example.com/dupcontent/a"
+	_ "example.com/dupcontent/b"
+)
+
+func main() {}
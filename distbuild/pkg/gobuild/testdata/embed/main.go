@@ -0,0 +1,13 @@
+package main
+
+import (
+	_ "embed"
+	"fmt"
+)
+
+//go:embed hello.txt
+var hello string
+
+func main() {
+	fmt.Print(hello)
+}
@@ -0,0 +1,9 @@
+package lib
+
+import "testing"
+
+func TestHello(t *testing.T) {
+	if Hello() != "hello" {
+		t.Fatal("unexpected greeting")
+	}
+}
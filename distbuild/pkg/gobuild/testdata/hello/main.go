@@ -0,0 +1,11 @@
+package main
+
+import (
+	"fmt"
+
+	"example.com/hello/lib"
+)
+
+func main() {
+	fmt.Println(lib.Hello())
+}
@@ -0,0 +1,3 @@
+module example.com/testimports
+
+go 1.22
@@ -0,0 +1,11 @@
+package lib
+
+import (
+	"testing"
+
+	"example.com/testimports/testutil"
+)
+
+func TestAnswer(t *testing.T) {
+	testutil.Equal(t, Answer(), 42)
+}
@@ -0,0 +1,9 @@
+package testutil
+
+import "testing"
+
+func Equal(t *testing.T, actual, expected int) {
+	if actual != expected {
+		t.Fatalf("%d != %d", actual, expected)
+	}
+}
@@ -0,0 +1,66 @@
+package history
+
+import (
+	"time"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// CriticalPath возвращает цепочку зависимостей с наибольшим суммарным временем работы джобов.
+//
+// Путь начинается с джоба без зависимостей и заканчивается джобом, от которого никто не зависит.
+// Незавершённые джобы учитываются с нулевой длительностью.
+func (b *Build) CriticalPath() ([]build.ID, time.Duration) {
+	type entry struct {
+		total time.Duration
+		next  *Job
+	}
+
+	memo := map[build.ID]*entry{}
+
+	var visit func(j *Job) time.Duration
+	visit = func(j *Job) time.Duration {
+		if e, ok := memo[j.ID]; ok {
+			return e.total
+		}
+
+		// Защищаемся от циклов в некорректном графе.
+		e := &entry{}
+		memo[j.ID] = e
+
+		var longest time.Duration
+		for _, depID := range j.Deps {
+			dep := b.job(depID)
+			if dep == nil {
+				continue
+			}
+
+			if d := visit(dep); e.next == nil || d > longest {
+				longest, e.next = d, dep
+			}
+		}
+
+		e.total = longest + j.Duration()
+		return e.total
+	}
+
+	var last *Job
+	var total time.Duration
+	for _, j := range b.Jobs {
+		if d := visit(j); last == nil || d > total {
+			last, total = j, d
+		}
+	}
+
+	var path []build.ID
+	seen := map[build.ID]bool{}
+	for j := last; j != nil && !seen[j.ID]; j = memo[j.ID].next {
+		seen[j.ID] = true
+		path = append(path, j.ID)
+	}
+
+	for i, k := 0, len(path)-1; i < k; i, k = i+1, k-1 {
+		path[i], path[k] = path[k], path[i]
+	}
+	return path, total
+}
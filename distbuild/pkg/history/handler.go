@@ -0,0 +1,182 @@
+package history
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"go.uber.org/zap"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// BuildDetails - ответ на GET /history/build.
+type BuildDetails struct {
+	*Build
+
+	CriticalPath         []build.ID
+	CriticalPathDuration time.Duration
+}
+
+type Handler struct {
+	l *zap.Logger
+	h *History
+}
+
+func NewHandler(l *zap.Logger, h *History) *Handler {
+	return &Handler{l: l, h: h}
+}
+
+func (h *Handler) Register(mux *http.ServeMux) {
+	mux.HandleFunc("/history", h.list)
+	mux.HandleFunc("/history/build", h.build)
+	mux.HandleFunc("/history/ui", h.listUI)
+	mux.HandleFunc("/history/ui/build", h.buildUI)
+}
+
+func (h *Handler) writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		h.l.Warn("failed to write response", zap.Error(err))
+	}
+}
+
+func (h *Handler) lookup(w http.ResponseWriter, r *http.Request) (*BuildDetails, bool) {
+	var id build.ID
+	if err := id.UnmarshalText([]byte(r.URL.Query().Get("id"))); err != nil {
+		http.Error(w, fmt.Sprintf("invalid build id: %v", err), http.StatusBadRequest)
+		return nil, false
+	}
+
+	b, ok := h.h.Get(id)
+	if !ok {
+		http.Error(w, fmt.Sprintf("build %s not found", id), http.StatusNotFound)
+		return nil, false
+	}
+
+	d := &BuildDetails{Build: b}
+	d.CriticalPath, d.CriticalPathDuration = b.CriticalPath()
+	return d, true
+}
+
+func (h *Handler) list(w http.ResponseWriter, r *http.Request) {
+	h.writeJSON(w, h.h.List())
+}
+
+func (h *Handler) build(w http.ResponseWriter, r *http.Request) {
+	if d, ok := h.lookup(w, r); ok {
+		h.writeJSON(w, d)
+	}
+}
+
+func (h *Handler) listUI(w http.ResponseWriter, r *http.Request) {
+	h.render(w, listTemplate, h.h.List())
+}
+
+// bar описывает положение джоба на временной шкале в процентах от длительности сборки.
+type bar struct {
+	*Job
+
+	Offset, Width float64
+	Critical      bool
+}
+
+func (h *Handler) buildUI(w http.ResponseWriter, r *http.Request) {
+	d, ok := h.lookup(w, r)
+	if !ok {
+		return
+	}
+
+	end := d.Finished
+	if end.IsZero() {
+		end = time.Now()
+	}
+	total := end.Sub(d.Started)
+	if total <= 0 {
+		total = 1
+	}
+
+	critical := map[build.ID]bool{}
+	for _, id := range d.CriticalPath {
+		critical[id] = true
+	}
+
+	var bars []bar
+	for _, j := range d.Jobs {
+		b := bar{Job: j, Critical: critical[j.ID]}
+		if !j.Started.IsZero() {
+			b.Offset = 100 * float64(j.Started.Sub(d.Started)) / float64(total)
+			b.Width = 100 * float64(j.Duration()) / float64(total)
+		}
+		bars = append(bars, b)
+	}
+
+	h.render(w, buildTemplate, struct {
+		*BuildDetails
+		Duration time.Duration
+		Bars     []bar
+	}{d, total, bars})
+}
+
+func (h *Handler) render(w http.ResponseWriter, t *template.Template, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := t.Execute(w, data); err != nil {
+		h.l.Warn("failed to render page", zap.Error(err))
+	}
+}
+
+const style = `<style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; }
+td, th { padding: 2px 8px; text-align: left; }
+.failed { color: #c00; }
+.track { position: relative; width: 600px; height: 14px; background: #eee; }
+.bar { position: absolute; height: 14px; min-width: 1px; background: #69c; }
+.bar.cached { background: #aaa; }
+.bar.critical { background: #e80; }
+pre { max-height: 200px; overflow: auto; background: #f6f6f6; }
+</style>`
+
+var listTemplate = template.Must(template.New("list").Parse(`<!DOCTYPE html>
+<html><head><title>distbuild history</title>` + style + `</head><body>
+<h1>Builds</h1>
+<table>
+<tr><th>ID</th><th>User</th><th>Started</th><th>Jobs</th><th>Cached</th><th>Failed</th><th>Status</th></tr>
+{{range .}}<tr>
+<td><a href="/history/ui/build?id={{.ID}}">{{.ID}}</a></td>
+<td>{{.User}}</td>
+<td>{{.Started.Format "2006-01-02 15:04:05"}}</td>
+<td>{{.FinishedJobs}}/{{.Jobs}}</td>
+<td>{{.CachedJobs}}</td>
+<td>{{.FailedJobs}}</td>
+<td>{{if .Error}}<span class="failed">{{.Error}}</span>{{else if .Finished.IsZero}}running{{else}}ok{{end}}</td>
+</tr>{{end}}
+</table>
+</body></html>`))
+
+var buildTemplate = template.Must(template.New("build").Parse(`<!DOCTYPE html>
+<html><head><title>build {{.ID}}</title>` + style + `</head><body>
+<p><a href="/history/ui">&larr; all builds</a></p>
+<h1>Build {{.ID}}</h1>
+<p>User: {{.User}}. Duration: {{.Duration}}. Critical path: {{.CriticalPathDuration}}.
+{{if .Error}}<span class="failed">{{.Error}}</span>{{end}}</p>
+<table>
+<tr><th>Job</th><th>Worker</th><th>Timeline</th><th>Duration</th><th>Exit code</th></tr>
+{{range .Bars}}<tr>
+<td{{if or .Error .ExitCode}} class="failed"{{end}}>{{.Name}}</td>
+<td>{{if .Cached}}cached{{else}}{{.Worker}}{{end}}</td>
+<td><div class="track"><div class="bar{{if .Cached}} cached{{end}}{{if .Critical}} critical{{end}}" style="left: {{printf "%.2f" .Offset}}%; width: {{printf "%.2f" .Width}}%"></div></div></td>
+<td>{{.Duration}}</td>
+<td>{{.ExitCode}}</td>
+</tr>{{end}}
+</table>
+{{range .Bars}}{{if or .Stdout .Stderr .Error}}
+<h3{{if or .Error .ExitCode}} class="failed"{{end}}>{{.Name}}</h3>
+{{if .Error}}<p class="failed">{{.Error}}</p>{{end}}
+{{if .Stdout}}<pre>{{printf "%s" .Stdout}}</pre>{{end}}
+{{if .Stderr}}<pre>{{printf "%s" .Stderr}}</pre>{{end}}
+{{if .Truncated}}<p>output truncated</p>{{end}}
+{{end}}{{end}}
+</body></html>`))
@@ -0,0 +1,277 @@
+// Package history хранит историю последних сборок координатора.
+package history
+
+import (
+	"sync"
+	"time"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// MaxOutput ограничивает размер stdout и stderr одного джоба, который сохраняется в истории.
+const MaxOutput = 64 << 10
+
+// Job описывает выполнение одного джоба в рамках сборки.
+type Job struct {
+	ID   build.ID
+	Name string
+	Deps []build.ID
+
+	// Worker выполнял джоб. Пустой, если джоб не запускался.
+	Worker api.WorkerID
+
+	Started  time.Time
+	Finished time.Time
+
+	Cached   bool
+	ExitCode int
+	Error    *string
+
+	Stdout, Stderr []byte
+
+	// Truncated равен true, если вывод джоба не поместился в MaxOutput.
+	Truncated bool
+}
+
+// Duration возвращает время работы джоба, или 0, если джоб не завершился.
+func (j *Job) Duration() time.Duration {
+	if j.Started.IsZero() || j.Finished.IsZero() {
+		return 0
+	}
+	return j.Finished.Sub(j.Started)
+}
+
+// Build описывает одну сборку.
+type Build struct {
+	ID       build.ID
+	User     string
+	Started  time.Time
+	Finished time.Time
+
+	// Error содержит причину, по которой сборка не удалась.
+	Error *string
+
+	SourceFiles map[build.ID]string
+	Jobs        []*Job
+
+	index map[build.ID]*Job
+}
+
+// Done равен true, если сборка завершилась.
+func (b *Build) Done() bool {
+	return !b.Finished.IsZero()
+}
+
+func (b *Build) job(id build.ID) *Job {
+	if b.index == nil {
+		b.index = map[build.ID]*Job{}
+		for _, j := range b.Jobs {
+			b.index[j.ID] = j
+		}
+	}
+	return b.index[id]
+}
+
+// Summary - краткое описание сборки для списка.
+type Summary struct {
+	ID       build.ID
+	User     string
+	Started  time.Time
+	Finished time.Time
+	Error    *string
+
+	Jobs, FinishedJobs, FailedJobs, CachedJobs int
+}
+
+// History хранит не больше limit последних сборок. Когда лимит превышен,
+// удаляется самая старая завершившаяся сборка. Незавершённые сборки не удаляются никогда.
+//
+// Все методы History безопасно вызывать из нескольких горутин.
+type History struct {
+	limit int
+	now   func() time.Time
+
+	mu     sync.Mutex
+	order  []build.ID
+	builds map[build.ID]*Build
+}
+
+func New(limit int, now func() time.Time) *History {
+	return &History{limit: limit, now: now, builds: map[build.ID]*Build{}}
+}
+
+// BuildStarted начинает запись новой сборки.
+func (h *History) BuildStarted(id build.ID, req *api.BuildRequest) {
+	b := &Build{
+		ID:          id,
+		User:        req.User,
+		Started:     h.now(),
+		SourceFiles: req.Graph.SourceFiles,
+	}
+
+	for _, job := range req.Graph.Jobs {
+		b.Jobs = append(b.Jobs, &Job{ID: job.ID, Name: job.Name, Deps: job.Deps})
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.builds[id]; !ok {
+		h.order = append(h.order, id)
+	}
+	h.builds[id] = b
+	h.evict()
+}
+
+func (h *History) evict() {
+	for i := 0; len(h.builds) > h.limit && i < len(h.order); {
+		id := h.order[i]
+		if !h.builds[id].Done() {
+			i++
+			continue
+		}
+
+		delete(h.builds, id)
+		h.order = append(h.order[:i], h.order[i+1:]...)
+	}
+}
+
+// JobStarted отмечает, что джоб сборки отдан воркеру.
+//
+// Если джоб перезапускается на другом воркере, время старта и воркер перезаписываются.
+func (h *History) JobStarted(buildID, jobID build.ID, workerID api.WorkerID) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if j := h.lookupJob(buildID, jobID); j != nil {
+		j.Worker = workerID
+		j.Started = h.now()
+	}
+}
+
+// JobFinished сохраняет результат джоба.
+//
+// Для результатов из кеша координатора время старта совпадает со временем завершения.
+func (h *History) JobFinished(buildID build.ID, res *api.JobResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	j := h.lookupJob(buildID, res.ID)
+	if j == nil {
+		return
+	}
+
+	j.Finished = h.now()
+	if j.Started.IsZero() || res.Cached {
+		j.Started = j.Finished
+	}
+
+	j.Cached = res.Cached
+	j.ExitCode = res.ExitCode
+	j.Error = res.Error
+	j.Stdout = appendOutput(j, j.Stdout, res.Stdout)
+	j.Stderr = appendOutput(j, j.Stderr, res.Stderr)
+}
+
+// JobOutput добавляет кусок вывода бегущего джоба.
+func (h *History) JobOutput(buildID build.ID, out *api.JobOutput) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if j := h.lookupJob(buildID, out.ID); j != nil {
+		j.Stdout = appendOutput(j, j.Stdout, out.Stdout)
+		j.Stderr = appendOutput(j, j.Stderr, out.Stderr)
+	}
+}
+
+func appendOutput(j *Job, buf, data []byte) []byte {
+	if len(buf)+len(data) > MaxOutput {
+		j.Truncated = true
+		data = data[:MaxOutput-len(buf)]
+	}
+	return append(buf, data...)
+}
+
+func (h *History) lookupJob(buildID, jobID build.ID) *Job {
+	b, ok := h.builds[buildID]
+	if !ok {
+		return nil
+	}
+	return b.job(jobID)
+}
+
+// BuildFinished завершает запись сборки. err == nil означает успешную сборку.
+func (h *History) BuildFinished(buildID build.ID, err error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b, ok := h.builds[buildID]
+	if !ok {
+		return
+	}
+
+	b.Finished = h.now()
+	if err != nil {
+		msg := err.Error()
+		b.Error = &msg
+	}
+	h.evict()
+}
+
+// Get возвращает копию сборки.
+func (h *History) Get(id build.ID) (*Build, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	b, ok := h.builds[id]
+	if !ok {
+		return nil, false
+	}
+
+	c := *b
+	c.Jobs = make([]*Job, len(b.Jobs))
+	for i, j := range b.Jobs {
+		jc := *j
+		jc.Stdout = append([]byte(nil), j.Stdout...)
+		jc.Stderr = append([]byte(nil), j.Stderr...)
+		c.Jobs[i] = &jc
+	}
+	c.index = nil
+	return &c, true
+}
+
+// List возвращает краткое описание всех сборок, начиная с самой новой.
+func (h *History) List() []Summary {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var list []Summary
+	for i := len(h.order) - 1; i >= 0; i-- {
+		b := h.builds[h.order[i]]
+		s := Summary{
+			ID:       b.ID,
+			User:     b.User,
+			Started:  b.Started,
+			Finished: b.Finished,
+			Error:    b.Error,
+			Jobs:     len(b.Jobs),
+		}
+
+		for _, j := range b.Jobs {
+			if j.Finished.IsZero() {
+				continue
+			}
+
+			s.FinishedJobs++
+			if j.Cached {
+				s.CachedJobs++
+			}
+			if j.Error != nil || j.ExitCode != 0 {
+				s.FailedJobs++
+			}
+		}
+		list = append(list, s)
+	}
+	return list
+}
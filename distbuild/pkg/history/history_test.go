@@ -0,0 +1,170 @@
+package history_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap/zaptest"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/history"
+)
+
+var (
+	jobA = build.Job{ID: build.ID{'a'}, Name: "compile a"}
+	jobB = build.Job{ID: build.ID{'b'}, Name: "compile b"}
+	jobC = build.Job{ID: build.ID{'c'}, Name: "link", Deps: []build.ID{{'a'}, {'b'}}}
+)
+
+func runBuild(clock clockwork.FakeClock, h *history.History, buildID build.ID) {
+	h.BuildStarted(buildID, &api.BuildRequest{User: "alice", Graph: build.Graph{Jobs: []build.Job{jobA, jobB, jobC}}})
+
+	h.JobStarted(buildID, jobA.ID, "w0")
+	h.JobFinished(buildID, &api.JobResult{ID: jobB.ID, Cached: true})
+
+	clock.Advance(3 * time.Second)
+	h.JobOutput(buildID, &api.JobOutput{ID: jobA.ID, Stdout: []byte("hello ")})
+	h.JobFinished(buildID, &api.JobResult{ID: jobA.ID, Stdout: []byte("world")})
+	h.JobStarted(buildID, jobC.ID, "w1")
+
+	clock.Advance(time.Second)
+	errMsg := "exit status 1"
+	h.JobFinished(buildID, &api.JobResult{ID: jobC.ID, ExitCode: 1, Error: &errMsg})
+	h.BuildFinished(buildID, fmt.Errorf("job failed"))
+}
+
+func TestHistory(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	h := history.New(10, clock.Now)
+
+	runBuild(clock, h, build.ID{1})
+
+	b, ok := h.Get(build.ID{1})
+	require.True(t, ok)
+	require.True(t, b.Done())
+	require.Equal(t, "job failed", *b.Error)
+	require.Equal(t, 4*time.Second, b.Finished.Sub(b.Started))
+
+	a := b.Jobs[0]
+	require.Equal(t, api.WorkerID("w0"), a.Worker)
+	require.Equal(t, 3*time.Second, a.Duration())
+	require.Equal(t, "hello world", string(a.Stdout))
+
+	require.True(t, b.Jobs[1].Cached)
+	require.Zero(t, b.Jobs[1].Duration())
+
+	path, d := b.CriticalPath()
+	require.Equal(t, []build.ID{jobA.ID, jobC.ID}, path)
+	require.Equal(t, 4*time.Second, d)
+
+	require.Equal(t, []history.Summary{{
+		ID:           build.ID{1},
+		User:         "alice",
+		Started:      b.Started,
+		Finished:     b.Finished,
+		Error:        b.Error,
+		Jobs:         3,
+		FinishedJobs: 3,
+		FailedJobs:   1,
+		CachedJobs:   1,
+	}}, h.List())
+}
+
+func TestHistoryLimit(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	h := history.New(2, clock.Now)
+
+	h.BuildStarted(build.ID{1}, &api.BuildRequest{})
+	h.BuildStarted(build.ID{2}, &api.BuildRequest{})
+	h.BuildFinished(build.ID{2}, nil)
+	h.BuildStarted(build.ID{3}, &api.BuildRequest{})
+
+	_, ok := h.Get(build.ID{2})
+	require.False(t, ok, "oldest finished build is evicted")
+
+	_, ok = h.Get(build.ID{1})
+	require.True(t, ok, "running builds are never evicted")
+
+	h.BuildFinished(build.ID{1}, nil)
+	h.BuildStarted(build.ID{4}, &api.BuildRequest{})
+
+	var ids []build.ID
+	for _, s := range h.List() {
+		ids = append(ids, s.ID)
+	}
+	require.Equal(t, []build.ID{{4}, {3}}, ids)
+}
+
+func TestOutputLimit(t *testing.T) {
+	h := history.New(1, time.Now)
+	h.BuildStarted(build.ID{1}, &api.BuildRequest{Graph: build.Graph{Jobs: []build.Job{jobA}}})
+
+	chunk := []byte(strings.Repeat("x", history.MaxOutput/2+1))
+	h.JobOutput(build.ID{1}, &api.JobOutput{ID: jobA.ID, Stdout: chunk})
+	h.JobFinished(build.ID{1}, &api.JobResult{ID: jobA.ID, Stdout: chunk})
+
+	b, _ := h.Get(build.ID{1})
+	require.Len(t, b.Jobs[0].Stdout, history.MaxOutput)
+	require.True(t, b.Jobs[0].Truncated)
+}
+
+func TestHandler(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	h := history.New(10, clock.Now)
+	runBuild(clock, h, build.ID{1})
+
+	mux := http.NewServeMux()
+	history.NewHandler(zaptest.NewLogger(t), h).Register(mux)
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	get := func(path string) (*http.Response, string) {
+		rsp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer rsp.Body.Close()
+
+		body, err := io.ReadAll(rsp.Body)
+		require.NoError(t, err)
+		return rsp, string(body)
+	}
+
+	rsp, body := get("/history")
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	var list []history.Summary
+	require.NoError(t, json.Unmarshal([]byte(body), &list))
+	require.Len(t, list, 1)
+
+	rsp, body = get("/history/build?id=" + build.ID{1}.String())
+	require.Equal(t, http.StatusOK, rsp.StatusCode)
+
+	var details history.BuildDetails
+	require.NoError(t, json.Unmarshal([]byte(body), &details))
+	require.Len(t, details.Jobs, 3)
+	require.Equal(t, []build.ID{jobA.ID, jobC.ID}, details.CriticalPath)
+
+	rsp, _ = get("/history/build?id=" + build.ID{2}.String())
+	require.Equal(t, http.StatusNotFound, rsp.StatusCode)
+
+	rsp, _ = get("/history/build?id=xyz")
+	require.Equal(t, http.StatusBadRequest, rsp.StatusCode)
+
+	_, body = get("/history/ui")
+	require.Contains(t, body, "/history/ui/build?id="+build.ID{1}.String())
+
+	_, body = get("/history/ui/build?id=" + build.ID{1}.String())
+	require.Contains(t, body, "compile a")
+	require.Contains(t, body, "hello world")
+	require.Contains(t, body, "exit status 1")
+	require.Contains(t, body, "bar critical")
+	require.Contains(t, body, "left: 75.00%; width: 25.00%")
+}
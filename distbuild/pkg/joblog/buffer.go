@@ -0,0 +1,126 @@
+package joblog
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// Buffer накапливает вывод бегущих джобов до следующей отправки.
+//
+// Размер буфера ограничен. Когда буфер заполнен, запись блокируется до вызова Drain.
+// Так шумный джоб замедляется, вместо того чтобы занять всю память воркера или координатора.
+type Buffer struct {
+	limit int
+
+	mu     sync.Mutex
+	size   int
+	chunks []api.JobOutput
+	freed  chan struct{}
+}
+
+// DefaultBufferSize - размер Buffer по умолчанию.
+const DefaultBufferSize = 1 << 20
+
+// NewBuffer создаёт буфер размера limit байт. Нулевой или отрицательный limit означает DefaultBufferSize.
+func NewBuffer(limit int) *Buffer {
+	if limit <= 0 {
+		limit = DefaultBufferSize
+	}
+
+	return &Buffer{
+		limit: limit,
+		freed: make(chan struct{}),
+	}
+}
+
+// Writer возвращает io.Writer, который пишет stdout (или stderr, если stderr == true) джоба jobID.
+//
+// Write блокируется, пока в буфере нет места, и возвращает ctx.Err() после отмены ctx.
+func (b *Buffer) Writer(ctx context.Context, jobID build.ID, stderr bool) io.Writer {
+	return &writer{ctx: ctx, b: b, jobID: jobID, stderr: stderr}
+}
+
+// Drain забирает всё накопленное содержимое буфера и будит заблокированных писателей.
+//
+// Соседние куски одного джоба склеиваются.
+func (b *Buffer) Drain() []api.JobOutput {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	chunks := b.chunks
+	b.chunks = nil
+	b.size = 0
+
+	close(b.freed)
+	b.freed = make(chan struct{})
+
+	return chunks
+}
+
+// Len возвращает количество байт, ожидающих отправки.
+func (b *Buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return b.size
+}
+
+// put записывает в буфер префикс p, который в нём помещается.
+//
+// Если места нет, put возвращает канал, который закроется после следующего Drain.
+func (b *Buffer) put(jobID build.ID, stderr bool, p []byte) (int, <-chan struct{}) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	n := b.limit - b.size
+	if n <= 0 {
+		return 0, b.freed
+	}
+	if n > len(p) {
+		n = len(p)
+	}
+
+	if len(b.chunks) == 0 || b.chunks[len(b.chunks)-1].ID != jobID {
+		b.chunks = append(b.chunks, api.JobOutput{ID: jobID})
+	}
+
+	last := &b.chunks[len(b.chunks)-1]
+	if stderr {
+		last.Stderr = append(last.Stderr, p[:n]...)
+	} else {
+		last.Stdout = append(last.Stdout, p[:n]...)
+	}
+
+	b.size += n
+	return n, nil
+}
+
+type writer struct {
+	ctx    context.Context
+	b      *Buffer
+	jobID  build.ID
+	stderr bool
+}
+
+func (w *writer) Write(p []byte) (int, error) {
+	var written int
+
+	for written < len(p) {
+		n, freed := w.b.put(w.jobID, w.stderr, p[written:])
+		written += n
+
+		if freed != nil {
+			select {
+			case <-freed:
+			case <-w.ctx.Done():
+				return written, w.ctx.Err()
+			}
+		}
+	}
+
+	return written, nil
+}
@@ -0,0 +1,132 @@
+package joblog_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/joblog"
+)
+
+func TestBufferMergesChunks(t *testing.T) {
+	ctx := context.Background()
+	b := joblog.NewBuffer(1024)
+
+	jobA, jobB := build.ID{'a'}, build.ID{'b'}
+
+	_, _ = fmt.Fprint(b.Writer(ctx, jobA, false), "foo")
+	_, _ = fmt.Fprint(b.Writer(ctx, jobA, true), "err")
+	_, _ = fmt.Fprint(b.Writer(ctx, jobB, false), "bar")
+	_, _ = fmt.Fprint(b.Writer(ctx, jobA, false), "baz")
+
+	require.Equal(t, 12, b.Len())
+	require.Equal(t, []api.JobOutput{
+		{ID: jobA, Stdout: []byte("foo"), Stderr: []byte("err")},
+		{ID: jobB, Stdout: []byte("bar")},
+		{ID: jobA, Stdout: []byte("baz")},
+	}, b.Drain())
+
+	require.Equal(t, 0, b.Len())
+	require.Empty(t, b.Drain())
+}
+
+func TestBufferBackPressure(t *testing.T) {
+	ctx := context.Background()
+	b := joblog.NewBuffer(4)
+
+	jobA := build.ID{'a'}
+	done := make(chan error)
+
+	go func() {
+		_, err := b.Writer(ctx, jobA, false).Write([]byte("0123456789"))
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		t.Fatalf("write finished before output was drained: %v", err)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	var output []byte
+	for len(output) < 10 {
+		time.Sleep(time.Millisecond)
+
+		require.LessOrEqual(t, b.Len(), 4)
+		for _, chunk := range b.Drain() {
+			output = append(output, chunk.Stdout...)
+		}
+	}
+
+	require.NoError(t, <-done)
+	require.Equal(t, []byte("0123456789"), output)
+}
+
+func TestBufferCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := joblog.NewBuffer(2)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cancel()
+	}()
+
+	n, err := b.Writer(ctx, build.ID{'a'}, true).Write([]byte("foobar"))
+	require.ErrorIs(t, err, context.Canceled)
+	require.Equal(t, 2, n)
+}
+
+func TestBufferDefaultLimit(t *testing.T) {
+	b := joblog.NewBuffer(0)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	n, err := b.Writer(ctx, build.ID{'a'}, false).Write(make([]byte, joblog.DefaultBufferSize+1))
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, joblog.DefaultBufferSize, n)
+	require.Equal(t, joblog.DefaultBufferSize, b.Len())
+}
+
+func TestCollector(t *testing.T) {
+	c := joblog.NewCollector(0)
+
+	jobA, jobB := build.ID{'a'}, build.ID{'b'}
+
+	c.Add(api.JobOutput{ID: jobA, Stdout: []byte("foo"), Stderr: []byte("e1")})
+	c.Add(api.JobOutput{ID: jobB, Stdout: []byte("bar")})
+	c.Add(api.JobOutput{ID: jobA, Stdout: []byte("baz")})
+
+	result := &api.JobResult{ID: jobA, Stdout: []byte("!"), Stderr: []byte("e2"), ExitCode: 1}
+	require.Equal(t, &api.JobResult{
+		ID:       jobA,
+		Stdout:   []byte("foobaz!"),
+		Stderr:   []byte("e1e2"),
+		ExitCode: 1,
+	}, c.Complete(result))
+	require.Equal(t, []byte("!"), result.Stdout)
+
+	// Вывод забывается после Complete.
+	require.Equal(t, result, c.Complete(result))
+
+	c.Forget(jobB)
+	require.Equal(t, &api.JobResult{ID: jobB}, c.Complete(&api.JobResult{ID: jobB}))
+}
+
+func TestCollectorLimit(t *testing.T) {
+	c := joblog.NewCollector(4)
+
+	jobA := build.ID{'a'}
+
+	c.Add(api.JobOutput{ID: jobA, Stdout: []byte("foo")})
+	c.Add(api.JobOutput{ID: jobA, Stdout: []byte("bar"), Stderr: []byte("e")})
+
+	full := c.Complete(&api.JobResult{ID: jobA, Stdout: []byte("baz"), Stderr: []byte("rr")})
+	require.Equal(t, "foob\n... output truncated, 5 bytes dropped\n", string(full.Stdout))
+	require.Equal(t, "err", string(full.Stderr))
+}
@@ -0,0 +1,104 @@
+package joblog
+
+import (
+	"fmt"
+	"sync"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// DefaultOutputLimit - размер stdout и stderr одного джоба, который по умолчанию хранит Collector.
+const DefaultOutputLimit = 1 << 20
+
+// Collector запоминает вывод джобов, переданный через JobOutput, чтобы восстановить полный JobResult.
+//
+// JobResult.Stdout и JobResult.Stderr содержат только ту часть вывода, которая не была передана
+// через JobOutput. Результат, который сохраняется в кеше результатов или в журнале координатора,
+// должен содержать весь вывод, иначе закешированная сборка покажет только хвост.
+//
+// Collector хранит не больше limit байт stdout и limit байт stderr каждого джоба. Остальной вывод
+// отбрасывается, а в конец результата дописывается сообщение о том, сколько байт пропало.
+// Иначе шумный джоб занял бы всю память координатора.
+type Collector struct {
+	limit int
+
+	mu   sync.Mutex
+	jobs map[build.ID]*collected
+}
+
+type collected struct {
+	stdout, stderr   []byte
+	dropOut, dropErr int
+}
+
+// NewCollector создаёт Collector с ограничением limit байт на поток. Нулевой или отрицательный
+// limit означает DefaultOutputLimit.
+func NewCollector(limit int) *Collector {
+	if limit <= 0 {
+		limit = DefaultOutputLimit
+	}
+
+	return &Collector{limit: limit, jobs: map[build.ID]*collected{}}
+}
+
+// Add запоминает очередной кусок вывода джоба.
+func (c *Collector) Add(chunk api.JobOutput) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	out, ok := c.jobs[chunk.ID]
+	if !ok {
+		out = &collected{}
+		c.jobs[chunk.ID] = out
+	}
+
+	out.stdout, out.dropOut = c.append(out.stdout, out.dropOut, chunk.Stdout)
+	out.stderr, out.dropErr = c.append(out.stderr, out.dropErr, chunk.Stderr)
+}
+
+// append дописывает в buf столько p, сколько помещается в limit, и считает отброшенные байты.
+func (c *Collector) append(buf []byte, dropped int, p []byte) ([]byte, int) {
+	n := min(len(p), c.limit-len(buf))
+	return append(buf, p[:n]...), dropped + len(p) - n
+}
+
+// Complete возвращает копию result, в которой перед хвостом Stdout и Stderr стоит весь
+// переданный ранее вывод джоба, и забывает этот вывод.
+//
+// Если вывод джоба не поместился в limit, в конце Stdout или Stderr стоит сообщение об обрезке.
+func (c *Collector) Complete(result *api.JobResult) *api.JobResult {
+	c.mu.Lock()
+	out, ok := c.jobs[result.ID]
+	delete(c.jobs, result.ID)
+	c.mu.Unlock()
+
+	if !ok {
+		out = &collected{}
+	}
+
+	full := *result
+	full.Stdout = c.complete(out.stdout, out.dropOut, result.Stdout)
+	full.Stderr = c.complete(out.stderr, out.dropErr, result.Stderr)
+	return &full
+}
+
+func (c *Collector) complete(buf []byte, dropped int, tail []byte) []byte {
+	if buf == nil && len(tail) <= c.limit {
+		return tail
+	}
+
+	buf, dropped = c.append(buf, dropped, tail)
+	if dropped != 0 {
+		buf = fmt.Appendf(buf, "\n... output truncated, %d bytes dropped\n", dropped)
+	}
+	return buf
+}
+
+// Forget забывает вывод джоба, для которого не будет JobResult, например после отмены.
+func (c *Collector) Forget(jobID build.ID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.jobs, jobID)
+}
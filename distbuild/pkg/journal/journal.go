@@ -0,0 +1,282 @@
+package journal
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// Event описывает одну запись в журнале координатора.
+//
+// Как и в api.StatusUpdate, в каждой записи заполнено ровно одно поле-вариант.
+type Event struct {
+	BuildID build.ID
+
+	BuildStarted     *BuildStarted
+	UploadDone       *api.UploadDone
+	JobScheduled     *JobScheduled
+	JobFinished      *api.JobResult
+	ArtifactsAdded   *ArtifactsAdded
+	ArtifactsRemoved *ArtifactsRemoved
+	WorkerLost       *WorkerLost
+	BuildDone        *BuildDone
+}
+
+type BuildStarted struct {
+	Graph build.Graph
+}
+
+type JobScheduled struct {
+	JobID build.ID
+}
+
+// ArtifactsAdded не привязан к сборке, поле Event.BuildID в такой записи не используется.
+type ArtifactsAdded struct {
+	WorkerID  api.WorkerID
+	Artifacts []build.ID
+}
+
+// ArtifactsRemoved записывается, когда воркер удалил артефакты из своего кеша.
+// Как и ArtifactsAdded, запись не привязана к сборке.
+type ArtifactsRemoved struct {
+	WorkerID  api.WorkerID
+	Artifacts []build.ID
+}
+
+// WorkerLost записывается, когда координатор объявил воркера потерянным.
+// Все артефакты этого воркера забываются.
+type WorkerLost struct {
+	WorkerID api.WorkerID
+}
+
+// BuildDone записывается после того, как клиенту отправлен BuildFinished или BuildFailed.
+type BuildDone struct {
+	Error *string
+}
+
+var ErrClosed = errors.New("journal is closed")
+
+// Journal - write-ahead лог событий координатора.
+//
+// Каждая запись сериализуется в одну строку json и сбрасывается на диск до того,
+// как Append вернёт управление.
+type Journal struct {
+	mu   sync.Mutex
+	path string
+	f    *os.File
+}
+
+// Open открывает журнал для записи.
+//
+// Недописанная последняя строка, которая осталась после падения координатора, отрезается.
+// Иначе следующая запись склеилась бы с ней, и журнал перестал бы читаться.
+func Open(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_RDWR|os.O_APPEND, 0666)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := truncateTail(f); err != nil {
+		_ = f.Close()
+		return nil, err
+	}
+
+	return &Journal{path: path, f: f}, nil
+}
+
+// truncateTail обрезает файл после последнего перевода строки.
+func truncateTail(f *os.File) error {
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	size := info.Size()
+	end := size
+
+	var buf [4096]byte
+	for end > 0 {
+		n := int64(len(buf))
+		if n > end {
+			n = end
+		}
+
+		if _, err := f.ReadAt(buf[:n], end-n); err != nil {
+			return err
+		}
+
+		if i := bytes.LastIndexByte(buf[:n], '\n'); i != -1 {
+			end = end - n + int64(i) + 1
+			break
+		}
+		end -= n
+	}
+
+	if end == size {
+		return nil
+	}
+
+	if err := f.Truncate(end); err != nil {
+		return err
+	}
+	return f.Sync()
+}
+
+func (j *Journal) Append(e *Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return ErrClosed
+	}
+
+	if _, err := j.f.Write(line); err != nil {
+		return err
+	}
+
+	return j.f.Sync()
+}
+
+func (j *Journal) Close() error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return ErrClosed
+	}
+
+	err := j.f.Close()
+	j.f = nil
+	return err
+}
+
+// Compact заменяет журнал записями, которые восстанавливают состояние s.
+//
+// Журнал растёт с каждой записью, поэтому координатор вызывает Compact со State из Restore
+// при старте. Результаты джобов завершённых сборок при этом отбрасываются, см. State.Events. Новый журнал сначала записывается во временный файл, который потом атомарно
+// заменяет старый, поэтому падение посреди Compact не теряет записи.
+func (j *Journal) Compact(s *State) error {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if j.f == nil {
+		return ErrClosed
+	}
+
+	tmpPath := j.path + ".tmp"
+	tmp, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0666)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(tmpPath) }()
+
+	w := bufio.NewWriter(tmp)
+	for _, e := range s.Events() {
+		line, err := json.Marshal(e)
+		if err != nil {
+			_ = tmp.Close()
+			return err
+		}
+
+		_, _ = w.Write(line)
+		_ = w.WriteByte('\n')
+	}
+
+	if err := w.Flush(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(tmpPath, j.path); err != nil {
+		return err
+	}
+	if err := syncDir(filepath.Dir(j.path)); err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND, 0666)
+	if err != nil {
+		return err
+	}
+
+	_ = j.f.Close()
+	j.f = f
+	return nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// Replay читает журнал из r и вызывает eventFn для каждой записи по порядку.
+//
+// Последняя строка без завершающего перевода строки считается недописанной из-за падения
+// координатора и пропускается. Open отрезает её перед тем, как дописывать журнал.
+func Replay(r io.Reader, eventFn func(e *Event) error) error {
+	br := bufio.NewReader(r)
+
+	for lineNo := 1; ; lineNo++ {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		line = bytes.TrimSpace(line)
+		if len(line) == 0 {
+			continue
+		}
+
+		var e Event
+		if err := json.Unmarshal(line, &e); err != nil {
+			return fmt.Errorf("journal line %d: %w", lineNo, err)
+		}
+
+		if err := eventFn(&e); err != nil {
+			return err
+		}
+	}
+}
+
+// ReplayFile аналогичен Replay, но читает журнал из файла. Отсутствующий файл
+// считается пустым журналом.
+func ReplayFile(path string, eventFn func(e *Event) error) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return Replay(f, eventFn)
+}
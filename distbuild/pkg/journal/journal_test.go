@@ -0,0 +1,187 @@
+package journal_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/journal"
+)
+
+func TestRestore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, err := journal.Open(path)
+	require.NoError(t, err)
+
+	buildA, buildB := build.ID{'a'}, build.ID{'b'}
+	jobX, jobY := build.ID{'x'}, build.ID{'y'}
+
+	graph := build.Graph{Jobs: []build.Job{{ID: jobX}, {ID: jobY, Deps: []build.ID{jobX}}}}
+
+	events := []*journal.Event{
+		{BuildID: buildA, BuildStarted: &journal.BuildStarted{Graph: graph}},
+		{BuildID: buildB, BuildStarted: &journal.BuildStarted{}},
+		{BuildID: buildA, UploadDone: &api.UploadDone{}},
+		{BuildID: buildA, JobScheduled: &journal.JobScheduled{JobID: jobX}},
+		{BuildID: buildA, JobFinished: &api.JobResult{ID: jobX, Stdout: []byte("OK")}},
+		{BuildID: buildA, JobScheduled: &journal.JobScheduled{JobID: jobY}},
+		{ArtifactsAdded: &journal.ArtifactsAdded{WorkerID: "w0", Artifacts: []build.ID{jobX}}},
+		{BuildID: buildB, BuildDone: &journal.BuildDone{}},
+	}
+
+	for _, e := range events {
+		require.NoError(t, j.Append(e))
+	}
+	require.NoError(t, j.Close())
+	require.ErrorIs(t, j.Append(events[0]), journal.ErrClosed)
+
+	state, err := journal.Restore(path)
+	require.NoError(t, err)
+
+	require.Len(t, state.Builds, 1)
+
+	b := state.Builds[buildA]
+	require.NotNil(t, b)
+	require.Equal(t, graph, b.Graph)
+	require.True(t, b.Uploaded)
+	require.Equal(t, map[build.ID]struct{}{jobY: {}}, b.Scheduled)
+	require.Equal(t, []byte("OK"), b.Finished[jobX].Stdout)
+
+	require.Equal(t, map[build.ID]map[api.WorkerID]struct{}{jobX: {"w0": {}}}, state.Artifacts)
+	require.Contains(t, state.Results, jobX)
+}
+
+func TestReplayTruncatedTail(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, err := journal.Open(path)
+	require.NoError(t, err)
+	require.NoError(t, j.Append(&journal.Event{BuildID: build.ID{'a'}, BuildStarted: &journal.BuildStarted{}}))
+	require.NoError(t, j.Close())
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"BuildID":"61000`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	state, err := journal.Restore(path)
+	require.NoError(t, err)
+	require.Len(t, state.Builds, 1)
+
+	// Запись после перезапуска не должна склеиться с недописанной строкой.
+	j, err = journal.Open(path)
+	require.NoError(t, err)
+	require.NoError(t, j.Append(&journal.Event{BuildID: build.ID{'b'}, BuildStarted: &journal.BuildStarted{}}))
+	require.NoError(t, j.Close())
+
+	state, err = journal.Restore(path)
+	require.NoError(t, err)
+	require.Len(t, state.Builds, 2)
+}
+
+func TestCompact(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, err := journal.Open(path)
+	require.NoError(t, err)
+
+	buildA, buildB := build.ID{'a'}, build.ID{'b'}
+	jobX, jobY, jobZ := build.ID{'x'}, build.ID{'y'}, build.ID{'z'}
+
+	events := []*journal.Event{
+		{BuildID: buildA, BuildStarted: &journal.BuildStarted{Graph: build.Graph{Jobs: []build.Job{{ID: jobX}, {ID: jobY}}}}},
+		{BuildID: buildB, BuildStarted: &journal.BuildStarted{}},
+		{BuildID: buildB, JobFinished: &api.JobResult{ID: jobZ, Stdout: []byte("Z")}},
+		{BuildID: buildB, BuildDone: &journal.BuildDone{}},
+		{BuildID: buildA, UploadDone: &api.UploadDone{}},
+		{BuildID: buildA, JobScheduled: &journal.JobScheduled{JobID: jobX}},
+		{BuildID: buildA, JobScheduled: &journal.JobScheduled{JobID: jobY}},
+		{BuildID: buildA, JobFinished: &api.JobResult{ID: jobX, Stdout: []byte("X")}},
+		{ArtifactsAdded: &journal.ArtifactsAdded{WorkerID: "w0", Artifacts: []build.ID{jobX, jobZ}}},
+		{ArtifactsAdded: &journal.ArtifactsAdded{WorkerID: "w1", Artifacts: []build.ID{jobX}}},
+	}
+	for _, e := range events {
+		require.NoError(t, j.Append(e))
+	}
+
+	before, err := journal.Restore(path)
+	require.NoError(t, err)
+
+	sizeBefore, err := os.Stat(path)
+	require.NoError(t, err)
+
+	require.NoError(t, j.Compact(before))
+
+	sizeAfter, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Less(t, sizeAfter.Size(), sizeBefore.Size())
+
+	after, err := journal.Restore(path)
+	require.NoError(t, err)
+	require.Equal(t, before.Builds, after.Builds)
+	require.Equal(t, before.Artifacts, after.Artifacts)
+
+	// Результат джоба завершённой сборки отбрасывается.
+	require.Contains(t, after.Results, jobX)
+	require.NotContains(t, after.Results, jobZ)
+
+	// Журнал продолжает дописываться после Compact.
+	require.NoError(t, j.Append(&journal.Event{BuildID: buildA, BuildDone: &journal.BuildDone{}}))
+	require.NoError(t, j.Close())
+
+	after, err = journal.Restore(path)
+	require.NoError(t, err)
+	require.Empty(t, after.Builds)
+	require.Len(t, after.Results, 1)
+
+	require.NoFileExists(t, path+".tmp")
+}
+
+func TestArtifactsRemoved(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "journal")
+
+	j, err := journal.Open(path)
+	require.NoError(t, err)
+
+	jobX, jobY := build.ID{'x'}, build.ID{'y'}
+
+	events := []*journal.Event{
+		{ArtifactsAdded: &journal.ArtifactsAdded{WorkerID: "w0", Artifacts: []build.ID{jobX, jobY}}},
+		{ArtifactsAdded: &journal.ArtifactsAdded{WorkerID: "w1", Artifacts: []build.ID{jobX, jobY}}},
+		{ArtifactsRemoved: &journal.ArtifactsRemoved{WorkerID: "w0", Artifacts: []build.ID{jobX}}},
+		{WorkerLost: &journal.WorkerLost{WorkerID: "w1"}},
+	}
+	for _, e := range events {
+		require.NoError(t, j.Append(e))
+	}
+
+	state, err := journal.Restore(path)
+	require.NoError(t, err)
+	require.Equal(t, map[build.ID]map[api.WorkerID]struct{}{jobY: {"w0": {}}}, state.Artifacts)
+
+	require.NoError(t, j.Compact(state))
+	require.NoError(t, j.Close())
+
+	after, err := journal.Restore(path)
+	require.NoError(t, err)
+	require.Equal(t, state.Artifacts, after.Artifacts)
+}
+
+func TestReplayCorrupted(t *testing.T) {
+	err := journal.Replay(strings.NewReader("{}\nfoo\n"), func(e *journal.Event) error { return nil })
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "line 2")
+}
+
+func TestRestoreMissingFile(t *testing.T) {
+	state, err := journal.Restore(filepath.Join(t.TempDir(), "journal"))
+	require.NoError(t, err)
+	require.Empty(t, state.Builds)
+}
@@ -0,0 +1,179 @@
+package journal
+
+import (
+	"bytes"
+	"sort"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// Build описывает состояние незавершённой сборки, восстановленное из журнала.
+type Build struct {
+	ID    build.ID
+	Graph build.Graph
+
+	// Uploaded равен true, если клиент уже прислал сигнал UploadDone.
+	Uploaded bool
+
+	// Scheduled содержит джобы, которые были отправлены в планировщик, но ещё не завершились.
+	Scheduled map[build.ID]struct{}
+
+	// Finished содержит результаты завершившихся джобов.
+	Finished map[build.ID]*api.JobResult
+}
+
+// State - состояние координатора, восстановленное из журнала.
+type State struct {
+	// Builds содержит только сборки, для которых в журнале нет записи BuildDone.
+	Builds map[build.ID]*Build
+
+	// Artifacts хранит последнее известное расположение артефактов на воркерах.
+	// Удалённые артефакты и артефакты потерянных воркеров в нём не остаются.
+	Artifacts map[build.ID]map[api.WorkerID]struct{}
+
+	// Results хранит результаты джобов, записанные после последнего Compact, в том числе
+	// из завершённых сборок. Координатор использует их, чтобы заново заполнить scheduler.ResultCache.
+	Results map[build.ID]*api.JobResult
+}
+
+func NewState() *State {
+	return &State{
+		Builds:    map[build.ID]*Build{},
+		Artifacts: map[build.ID]map[api.WorkerID]struct{}{},
+		Results:   map[build.ID]*api.JobResult{},
+	}
+}
+
+// Apply применяет одну запись журнала к состоянию.
+func (s *State) Apply(e *Event) error {
+	switch {
+	case e.BuildStarted != nil:
+		s.Builds[e.BuildID] = &Build{
+			ID:        e.BuildID,
+			Graph:     e.BuildStarted.Graph,
+			Scheduled: map[build.ID]struct{}{},
+			Finished:  map[build.ID]*api.JobResult{},
+		}
+
+	case e.ArtifactsAdded != nil:
+		for _, id := range e.ArtifactsAdded.Artifacts {
+			workers, ok := s.Artifacts[id]
+			if !ok {
+				workers = map[api.WorkerID]struct{}{}
+				s.Artifacts[id] = workers
+			}
+			workers[e.ArtifactsAdded.WorkerID] = struct{}{}
+		}
+
+	case e.ArtifactsRemoved != nil:
+		for _, id := range e.ArtifactsRemoved.Artifacts {
+			s.removeArtifact(id, e.ArtifactsRemoved.WorkerID)
+		}
+
+	case e.WorkerLost != nil:
+		for id := range s.Artifacts {
+			s.removeArtifact(id, e.WorkerLost.WorkerID)
+		}
+
+	case e.BuildDone != nil:
+		delete(s.Builds, e.BuildID)
+
+	case e.JobFinished != nil:
+		s.Results[e.JobFinished.ID] = e.JobFinished
+
+		if b, ok := s.Builds[e.BuildID]; ok {
+			delete(b.Scheduled, e.JobFinished.ID)
+			b.Finished[e.JobFinished.ID] = e.JobFinished
+		}
+
+	default:
+		b, ok := s.Builds[e.BuildID]
+		if !ok {
+			// Запись относится к сборке, которая уже завершилась.
+			return nil
+		}
+
+		switch {
+		case e.UploadDone != nil:
+			b.Uploaded = true
+
+		case e.JobScheduled != nil:
+			b.Scheduled[e.JobScheduled.JobID] = struct{}{}
+		}
+	}
+
+	return nil
+}
+
+func (s *State) removeArtifact(id build.ID, workerID api.WorkerID) {
+	workers, ok := s.Artifacts[id]
+	if !ok {
+		return
+	}
+
+	delete(workers, workerID)
+	if len(workers) == 0 {
+		delete(s.Artifacts, id)
+	}
+}
+
+// Events возвращает записи журнала, которые восстанавливают незавершённые сборки и расположение
+// артефактов из s.
+//
+// Compact записывает их вместо всего журнала. Результаты джобов завершённых сборок в них не попадают:
+// иначе журнал хранил бы полный вывод всех джобов вечно. Такие джобы после перезапуска координатора
+// выполнятся заново.
+func (s *State) Events() []*Event {
+	var events []*Event
+
+	for _, id := range sortedIDs(s.Artifacts) {
+		for _, w := range sortedWorkers(s.Artifacts[id]) {
+			events = append(events, &Event{ArtifactsAdded: &ArtifactsAdded{WorkerID: w, Artifacts: []build.ID{id}}})
+		}
+	}
+
+	for _, id := range sortedIDs(s.Builds) {
+		b := s.Builds[id]
+
+		events = append(events, &Event{BuildID: id, BuildStarted: &BuildStarted{Graph: b.Graph}})
+		if b.Uploaded {
+			events = append(events, &Event{BuildID: id, UploadDone: &api.UploadDone{}})
+		}
+		for _, jobID := range sortedIDs(b.Scheduled) {
+			events = append(events, &Event{BuildID: id, JobScheduled: &JobScheduled{JobID: jobID}})
+		}
+		for _, jobID := range sortedIDs(b.Finished) {
+			events = append(events, &Event{BuildID: id, JobFinished: b.Finished[jobID]})
+		}
+	}
+
+	return events
+}
+
+func sortedIDs[V any](m map[build.ID]V) []build.ID {
+	ids := make([]build.ID, 0, len(m))
+	for id := range m {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return bytes.Compare(ids[i][:], ids[j][:]) < 0 })
+	return ids
+}
+
+func sortedWorkers(m map[api.WorkerID]struct{}) []api.WorkerID {
+	workers := make([]api.WorkerID, 0, len(m))
+	for w := range m {
+		workers = append(workers, w)
+	}
+	sort.Slice(workers, func(i, j int) bool { return workers[i] < workers[j] })
+	return workers
+}
+
+// Restore читает журнал из файла path и восстанавливает по нему состояние координатора.
+func Restore(path string) (*State, error) {
+	s := NewState()
+	if err := ReplayFile(path, s.Apply); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
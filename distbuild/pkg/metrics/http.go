@@ -0,0 +1,115 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// HTTPMetrics считает запросы, время их обработки и объём переданных данных.
+//
+// Метка path содержит шаблон http.ServeMux, которым обработан запрос, а не сам путь, поэтому
+// число временных рядов не зависит от того, какие пути присылают клиенты. Запросы, для которых
+// шаблон найти не удалось, попадают в метку OtherPath.
+type HTTPMetrics struct {
+	requests *CounterVec
+	duration *HistogramVec
+	bytesIn  *CounterVec
+	bytesOut *CounterVec
+}
+
+// NewHTTPMetrics регистрирует метрики с префиксом prefix, например "distbuild_coordinator_http".
+func NewHTTPMetrics(r *Registry, prefix string) *HTTPMetrics {
+	return &HTTPMetrics{
+		requests: r.CounterVec(prefix+"_requests_total", "Number of handled HTTP requests.", "path", "code"),
+		duration: r.HistogramVec(prefix+"_request_duration_seconds", "HTTP request handling time.", nil, "path"),
+		bytesIn:  r.CounterVec(prefix+"_received_bytes_total", "Bytes read from HTTP request bodies.", "path"),
+		bytesOut: r.CounterVec(prefix+"_sent_bytes_total", "Bytes written to HTTP response bodies.", "path"),
+	}
+}
+
+// OtherPath - значение метки path для запросов к handler-у, который не является *http.ServeMux,
+// и для запросов, которые не подошли ни под один шаблон.
+const OtherPath = "other"
+
+type countingReader struct {
+	io.ReadCloser
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.ReadCloser.Read(p)
+	r.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	http.ResponseWriter
+	code int
+	n    int64
+}
+
+func (w *countingWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(p)
+	w.n += int64(n)
+	return n, err
+}
+
+// Flush нужен handler-ам, которые проверяют w.(http.Flusher), например для потоковых ответов.
+func (w *countingWriter) Flush() {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Unwrap позволяет http.ResponseController добраться до остальных методов исходного ResponseWriter.
+func (w *countingWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Wrap возвращает handler, который обновляет метрики после обработки каждого запроса.
+//
+// Чтобы метки содержали шаблоны путей, h должен быть *http.ServeMux.
+func (m *HTTPMetrics) Wrap(h http.Handler) http.Handler {
+	mux, _ := h.(*http.ServeMux)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		path := OtherPath
+		if mux != nil {
+			if _, pattern := mux.Handler(r); pattern != "" {
+				path = pattern
+			}
+		}
+
+		body := &countingReader{ReadCloser: r.Body}
+		r.Body = body
+
+		cw := &countingWriter{ResponseWriter: w}
+		h.ServeHTTP(cw, r)
+
+		if cw.code == 0 {
+			cw.code = http.StatusOK
+		}
+
+		m.requests.With(path, strconv.Itoa(cw.code)).Inc()
+		m.duration.With(path).Observe(time.Since(start).Seconds())
+		m.bytesIn.With(path).Add(float64(body.n))
+		m.bytesOut.With(path).Add(float64(cw.n))
+	})
+}
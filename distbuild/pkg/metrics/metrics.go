@@ -0,0 +1,366 @@
+// Package metrics реализует минимальный набор метрик, которые отдаются в текстовом формате Prometheus.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// DefBuckets - границы бакетов гистограммы по умолчанию, в секундах.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30, 60, 300}
+
+type atomicFloat struct {
+	bits atomic.Uint64
+}
+
+func (f *atomicFloat) Add(v float64) {
+	for {
+		old := f.bits.Load()
+		if f.bits.CompareAndSwap(old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (f *atomicFloat) Set(v float64) {
+	f.bits.Store(math.Float64bits(v))
+}
+
+func (f *atomicFloat) Load() float64 {
+	return math.Float64frombits(f.bits.Load())
+}
+
+// Counter - монотонно растущее значение.
+type Counter struct {
+	v atomicFloat
+}
+
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Add увеличивает счётчик на v. Отрицательные значения игнорируются.
+func (c *Counter) Add(v float64) {
+	if v > 0 {
+		c.v.Add(v)
+	}
+}
+
+func (c *Counter) Value() float64 {
+	return c.v.Load()
+}
+
+// Gauge - значение, которое может как расти, так и уменьшаться.
+type Gauge struct {
+	v atomicFloat
+}
+
+func (g *Gauge) Set(v float64) {
+	g.v.Set(v)
+}
+
+func (g *Gauge) Add(v float64) {
+	g.v.Add(v)
+}
+
+func (g *Gauge) Inc() {
+	g.v.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.v.Add(-1)
+}
+
+func (g *Gauge) Value() float64 {
+	return g.v.Load()
+}
+
+// Histogram считает распределение наблюдаемых значений по бакетам.
+type Histogram struct {
+	buckets []float64
+
+	mu     sync.Mutex
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+func newHistogram(buckets []float64) *Histogram {
+	return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets))}
+}
+
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for i, le := range h.buckets {
+		if v <= le {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+type metricType string
+
+const (
+	typeCounter   metricType = "counter"
+	typeGauge     metricType = "gauge"
+	typeHistogram metricType = "histogram"
+)
+
+// family - метрика вместе со всеми наборами значений её меток.
+type family struct {
+	name   string
+	help   string
+	typ    metricType
+	labels []string
+
+	buckets []float64
+	fn      func() float64
+
+	mu     sync.Mutex
+	series map[string]*series
+}
+
+type series struct {
+	labels    []string
+	counter   *Counter
+	gauge     *Gauge
+	histogram *Histogram
+}
+
+func (f *family) with(values []string) *series {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("metrics: %s has %d labels, got %d values", f.name, len(f.labels), len(values)))
+	}
+
+	key := strings.Join(values, "\xff")
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if s, ok := f.series[key]; ok {
+		return s
+	}
+
+	s := &series{labels: append([]string(nil), values...)}
+	switch {
+	case f.typ == typeHistogram:
+		s.histogram = newHistogram(f.buckets)
+	case f.typ == typeCounter:
+		s.counter = &Counter{}
+	default:
+		s.gauge = &Gauge{}
+	}
+
+	f.series[key] = s
+	return s
+}
+
+// CounterVec - набор счётчиков с одинаковым именем и разными значениями меток.
+type CounterVec struct {
+	f *family
+}
+
+// With возвращает счётчик для значений меток values, перечисленных в порядке объявления.
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.f.with(values).counter
+}
+
+// GaugeVec - набор gauge с одинаковым именем и разными значениями меток.
+type GaugeVec struct {
+	f *family
+}
+
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.f.with(values).gauge
+}
+
+// Delete удаляет значение для набора меток, например когда воркер пропал.
+func (v *GaugeVec) Delete(values ...string) {
+	v.f.mu.Lock()
+	defer v.f.mu.Unlock()
+
+	delete(v.f.series, strings.Join(values, "\xff"))
+}
+
+// HistogramVec - набор гистограмм с одинаковым именем и разными значениями меток.
+type HistogramVec struct {
+	f *family
+}
+
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.f.with(values).histogram
+}
+
+// Registry хранит метрики и отдаёт их в текстовом формате Prometheus.
+//
+// Registry реализует http.Handler, его нужно зарегистрировать на /metrics.
+type Registry struct {
+	mu       sync.Mutex
+	families map[string]*family
+}
+
+func NewRegistry() *Registry {
+	return &Registry{families: map[string]*family{}}
+}
+
+func (r *Registry) register(f *family) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.families[f.name]; ok {
+		panic(fmt.Sprintf("metrics: %s is already registered", f.name))
+	}
+
+	f.series = map[string]*series{}
+	r.families[f.name] = f
+	return f
+}
+
+func (r *Registry) Counter(name, help string) *Counter {
+	return r.CounterVec(name, help).With()
+}
+
+func (r *Registry) CounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{f: r.register(&family{name: name, help: help, typ: typeCounter, labels: labels})}
+}
+
+// CounterFunc регистрирует счётчик, значение которого вычисляется при каждом чтении.
+func (r *Registry) CounterFunc(name, help string, fn func() float64) {
+	r.register(&family{name: name, help: help, typ: typeCounter, fn: fn})
+}
+
+func (r *Registry) Gauge(name, help string) *Gauge {
+	return r.GaugeVec(name, help).With()
+}
+
+func (r *Registry) GaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{f: r.register(&family{name: name, help: help, typ: typeGauge, labels: labels})}
+}
+
+// GaugeFunc регистрирует gauge, значение которого вычисляется при каждом чтении.
+func (r *Registry) GaugeFunc(name, help string, fn func() float64) {
+	r.register(&family{name: name, help: help, typ: typeGauge, fn: fn})
+}
+
+// Histogram регистрирует гистограмму. buckets должны быть отсортированы, nil означает DefBuckets.
+func (r *Registry) Histogram(name, help string, buckets []float64) *Histogram {
+	return r.HistogramVec(name, help, buckets).With()
+}
+
+func (r *Registry) HistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if buckets == nil {
+		buckets = DefBuckets
+	}
+	return &HistogramVec{f: r.register(&family{name: name, help: help, typ: typeHistogram, labels: labels, buckets: buckets})}
+}
+
+// WriteText пишет все метрики в текстовом формате Prometheus. Метрики отсортированы по имени.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	families := make([]*family, 0, len(r.families))
+	for _, f := range r.families {
+		families = append(families, f)
+	}
+	r.mu.Unlock()
+
+	sort.Slice(families, func(i, j int) bool { return families[i].name < families[j].name })
+
+	bw := bufio.NewWriter(w)
+	for _, f := range families {
+		f.write(bw)
+	}
+	return bw.Flush()
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WriteText(w)
+}
+
+func (f *family) write(w *bufio.Writer) {
+	if f.help != "" {
+		fmt.Fprintf(w, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	}
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+
+	if f.fn != nil {
+		fmt.Fprintf(w, "%s %s\n", f.name, formatFloat(f.fn()))
+		return
+	}
+
+	f.mu.Lock()
+	all := make([]*series, 0, len(f.series))
+	for _, s := range f.series {
+		all = append(all, s)
+	}
+	f.mu.Unlock()
+
+	sort.Slice(all, func(i, j int) bool {
+		return strings.Join(all[i].labels, "\xff") < strings.Join(all[j].labels, "\xff")
+	})
+
+	for _, s := range all {
+		switch {
+		case s.counter != nil:
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.formatLabels(s.labels, ""), formatFloat(s.counter.Value()))
+		case s.gauge != nil:
+			fmt.Fprintf(w, "%s%s %s\n", f.name, f.formatLabels(s.labels, ""), formatFloat(s.gauge.Value()))
+		case s.histogram != nil:
+			h := s.histogram
+			h.mu.Lock()
+			for i, le := range h.buckets {
+				fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.formatLabels(s.labels, formatFloat(le)), h.counts[i])
+			}
+			fmt.Fprintf(w, "%s_bucket%s %d\n", f.name, f.formatLabels(s.labels, "+Inf"), h.count)
+			fmt.Fprintf(w, "%s_sum%s %s\n", f.name, f.formatLabels(s.labels, ""), formatFloat(h.sum))
+			fmt.Fprintf(w, "%s_count%s %d\n", f.name, f.formatLabels(s.labels, ""), h.count)
+			h.mu.Unlock()
+		}
+	}
+}
+
+func (f *family) formatLabels(values []string, le string) string {
+	var pairs []string
+	for i, name := range f.labels {
+		pairs = append(pairs, name+`="`+escapeLabel(values[i])+`"`)
+	}
+	if le != "" {
+		pairs = append(pairs, `le="`+le+`"`)
+	}
+
+	if len(pairs) == 0 {
+		return ""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func escapeLabel(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`).Replace(s)
+}
+
+func escapeHelp(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\n", `\n`).Replace(s)
+}
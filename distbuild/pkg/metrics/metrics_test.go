@@ -0,0 +1,124 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/metrics"
+)
+
+func TestWriteText(t *testing.T) {
+	r := metrics.NewRegistry()
+
+	jobs := r.CounterVec("jobs_total", "Finished jobs.", "status")
+	jobs.With("ok").Add(2)
+	jobs.With("failed").Inc()
+
+	slots := r.GaugeVec("free_slots", "Free slots.", "worker")
+	slots.With(`w"0`).Set(4)
+	slots.With("w1").Set(1)
+	slots.Delete("w1")
+
+	r.GaugeFunc("queue_depth", "Jobs waiting\nin queue.", func() float64 { return 3 })
+
+	h := r.Histogram("job_duration_seconds", "", []float64{1, 10})
+	h.Observe(0.5)
+	h.Observe(5)
+	h.Observe(50)
+
+	var out strings.Builder
+	require.NoError(t, r.WriteText(&out))
+
+	require.Equal(t, `# HELP free_slots Free slots.
+# TYPE free_slots gauge
+free_slots{worker="w\"0"} 4
+# TYPE job_duration_seconds histogram
+job_duration_seconds_bucket{le="1"} 1
+job_duration_seconds_bucket{le="10"} 2
+job_duration_seconds_bucket{le="+Inf"} 3
+job_duration_seconds_sum 55.5
+job_duration_seconds_count 3
+# HELP jobs_total Finished jobs.
+# TYPE jobs_total counter
+jobs_total{status="failed"} 1
+jobs_total{status="ok"} 2
+# HELP queue_depth Jobs waiting\nin queue.
+# TYPE queue_depth gauge
+queue_depth 3
+`, out.String())
+}
+
+func TestDuplicateRegistration(t *testing.T) {
+	r := metrics.NewRegistry()
+	r.Counter("jobs_total", "")
+
+	require.Panics(t, func() { r.Gauge("jobs_total", "") })
+}
+
+func TestHTTPMetrics(t *testing.T) {
+	r := metrics.NewRegistry()
+	m := metrics.NewHTTPMetrics(r, "test_http")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/echo", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(w, r.Body)
+	})
+	mux.Handle("/metrics", r)
+
+	server := httptest.NewServer(m.Wrap(mux))
+	defer server.Close()
+
+	rsp, err := http.Post(server.URL+"/echo", "text/plain", strings.NewReader("hello"))
+	require.NoError(t, err)
+	_ = rsp.Body.Close()
+
+	rsp, err = http.Get(server.URL + "/metrics")
+	require.NoError(t, err)
+	defer rsp.Body.Close()
+
+	body, err := io.ReadAll(rsp.Body)
+	require.NoError(t, err)
+
+	require.Contains(t, string(body), `test_http_requests_total{path="/echo",code="200"} 1`)
+	require.Contains(t, string(body), `test_http_received_bytes_total{path="/echo"} 5`)
+	require.Contains(t, string(body), `test_http_sent_bytes_total{path="/echo"} 5`)
+	require.Contains(t, string(body), `test_http_request_duration_seconds_count{path="/echo"} 1`)
+}
+
+func TestHTTPMetricsPathLabel(t *testing.T) {
+	r := metrics.NewRegistry()
+	m := metrics.NewHTTPMetrics(r, "test_http")
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/artifact/", func(w http.ResponseWriter, r *http.Request) {
+		f, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming is not supported", http.StatusInternalServerError)
+			return
+		}
+
+		_, _ = w.Write([]byte("data"))
+		f.Flush()
+	})
+
+	server := httptest.NewServer(m.Wrap(mux))
+	defer server.Close()
+
+	for _, path := range []string{"/artifact/a", "/artifact/b", "/unknown"} {
+		rsp, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		_ = rsp.Body.Close()
+	}
+
+	var buf strings.Builder
+	require.NoError(t, r.WriteText(&buf))
+
+	require.Contains(t, buf.String(), `test_http_requests_total{path="/artifact/",code="200"} 2`)
+	require.Contains(t, buf.String(), `test_http_requests_total{path="other",code="404"} 1`)
+	require.NotContains(t, buf.String(), `/artifact/a`)
+}
@@ -0,0 +1,205 @@
+package sandbox
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Config описывает ограничения, с которыми воркер запускает команды джобов.
+//
+// Нулевое значение Config не накладывает никаких ограничений, кроме очистки окружения.
+type Config struct {
+	// User задаёт пользователя, от имени которого запускаются команды, например "nobody".
+	//
+	// Выходная директория джоба передаётся этому пользователю, остальные файлы воркера
+	// защищены от него только правами доступа. Пустая строка означает, что пользователь не меняется.
+	User string
+
+	// Namespaces включает отдельные mount, PID, IPC и UTS namespace для каждой команды.
+	// Директории readOnlyDirs из Run монтируются внутри mount namespace только на чтение.
+	//
+	// Требует привилегий root.
+	Namespaces bool
+
+	// CPUTime ограничивает процессорное время каждого процесса команды.
+	CPUTime time.Duration
+
+	// Memory ограничивает размер адресного пространства каждого процесса команды в байтах.
+	Memory uint64
+
+	// WallClock ограничивает время работы одной команды.
+	WallClock time.Duration
+}
+
+// LimitError возвращается из Run, если команда была убита из-за превышения ограничения.
+type LimitError struct {
+	Limit string
+	Value string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded (%s)", e.Limit, e.Value)
+}
+
+var ErrUnsupported = errors.New("sandbox is not supported on this platform")
+
+// helperName - argv[0] вспомогательного процесса, который настраивает песочницу
+// и делает exec команды.
+const helperName = "distbuild-sandbox"
+
+// Init должен быть первым вызовом в main бинаря, который использует Run.
+//
+// Run запускает команду через тот же бинарь: вспомогательный процесс выставляет
+// ограничения и монтирования внутри себя и только потом делает exec команды, так что
+// ограничения действуют с первой инструкции команды и наследуются её потомками.
+// В этом процессе Init не возвращает управление.
+func Init() {
+	if len(os.Args) == 0 || os.Args[0] != helperName {
+		return
+	}
+
+	runHelper(os.Args[1:])
+}
+
+// Run запускает cmd с ограничениями из c и дожидается завершения.
+//
+// Run заменяет nil cmd.Env на пустое окружение, так что команда видит только переменные
+// из build.Cmd.Environ. outputDir передаётся пользователю c.User перед запуском.
+// readOnlyDirs, обычно директория с исходным кодом и выходы зависимостей, монтируются
+// только на чтение, если включён Namespaces.
+//
+// Ошибки запуска и ненулевой код возврата возвращаются как есть. Если команда была убита
+// из-за ограничения или упала, не сумев выделить память под c.Memory, Run возвращает *LimitError.
+func (c *Config) Run(ctx context.Context, cmd *exec.Cmd, outputDir string, readOnlyDirs ...string) error {
+	if cmd.Env == nil {
+		cmd.Env = []string{}
+	}
+
+	var stderr allocFailureWriter
+	if c.Memory != 0 {
+		if cmd.Stderr != nil {
+			cmd.Stderr = io.MultiWriter(cmd.Stderr, &stderr)
+		} else {
+			cmd.Stderr = &stderr
+		}
+	}
+
+	started, err := c.prepare(cmd, outputDir, readOnlyDirs)
+	if err != nil {
+		return err
+	}
+
+	startErr := cmd.Start()
+	if err := started(startErr); err != nil {
+		if startErr == nil {
+			killProcessGroup(cmd)
+			_ = cmd.Wait()
+		}
+		return err
+	}
+
+	var timedOut atomic.Bool
+	stop := make(chan struct{})
+	defer close(stop)
+
+	var timeout <-chan time.Time
+	if c.WallClock != 0 {
+		timer := time.NewTimer(c.WallClock)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	go func() {
+		select {
+		case <-timeout:
+			timedOut.Store(true)
+			killProcessGroup(cmd)
+		case <-ctx.Done():
+			killProcessGroup(cmd)
+		case <-stop:
+		}
+	}()
+
+	err = cmd.Wait()
+
+	switch {
+	case timedOut.Load():
+		return &LimitError{Limit: "wall-clock", Value: c.WallClock.String()}
+	case ctx.Err() != nil:
+		return ctx.Err()
+	case err != nil && c.cpuLimitExceeded(cmd):
+		return &LimitError{Limit: "cpu time", Value: c.CPUTime.String()}
+	case err != nil && c.memoryLimitExceeded(cmd, &stderr):
+		return &LimitError{Limit: "memory", Value: strconv.FormatUint(c.Memory, 10) + " bytes"}
+	default:
+		return err
+	}
+}
+
+// allocFailures - сообщения, которые печатают рантаймы и libc, когда не удалось выделить память.
+var allocFailures = [][]byte{
+	[]byte("out of memory"),
+	[]byte("cannot allocate memory"),
+	[]byte("bad_alloc"),
+	[]byte("memoryerror"),
+}
+
+// memoryLimitExceeded угадывает, что команда упала из-за RLIMIT_AS.
+//
+// Ядро не сообщает, что процесс упёрся в RLIMIT_AS: mmap просто возвращает ENOMEM, и команда
+// завершается с ошибкой сама. Поэтому ошибка считается превышением лимита, если команда
+// напечатала в stderr сообщение о нехватке памяти или её RSS приблизился к лимиту.
+func (c *Config) memoryLimitExceeded(cmd *exec.Cmd, stderr *allocFailureWriter) bool {
+	if c.Memory == 0 {
+		return false
+	}
+	return stderr.found() || c.nearMemoryLimit(cmd)
+}
+
+// allocFailureWriter ищет в stderr команды сообщения из allocFailures.
+type allocFailureWriter struct {
+	mu sync.Mutex
+	// prev - конец предыдущей записи, чтобы найти сообщение, разрезанное между двумя Write.
+	prev  []byte
+	match bool
+}
+
+func (w *allocFailureWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.match {
+		return len(p), nil
+	}
+
+	buf := bytes.ToLower(append(w.prev, p...))
+	for _, msg := range allocFailures {
+		if bytes.Contains(buf, msg) {
+			w.match = true
+			return len(p), nil
+		}
+	}
+
+	const keep = 32
+	if len(buf) > keep {
+		buf = buf[len(buf)-keep:]
+	}
+	w.prev = append(w.prev[:0], buf...)
+	return len(p), nil
+}
+
+func (w *allocFailureWriter) found() bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.match
+}
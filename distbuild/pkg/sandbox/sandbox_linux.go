@@ -0,0 +1,264 @@
+//go:build linux
+
+package sandbox
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// helperConfig передаётся вспомогательному процессу первым аргументом.
+type helperConfig struct {
+	// StatusFD - дескриптор, в который helper пишет ошибку настройки песочницы.
+	// Дескриптор закрывается при exec команды, так что пустой поток означает успех.
+	StatusFD int
+
+	Credential   *syscall.Credential
+	ReadOnlyDirs []string
+	CPUTime      uint64
+	Memory       uint64
+}
+
+func (c *Config) prepare(cmd *exec.Cmd, outputDir string, readOnlyDirs []string) (started func(error) error, err error) {
+	attr := &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}
+	cmd.SysProcAttr = attr
+
+	var config helperConfig
+
+	if c.User != "" {
+		u, err := user.Lookup(c.User)
+		if err != nil {
+			return nil, err
+		}
+
+		uid, _ := strconv.Atoi(u.Uid)
+		gid, _ := strconv.Atoi(u.Gid)
+
+		config.Credential = &syscall.Credential{
+			Uid: uint32(uid),
+			Gid: uint32(gid),
+		}
+
+		if outputDir != "" {
+			if err := chownTree(outputDir, uid, gid); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if c.Namespaces {
+		attr.Cloneflags = syscall.CLONE_NEWNS | syscall.CLONE_NEWPID | syscall.CLONE_NEWIPC | syscall.CLONE_NEWUTS
+		config.ReadOnlyDirs = readOnlyDirs
+	}
+
+	if c.CPUTime != 0 {
+		config.CPUTime = uint64((c.CPUTime + 999_999_999) / 1_000_000_000)
+	}
+	config.Memory = c.Memory
+
+	if config.Credential == nil && config.ReadOnlyDirs == nil && config.CPUTime == 0 && config.Memory == 0 {
+		return func(err error) error { return err }, nil
+	}
+
+	return wrapHelper(cmd, config)
+}
+
+// wrapHelper заменяет cmd на вспомогательный процесс, который настраивает песочницу
+// и делает exec исходной команды.
+func wrapHelper(cmd *exec.Cmd, config helperConfig) (started func(error) error, err error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+
+	config.StatusFD = 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, w)
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		_ = r.Close()
+		_ = w.Close()
+		return nil, err
+	}
+
+	cmd.Args = append([]string{helperName, string(configJSON), cmd.Path}, cmd.Args...)
+	cmd.Path = self
+
+	return func(startErr error) error {
+		_ = w.Close()
+		defer func() { _ = r.Close() }()
+
+		if startErr != nil {
+			return startErr
+		}
+
+		status, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if len(status) != 0 {
+			return fmt.Errorf("sandbox: %s", status)
+		}
+		return nil
+	}, nil
+}
+
+// runHelper настраивает песочницу в текущем процессе и делает exec команды.
+//
+// args - json helperConfig, путь к бинарю команды и её argv.
+func runHelper(args []string) {
+	if len(args) < 3 {
+		_, _ = fmt.Fprintln(os.Stderr, "sandbox: helper argv is missing")
+		os.Exit(2)
+	}
+
+	var config helperConfig
+	if err := json.Unmarshal([]byte(args[0]), &config); err != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "sandbox: invalid helper config: %v\n", err)
+		os.Exit(2)
+	}
+
+	status := os.NewFile(uintptr(config.StatusFD), "status")
+	unix.CloseOnExec(config.StatusFD)
+
+	err := setupHelper(config)
+	if err == nil {
+		err = syscall.Exec(args[1], args[2:], os.Environ())
+	}
+
+	_, _ = io.WriteString(status, err.Error())
+	os.Exit(1)
+}
+
+func setupHelper(config helperConfig) error {
+	if len(config.ReadOnlyDirs) != 0 {
+		// Монтирования не должны протекать в mount namespace воркера.
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+			return fmt.Errorf("remount /: %w", err)
+		}
+
+		for _, dir := range config.ReadOnlyDirs {
+			if err := bindReadOnly(dir); err != nil {
+				return err
+			}
+		}
+
+		// Рабочая директория могла остаться на старом, доступном на запись, монтировании.
+		if wd, err := os.Getwd(); err == nil {
+			if err := os.Chdir(wd); err != nil {
+				return err
+			}
+		}
+	}
+
+	if config.CPUTime != 0 {
+		limit := &unix.Rlimit{Cur: config.CPUTime, Max: config.CPUTime + 1}
+		if err := unix.Setrlimit(unix.RLIMIT_CPU, limit); err != nil {
+			return fmt.Errorf("set cpu limit: %w", err)
+		}
+	}
+
+	if config.Memory != 0 {
+		limit := &unix.Rlimit{Cur: config.Memory, Max: config.Memory}
+		if err := unix.Setrlimit(unix.RLIMIT_AS, limit); err != nil {
+			return fmt.Errorf("set memory limit: %w", err)
+		}
+	}
+
+	if cred := config.Credential; cred != nil {
+		if err := syscall.Setgroups(nil); err != nil {
+			return err
+		}
+		if err := syscall.Setgid(int(cred.Gid)); err != nil {
+			return err
+		}
+		if err := syscall.Setuid(int(cred.Uid)); err != nil {
+			return err
+		}
+
+		// Смена пользователя сбрасывает parent death signal.
+		if err := unix.Prctl(unix.PR_SET_PDEATHSIG, uintptr(unix.SIGKILL), 0, 0, 0); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func bindReadOnly(dir string) error {
+	if err := unix.Mount(dir, dir, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind %s: %w", dir, err)
+	}
+
+	flags := uintptr(unix.MS_BIND | unix.MS_REMOUNT | unix.MS_RDONLY)
+	if err := unix.Mount("", dir, "", flags, ""); err != nil {
+		return fmt.Errorf("remount %s read-only: %w", dir, err)
+	}
+	return nil
+}
+
+func chownTree(dir string, uid, gid int) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return os.Lchown(path, uid, gid)
+	})
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+// nearMemoryLimit возвращает true, если максимальный RSS команды превысил 90% c.Memory.
+func (c *Config) nearMemoryLimit(cmd *exec.Cmd) bool {
+	if cmd.ProcessState == nil {
+		return false
+	}
+
+	rusage, ok := cmd.ProcessState.SysUsage().(*syscall.Rusage)
+	if !ok {
+		return false
+	}
+
+	return uint64(rusage.Maxrss)*1024 >= c.Memory/10*9
+}
+
+func (c *Config) cpuLimitExceeded(cmd *exec.Cmd) bool {
+	if c.CPUTime == 0 || cmd.ProcessState == nil {
+		return false
+	}
+
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return false
+	}
+
+	switch status.Signal() {
+	case syscall.SIGXCPU:
+		// SIGXCPU посылает только RLIMIT_CPU, а учтённое время процесса может быть
+		// чуть меньше лимита из-за округления.
+		return true
+	case syscall.SIGKILL:
+		return cmd.ProcessState.UserTime()+cmd.ProcessState.SystemTime() >= c.CPUTime
+	default:
+		return false
+	}
+}
@@ -0,0 +1,30 @@
+//go:build !linux
+
+package sandbox
+
+import (
+	"os/exec"
+)
+
+func (c *Config) prepare(cmd *exec.Cmd, outputDir string, readOnlyDirs []string) (started func(error) error, err error) {
+	if c.User != "" || c.Namespaces || c.CPUTime != 0 || c.Memory != 0 {
+		return nil, ErrUnsupported
+	}
+	return func(err error) error { return err }, nil
+}
+
+func runHelper(args []string) {
+	panic(ErrUnsupported)
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = cmd.Process.Kill()
+}
+
+func (c *Config) nearMemoryLimit(cmd *exec.Cmd) bool {
+	return false
+}
+
+func (c *Config) cpuLimitExceeded(cmd *exec.Cmd) bool {
+	return false
+}
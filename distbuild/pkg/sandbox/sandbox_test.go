@@ -0,0 +1,177 @@
+//go:build linux
+
+package sandbox_test
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/sandbox"
+)
+
+const allocEnv = "SANDBOX_TEST_ALLOC"
+
+func TestMain(m *testing.M) {
+	sandbox.Init()
+
+	// Выделяет память в песочнице для TestMemoryLimit.
+	if os.Getenv(allocEnv) != "" {
+		b := make([]byte, 4<<30)
+		for i := 0; i < len(b); i += 4096 {
+			b[i] = 1
+		}
+		os.Exit(0)
+	}
+
+	os.Exit(m.Run())
+}
+
+func TestClearEnviron(t *testing.T) {
+	t.Setenv("DISTBUILD_SECRET", "foo")
+
+	var stdout bytes.Buffer
+	cmd := exec.Command("/usr/bin/env")
+	cmd.Stdout = &stdout
+
+	var c sandbox.Config
+	require.NoError(t, c.Run(context.Background(), cmd, ""))
+	require.Empty(t, stdout.String())
+}
+
+func TestWallClockLimit(t *testing.T) {
+	c := sandbox.Config{WallClock: 100 * time.Millisecond}
+
+	start := time.Now()
+	err := c.Run(context.Background(), exec.Command("sleep", "10"), "")
+
+	var limitErr *sandbox.LimitError
+	require.Truef(t, errors.As(err, &limitErr), "%v", err)
+	require.Equal(t, "wall-clock", limitErr.Limit)
+	require.Less(t, time.Since(start), 5*time.Second)
+}
+
+func TestCPULimit(t *testing.T) {
+	if testing.Short() {
+		t.Skip("burns cpu")
+	}
+
+	c := sandbox.Config{CPUTime: time.Second, WallClock: 10 * time.Second}
+
+	err := c.Run(context.Background(), exec.Command("sh", "-c", "while :; do :; done"), "")
+
+	var limitErr *sandbox.LimitError
+	require.Truef(t, errors.As(err, &limitErr), "%v", err)
+	require.Equal(t, "cpu time", limitErr.Limit)
+}
+
+func TestContextCancel(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	var c sandbox.Config
+	err := c.Run(ctx, exec.Command("sleep", "10"), "")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+}
+
+func TestDropUser(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	root, err := os.MkdirTemp("", "sandbox")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(root) })
+	require.NoError(t, os.Chmod(root, 0755))
+
+	sourceDir := filepath.Join(root, "src")
+	outputDir := filepath.Join(root, "out")
+	require.NoError(t, os.Mkdir(sourceDir, 0755))
+	require.NoError(t, os.Mkdir(outputDir, 0755))
+
+	c := sandbox.Config{User: "nobody"}
+
+	cmd := exec.Command("touch", filepath.Join(outputDir, "a.txt"))
+	require.NoError(t, c.Run(context.Background(), cmd, outputDir))
+
+	cmd = exec.Command("touch", filepath.Join(sourceDir, "a.txt"))
+	require.Error(t, c.Run(context.Background(), cmd, outputDir))
+}
+
+func TestLimitsAppliedBeforeExec(t *testing.T) {
+	c := sandbox.Config{Memory: 1 << 30}
+
+	var stdout bytes.Buffer
+	cmd := exec.Command("sh", "-c", "ulimit -v")
+	cmd.Stdout = &stdout
+
+	require.NoError(t, c.Run(context.Background(), cmd, ""))
+	require.Equal(t, "1048576", strings.TrimSpace(stdout.String()))
+}
+
+func TestReadOnlyDirs(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	root := t.TempDir()
+	sourceDir := filepath.Join(root, "src")
+	outputDir := filepath.Join(root, "out")
+	require.NoError(t, os.Mkdir(sourceDir, 0777))
+	require.NoError(t, os.Mkdir(outputDir, 0777))
+
+	c := sandbox.Config{Namespaces: true}
+
+	cmd := exec.Command("touch", filepath.Join(outputDir, "a.txt"))
+	require.NoError(t, c.Run(context.Background(), cmd, outputDir, sourceDir))
+
+	cmd = exec.Command("touch", filepath.Join(sourceDir, "a.txt"))
+	cmd.Dir = sourceDir
+	require.Error(t, c.Run(context.Background(), cmd, outputDir, sourceDir))
+
+	cmd = exec.Command("touch", "b.txt")
+	cmd.Dir = sourceDir
+	require.Error(t, c.Run(context.Background(), cmd, outputDir, sourceDir))
+
+	require.NoFileExists(t, filepath.Join(sourceDir, "a.txt"))
+	require.NoFileExists(t, filepath.Join(sourceDir, "b.txt"))
+}
+
+func TestSetupError(t *testing.T) {
+	if os.Getuid() != 0 {
+		t.Skip("test requires root")
+	}
+
+	c := sandbox.Config{Namespaces: true}
+
+	cmd := exec.Command("true")
+	err := c.Run(context.Background(), cmd, "", filepath.Join(t.TempDir(), "missing"))
+	require.ErrorContains(t, err, "sandbox:")
+}
+
+func TestMemoryLimit(t *testing.T) {
+	c := sandbox.Config{Memory: 2 << 30}
+
+	self, err := os.Executable()
+	require.NoError(t, err)
+
+	var stderr bytes.Buffer
+	cmd := exec.Command(self)
+	cmd.Env = []string{allocEnv + "=1"}
+	cmd.Stderr = &stderr
+
+	err = c.Run(context.Background(), cmd, "")
+
+	var limitErr *sandbox.LimitError
+	require.Truef(t, errors.As(err, &limitErr), "%v: %s", err, stderr.String())
+	require.Equal(t, "memory", limitErr.Limit)
+	require.Contains(t, stderr.String(), "out of memory", "stderr is still passed to the caller")
+}
@@ -0,0 +1,137 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+)
+
+// ErrWorkerLost записывается в JobResult.Error джоба, который исчерпал Config.MaxRetries.
+var ErrWorkerLost = errors.New("worker lost")
+
+// Liveness отслеживает воркеров по времени последнего heartbeat-а.
+//
+// Воркер считается потерянным, если от него не было heartbeat-а дольше timeout.
+// Пока обрабатывается heartbeat воркера, отсчёт продлевается на longPoll: столько heartbeat
+// может ждать джоб в PickJob. Heartbeat, который висит дольше, значит, что соединение с воркером
+// оборвалось, а координатор этого не заметил.
+type Liveness struct {
+	timeout  time.Duration
+	longPoll time.Duration
+	now      func() time.Time
+
+	mu      sync.Mutex
+	workers map[api.WorkerID]*liveWorker
+}
+
+type liveWorker struct {
+	lastSeen time.Time
+	inFlight int
+}
+
+// NewLiveness паникует, если timeout не положительный или longPoll отрицательный.
+func NewLiveness(timeout, longPoll time.Duration, now func() time.Time) *Liveness {
+	if timeout <= 0 {
+		panic("scheduler: liveness timeout must be positive")
+	}
+	if longPoll < 0 {
+		panic("scheduler: long poll timeout must not be negative")
+	}
+
+	return &Liveness{
+		timeout:  timeout,
+		longPoll: longPoll,
+		now:      now,
+		workers:  map[api.WorkerID]*liveWorker{},
+	}
+}
+
+// Heartbeat отмечает начало обработки heartbeat-а воркера. Возвращает true, если воркер
+// раньше не был известен или уже был объявлен потерянным.
+//
+// Пока heartbeat не завершён через HeartbeatDone, воркер считается потерянным только
+// через timeout+longPoll: heartbeat может ждать джоб в PickJob дольше timeout.
+func (l *Liveness) Heartbeat(workerID api.WorkerID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, known := l.workers[workerID]
+	if !known {
+		w = &liveWorker{}
+		l.workers[workerID] = w
+	}
+
+	w.lastSeen = l.now()
+	w.inFlight++
+	return !known
+}
+
+// HeartbeatDone отмечает завершение heartbeat-а, начатого вызовом Heartbeat.
+// Отсчёт timeout начинается заново с момента завершения.
+func (l *Liveness) HeartbeatDone(workerID api.WorkerID) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	w, ok := l.workers[workerID]
+	if !ok || w.inFlight == 0 {
+		return
+	}
+
+	w.lastSeen = l.now()
+	w.inFlight--
+}
+
+// Alive возвращает true, если воркер известен и ещё не объявлен потерянным.
+func (l *Liveness) Alive(workerID api.WorkerID) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, ok := l.workers[workerID]
+	return ok
+}
+
+// Expire забывает всех воркеров, от которых не было heartbeat-а дольше timeout, или дольше
+// timeout+longPoll, если у воркера есть незавершённый heartbeat, и возвращает их в отсортированном порядке.
+func (l *Liveness) Expire() []api.WorkerID {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+
+	var lost []api.WorkerID
+	for workerID, w := range l.workers {
+		timeout := l.timeout
+		if w.inFlight != 0 {
+			timeout += l.longPoll
+		}
+
+		if now.Sub(w.lastSeen) > timeout {
+			lost = append(lost, workerID)
+			delete(l.workers, workerID)
+		}
+	}
+
+	sort.Slice(lost, func(i, j int) bool { return lost[i] < lost[j] })
+	return lost
+}
+
+// Run каждые timeout/2 вызывает Expire и передаёт потерянных воркеров в onLost.
+//
+// Run возвращается после отмены ctx.
+func (l *Liveness) Run(ctx context.Context, timeAfter func(d time.Duration) <-chan time.Time, onLost func(workerID api.WorkerID)) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-timeAfter(l.timeout / 2):
+		}
+
+		for _, workerID := range l.Expire() {
+			onLost(workerID)
+		}
+	}
+}
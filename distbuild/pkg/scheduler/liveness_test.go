@@ -0,0 +1,102 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+)
+
+func TestLivenessExpire(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	l := NewLiveness(time.Second, 5*time.Second, clock.Now)
+
+	heartbeat := func(workerID api.WorkerID) bool {
+		defer l.HeartbeatDone(workerID)
+		return l.Heartbeat(workerID)
+	}
+
+	require.True(t, heartbeat("w0"))
+	require.True(t, heartbeat("w1"))
+	require.False(t, heartbeat("w0"))
+
+	clock.Advance(700 * time.Millisecond)
+	require.False(t, heartbeat("w1"))
+	require.Empty(t, l.Expire())
+
+	clock.Advance(700 * time.Millisecond)
+	require.Equal(t, []api.WorkerID{"w0"}, l.Expire())
+	require.False(t, l.Alive("w0"))
+	require.True(t, l.Alive("w1"))
+
+	require.True(t, heartbeat("w0"), "lost worker is reported as new when it comes back")
+}
+
+func TestLivenessHeartbeatInFlight(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	l := NewLiveness(time.Second, 5*time.Second, clock.Now)
+
+	require.True(t, l.Heartbeat("w0"))
+
+	clock.Advance(3 * time.Second)
+	require.Empty(t, l.Expire(), "worker waiting in PickJob is not lost")
+
+	l.HeartbeatDone("w0")
+	clock.Advance(700 * time.Millisecond)
+	require.Empty(t, l.Expire(), "timeout starts when the heartbeat finishes")
+
+	clock.Advance(700 * time.Millisecond)
+	require.Equal(t, []api.WorkerID{"w0"}, l.Expire())
+}
+
+func TestLivenessStuckHeartbeat(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	l := NewLiveness(time.Second, 5*time.Second, clock.Now)
+
+	require.True(t, l.Heartbeat("w0"))
+
+	clock.Advance(5 * time.Second)
+	require.Empty(t, l.Expire())
+
+	clock.Advance(2 * time.Second)
+	require.Equal(t, []api.WorkerID{"w0"}, l.Expire(), "heartbeat hangs longer than long poll")
+
+	// Зависший heartbeat завершился уже после потери воркера.
+	l.HeartbeatDone("w0")
+	require.False(t, l.Alive("w0"))
+}
+
+func TestLivenessZeroTimeout(t *testing.T) {
+	require.Panics(t, func() { NewLiveness(0, 0, time.Now) })
+	require.Panics(t, func() { NewLiveness(time.Second, -time.Second, time.Now) })
+}
+
+func TestLivenessRun(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	l := NewLiveness(time.Second, 5*time.Second, clock.Now)
+	l.Heartbeat("w0")
+	l.HeartbeatDone("w0")
+
+	ctx, cancel := context.WithCancel(context.Background())
+	lost := make(chan api.WorkerID, 1)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		l.Run(ctx, clock.After, func(workerID api.WorkerID) { lost <- workerID })
+	}()
+
+	for i := 0; i < 3; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(500 * time.Millisecond)
+	}
+
+	require.Equal(t, api.WorkerID("w0"), <-lost)
+
+	cancel()
+	<-done
+}
@@ -0,0 +1,24 @@
+package scheduler
+
+import (
+	"gitlab.com/slon/shad-go/distbuild/pkg/metrics"
+)
+
+// Stats описывает текущее состояние очередей планировщика.
+type Stats struct {
+	// Queued - число джобов, которые ждут воркера.
+	Queued int
+
+	// Running - число джобов, которые воркеры забрали через PickJob и ещё не завершили.
+	Running int
+}
+
+// RegisterMetrics экспортирует Stats в r.
+func (c *Scheduler) RegisterMetrics(r *metrics.Registry) {
+	r.GaugeFunc("distbuild_scheduler_queued_jobs", "Jobs waiting for a worker.", func() float64 {
+		return float64(c.Stats().Queued)
+	})
+	r.GaugeFunc("distbuild_scheduler_running_jobs", "Jobs picked by workers and not finished yet.", func() float64 {
+		return float64(c.Stats().Running)
+	})
+}
@@ -0,0 +1,149 @@
+package scheduler
+
+import (
+	"sync"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// Policy решает, какой из ожидающих джобов отдать воркеру.
+//
+// Планировщик вызывает Pick под своим локом, передавая все джобы, которые воркер может забрать,
+// в порядке их поступления. Started и Finished сообщают политике о жизненном цикле выбранного джоба.
+type Policy interface {
+	Pick(workerID api.WorkerID, queue []*PendingJob) *PendingJob
+	Started(job *PendingJob)
+	Finished(job *PendingJob)
+}
+
+// Placement сообщает политике, какие артефакты лежат в кеше воркера.
+type Placement interface {
+	HasArtifact(workerID api.WorkerID, id build.ID) bool
+}
+
+// FIFOPolicy отдаёт воркеру самый старый джоб.
+type FIFOPolicy struct{}
+
+func (FIFOPolicy) Pick(workerID api.WorkerID, queue []*PendingJob) *PendingJob {
+	if len(queue) == 0 {
+		return nil
+	}
+	return queue[0]
+}
+
+func (FIFOPolicy) Started(job *PendingJob)  {}
+func (FIFOPolicy) Finished(job *PendingJob) {}
+
+// FairPolicy делит воркеров между пользователями и сборками.
+//
+// Сначала выбирается пользователь с наименьшим числом бегущих джобов в пересчёте на его Priority,
+// затем его сборка с наименьшим числом бегущих джобов. Среди джобов этой сборки предпочтение
+// отдаётся тем, у которых больше зависимостей уже лежит в кеше воркера.
+//
+// Priority приходит от клиента, поэтому он ограничивается сверху значением SetMaxPriority.
+type FairPolicy struct {
+	placement Placement
+
+	mu          sync.Mutex
+	maxPriority int
+	userRunning map[string]int
+	running     map[build.ID]int
+}
+
+// DefaultMaxPriority - наибольший Priority, который FairPolicy учитывает по умолчанию.
+const DefaultMaxPriority = 100
+
+func NewFairPolicy(placement Placement) *FairPolicy {
+	return &FairPolicy{
+		placement:   placement,
+		maxPriority: DefaultMaxPriority,
+		userRunning: map[string]int{},
+		running:     map[build.ID]int{},
+	}
+}
+
+// SetMaxPriority задаёт наибольший Priority, который учитывает политика. Джобы с большим
+// Priority получают ту же долю, что и с maxPriority. Значения меньше единицы заменяются на единицу.
+func (p *FairPolicy) SetMaxPriority(maxPriority int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.maxPriority = max(maxPriority, 1)
+}
+
+func (p *FairPolicy) weight(job *api.JobSpec) int {
+	return min(max(job.Priority, 1), p.maxPriority)
+}
+
+func (p *FairPolicy) Pick(workerID api.WorkerID, queue []*PendingJob) *PendingJob {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var best *PendingJob
+	var bestLocality int
+
+	// less сравнивает доли двух пользователей без деления: a/wa < b/wb <=> a*wb < b*wa.
+	less := func(a, b *api.JobSpec) bool {
+		ua, ub := p.userRunning[a.User]*p.weight(b), p.userRunning[b.User]*p.weight(a)
+		if ua != ub {
+			return ua < ub
+		}
+		return p.running[a.BuildID] < p.running[b.BuildID]
+	}
+
+	for _, job := range queue {
+		locality := p.locality(workerID, job.Job)
+
+		switch {
+		case best == nil:
+		case less(job.Job, best.Job):
+		case less(best.Job, job.Job):
+			continue
+		case locality > bestLocality:
+		default:
+			continue
+		}
+
+		best, bestLocality = job, locality
+	}
+
+	return best
+}
+
+func (p *FairPolicy) locality(workerID api.WorkerID, job *api.JobSpec) int {
+	if p.placement == nil {
+		return 0
+	}
+
+	var n int
+	for _, dep := range job.Deps {
+		if p.placement.HasArtifact(workerID, dep) {
+			n++
+		}
+	}
+	return n
+}
+
+func (p *FairPolicy) Started(job *PendingJob) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.userRunning[job.Job.User]++
+	p.running[job.Job.BuildID]++
+}
+
+func (p *FairPolicy) Finished(job *PendingJob) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.userRunning[job.Job.User]--
+	if p.userRunning[job.Job.User] <= 0 {
+		delete(p.userRunning, job.Job.User)
+	}
+
+	p.running[job.Job.BuildID]--
+	if p.running[job.Job.BuildID] <= 0 {
+		delete(p.running, job.Job.BuildID)
+	}
+}
@@ -0,0 +1,118 @@
+package scheduler
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+type fakePlacement map[api.WorkerID][]build.ID
+
+func (p fakePlacement) HasArtifact(workerID api.WorkerID, id build.ID) bool {
+	for _, a := range p[workerID] {
+		if a == id {
+			return true
+		}
+	}
+	return false
+}
+
+func newPendingJob(buildID build.ID, user string, priority int, deps ...build.ID) *PendingJob {
+	return &PendingJob{
+		Job: &api.JobSpec{
+			Job:      build.Job{ID: build.NewID(), Deps: deps},
+			BuildID:  buildID,
+			User:     user,
+			Priority: priority,
+		},
+		Finished: make(chan struct{}),
+	}
+}
+
+func TestFIFOPolicy(t *testing.T) {
+	var p FIFOPolicy
+
+	require.Nil(t, p.Pick("w0", nil))
+
+	a, b := newPendingJob(build.ID{'a'}, "", 0), newPendingJob(build.ID{'b'}, "", 0)
+	require.Equal(t, a, p.Pick("w0", []*PendingJob{a, b}))
+}
+
+func TestFairPolicyBuilds(t *testing.T) {
+	p := NewFairPolicy(nil)
+
+	huge, small := build.ID{'h'}, build.ID{'s'}
+
+	var queue []*PendingJob
+	for i := 0; i < 10; i++ {
+		queue = append(queue, newPendingJob(huge, "", 0))
+	}
+	smallJob := newPendingJob(small, "", 0)
+	queue = append(queue, smallJob)
+
+	first := p.Pick("w0", queue)
+	require.Equal(t, queue[0], first)
+	p.Started(first)
+
+	require.Equal(t, smallJob, p.Pick("w0", queue[1:]))
+	p.Started(smallJob)
+
+	require.Equal(t, queue[1], p.Pick("w0", queue[1:10]))
+
+	p.Finished(first)
+	p.Finished(smallJob)
+	require.Empty(t, p.running)
+	require.Empty(t, p.userRunning)
+}
+
+func TestFairPolicyPriority(t *testing.T) {
+	p := NewFairPolicy(nil)
+
+	low := newPendingJob(build.ID{'l'}, "alice", 1)
+	high := newPendingJob(build.ID{'h'}, "bob", 2)
+
+	p.Started(newPendingJob(build.ID{'l'}, "alice", 1))
+	p.Started(newPendingJob(build.ID{'h'}, "bob", 2))
+
+	// alice: 1/1, bob: 1/2.
+	require.Equal(t, high, p.Pick("w0", []*PendingJob{low, high}))
+
+	p.Started(newPendingJob(build.ID{'h'}, "bob", 2))
+
+	// alice: 1/1, bob: 2/2.
+	require.Equal(t, low, p.Pick("w0", []*PendingJob{low, high}))
+}
+
+func TestFairPolicyMaxPriority(t *testing.T) {
+	p := NewFairPolicy(nil)
+	p.SetMaxPriority(2)
+
+	honest := newPendingJob(build.ID{'h'}, "alice", 2)
+	greedy := newPendingJob(build.ID{'g'}, "bob", math.MaxInt)
+
+	for i := 0; i < 2; i++ {
+		p.Started(newPendingJob(build.ID{'h'}, "alice", 2))
+		p.Started(newPendingJob(build.ID{'g'}, "bob", math.MaxInt))
+	}
+	p.Started(newPendingJob(build.ID{'g'}, "bob", math.MaxInt))
+
+	// alice: 2/2, bob: 3/2, а не 3/MaxInt.
+	require.Equal(t, honest, p.Pick("w0", []*PendingJob{greedy, honest}))
+}
+
+func TestFairPolicyLocality(t *testing.T) {
+	dep := build.ID{'d'}
+	p := NewFairPolicy(fakePlacement{"w1": {dep}})
+
+	buildID := build.ID{'b'}
+	remote := newPendingJob(buildID, "", 0)
+	local := newPendingJob(buildID, "", 0, dep)
+
+	queue := []*PendingJob{remote, local}
+	require.Equal(t, remote, p.Pick("w0", queue))
+	require.Equal(t, local, p.Pick("w1", queue))
+}
@@ -0,0 +1,103 @@
+package scheduler
+
+import (
+	"errors"
+	"sync"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// ErrNoSuitableWorker записывается в JobResult.Error джоба, требования которого не может выполнить ни один воркер.
+var ErrNoSuitableWorker = errors.New("no worker can satisfy job requirements")
+
+type workerResources struct {
+	total build.Resources
+	used  build.Resources
+}
+
+// Pool учитывает ресурсы воркеров: сколько ресурсов воркер сообщил в heartbeat-е
+// и сколько из них занято джобами, которые он забрал.
+//
+// Все методы Pool безопасно вызывать из нескольких горутин.
+type Pool struct {
+	mu      sync.Mutex
+	workers map[api.WorkerID]*workerResources
+}
+
+func NewPool() *Pool {
+	return &Pool{workers: map[api.WorkerID]*workerResources{}}
+}
+
+// Update запоминает ресурсы воркера из очередного heartbeat-а. Занятые ресурсы при этом сохраняются.
+func (p *Pool) Update(workerID api.WorkerID, total build.Resources) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w, ok := p.workers[workerID]
+	if !ok {
+		w = &workerResources{}
+		p.workers[workerID] = w
+	}
+	w.total = total
+}
+
+// Remove забывает воркера, например когда он потерян.
+func (p *Pool) Remove(workerID api.WorkerID) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	delete(p.workers, workerID)
+}
+
+// Fits возвращает true, если у воркера сейчас достаточно свободных ресурсов для req.
+func (p *Pool) Fits(workerID api.WorkerID, req build.Resources) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w, ok := p.workers[workerID]
+	return ok && w.total.Sub(w.used).Fits(req)
+}
+
+// Acquire занимает ресурсы req на воркере. Возвращает false, если ресурсов не хватает.
+func (p *Pool) Acquire(workerID api.WorkerID, req build.Resources) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	w, ok := p.workers[workerID]
+	if !ok || !w.total.Sub(w.used).Fits(req) {
+		return false
+	}
+
+	w.used = w.used.Add(req)
+	return true
+}
+
+// Release освобождает ресурсы, занятые Acquire.
+func (p *Pool) Release(workerID api.WorkerID, req build.Resources) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if w, ok := p.workers[workerID]; ok {
+		w.used = w.used.Sub(req)
+	}
+}
+
+// Satisfiable возвращает true, если req помещается хотя бы в одного известного воркера, когда тот свободен.
+//
+// Пока не известно ни одного воркера, любые требования считаются выполнимыми.
+func (p *Pool) Satisfiable(req build.Resources) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.workers) == 0 {
+		return true
+	}
+
+	for _, w := range p.workers {
+		if w.total.Fits(req) {
+			return true
+		}
+	}
+	return false
+}
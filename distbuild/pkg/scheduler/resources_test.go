@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+func TestPool(t *testing.T) {
+	p := NewPool()
+
+	link := build.Resources{CPU: 2, Memory: 4 << 30}
+	race := build.Resources{CPU: 1, Tags: []string{"race"}}
+
+	require.True(t, p.Satisfiable(link), "requirements are satisfiable until some worker is known")
+	require.False(t, p.Fits("w0", build.Resources{}), "unknown worker fits nothing")
+
+	p.Update("w0", build.Resources{CPU: 3, Memory: 8 << 30})
+	p.Update("w1", build.Resources{CPU: 1, Tags: []string{"race"}})
+
+	require.True(t, p.Satisfiable(link))
+	require.True(t, p.Satisfiable(race))
+	require.False(t, p.Satisfiable(build.Resources{CPU: 2, Tags: []string{"race"}}))
+
+	require.True(t, p.Acquire("w0", link))
+	require.False(t, p.Fits("w0", link))
+	require.False(t, p.Acquire("w0", link))
+	require.True(t, p.Fits("w0", build.Resources{CPU: 1}))
+	require.False(t, p.Fits("w0", race))
+
+	p.Update("w0", build.Resources{CPU: 4, Memory: 8 << 30})
+	require.True(t, p.Acquire("w0", link), "heartbeat keeps used resources")
+	require.False(t, p.Fits("w0", build.Resources{CPU: 1}))
+
+	p.Release("w0", link)
+	p.Release("w0", link)
+	require.True(t, p.Fits("w0", build.Resources{CPU: 4}))
+
+	p.Remove("w1")
+	require.False(t, p.Satisfiable(race))
+	require.False(t, p.Acquire("w1", race))
+}
@@ -0,0 +1,65 @@
+package scheduler
+
+import (
+	"sync"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// ArtifactLocator реализуется *Scheduler.
+type ArtifactLocator interface {
+	LocateArtifact(id build.ID) (api.WorkerID, bool)
+}
+
+// ResultCache запоминает stdout, stderr и код возврата успешно завершившихся джобов.
+//
+// Поскольку выход джоба целиком определяется его ID, координатор может не запускать
+// джоб повторно, если результат есть в ResultCache, а артефакт лежит в кеше хотя бы одного воркера.
+type ResultCache struct {
+	mu      sync.Mutex
+	results map[build.ID]*api.JobResult
+}
+
+func NewResultCache() *ResultCache {
+	return &ResultCache{results: map[build.ID]*api.JobResult{}}
+}
+
+// Add сохраняет результат джоба. Результаты упавших джобов не кешируются.
+func (c *ResultCache) Add(res *api.JobResult) {
+	if res.Error != nil || res.ExitCode != 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.results[res.ID] = res
+}
+
+func (c *ResultCache) Forget(jobID build.ID) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.results, jobID)
+}
+
+// Lookup возвращает закешированный результат джоба, если артефакт джоба всё ещё
+// есть хотя бы на одном воркере. Возвращённый результат помечен как Cached.
+func (c *ResultCache) Lookup(l ArtifactLocator, jobID build.ID) (*api.JobResult, bool) {
+	c.mu.Lock()
+	res, ok := c.results[jobID]
+	c.mu.Unlock()
+
+	if !ok {
+		return nil, false
+	}
+
+	if _, ok := l.LocateArtifact(jobID); !ok {
+		return nil, false
+	}
+
+	cached := *res
+	cached.Cached = true
+	return &cached, true
+}
@@ -0,0 +1,44 @@
+package scheduler
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+type fakeLocator map[build.ID]api.WorkerID
+
+func (l fakeLocator) LocateArtifact(id build.ID) (api.WorkerID, bool) {
+	w, ok := l[id]
+	return w, ok
+}
+
+func TestResultCache(t *testing.T) {
+	c := NewResultCache()
+
+	okJob, failedJob, evictedJob := build.ID{'a'}, build.ID{'b'}, build.ID{'c'}
+	errorMsg := "exit status 1"
+
+	c.Add(&api.JobResult{ID: okJob, Stdout: []byte("OK\n")})
+	c.Add(&api.JobResult{ID: failedJob, ExitCode: 1, Error: &errorMsg})
+	c.Add(&api.JobResult{ID: evictedJob})
+
+	l := fakeLocator{okJob: "w0", failedJob: "w0"}
+
+	res, ok := c.Lookup(l, okJob)
+	require.True(t, ok)
+	require.Equal(t, &api.JobResult{ID: okJob, Stdout: []byte("OK\n"), Cached: true}, res)
+
+	_, ok = c.Lookup(l, failedJob)
+	require.False(t, ok)
+
+	_, ok = c.Lookup(l, evictedJob)
+	require.False(t, ok)
+
+	c.Forget(okJob)
+	_, ok = c.Lookup(l, okJob)
+	require.False(t, ok)
+}
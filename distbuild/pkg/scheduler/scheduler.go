@@ -21,6 +21,19 @@ type PendingJob struct {
 type Config struct {
 	CacheTimeout time.Duration
 	DepsTimeout  time.Duration
+
+	// Policy выбирает джоб из очереди в PickJob. nil означает FIFOPolicy.
+	Policy Policy
+
+	// MaxRetries ограничивает число перезапусков джоба после потери воркера, который его выполнял.
+	MaxRetries int
+
+	// LivenessTimeout - через сколько после последнего heartbeat-а воркер считается потерянным, см. Liveness.
+	LivenessTimeout time.Duration
+
+	// HeartbeatPoll ограничивает, сколько heartbeat ждёт джоб в PickJob. По его истечении координатор
+	// отвечает воркеру без новых джобов. Незавершённый heartbeat продлевает LivenessTimeout на HeartbeatPoll.
+	HeartbeatPoll time.Duration
 }
 
 type Scheduler struct {
@@ -34,18 +47,59 @@ func (c *Scheduler) LocateArtifact(id build.ID) (api.WorkerID, bool) {
 	panic("implement me")
 }
 
+// LocateArtifacts возвращает всех воркеров, у которых в кеше есть артефакт id.
+func (c *Scheduler) LocateArtifacts(id build.ID) []api.WorkerID {
+	panic("implement me")
+}
+
 func (c *Scheduler) OnJobComplete(workerID api.WorkerID, jobID build.ID, res *api.JobResult) bool {
 	panic("implement me")
 }
 
+// OnArtifactRemoved сообщает планировщику, что артефакт удалён из кеша воркера.
+func (c *Scheduler) OnArtifactRemoved(workerID api.WorkerID, id build.ID) {
+	panic("implement me")
+}
+
+// OnWorkerLost вызывается, когда воркер перестал присылать heartbeat-ы.
+//
+// Все артефакты воркера забываются. Джобы, которые воркер забрал через PickJob и не успел завершить,
+// снова ставятся в очередь. Если джоб терял воркера больше Config.MaxRetries раз, его PendingJob
+// завершается результатом, в Error которого записан текст ErrWorkerLost.
+func (c *Scheduler) OnWorkerLost(workerID api.WorkerID) {
+	panic("implement me")
+}
+
+// UpdateWorker запоминает ресурсы воркера из HeartbeatRequest.Resources.
+func (c *Scheduler) UpdateWorker(workerID api.WorkerID, resources build.Resources) {
+	panic("implement me")
+}
+
+// Satisfiable возвращает true, если хотя бы один известный воркер может выполнить джоб с требованиями req.
+func (c *Scheduler) Satisfiable(req build.Resources) bool {
+	panic("implement me")
+}
+
 func (c *Scheduler) ScheduleJob(job *api.JobSpec) *PendingJob {
 	panic("implement me")
 }
 
+// CancelJob убирает джоб из всех очередей, если его ещё никто не забрал.
+//
+// Возвращает false, если джоб уже выполняется на воркере или неизвестен планировщику.
+func (c *Scheduler) CancelJob(jobID build.ID) bool {
+	panic("implement me")
+}
+
 func (c *Scheduler) PickJob(ctx context.Context, workerID api.WorkerID) *PendingJob {
 	panic("implement me")
 }
 
+// Stats возвращает размер очередей планировщика. Метод вызывается при каждом чтении /metrics.
+func (c *Scheduler) Stats() Stats {
+	panic("implement me")
+}
+
 func (c *Scheduler) Stop() {
 	panic("implement me")
 }
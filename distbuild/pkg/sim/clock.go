@@ -0,0 +1,58 @@
+package sim
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// Clock - виртуальные часы симуляции.
+//
+// Clock запоминает сроки всех таймеров, созданных через After. Поэтому симуляция знает, когда
+// сработает ближайший таймер планировщика, и переводит часы сразу к нему.
+type Clock struct {
+	clockwork.FakeClock
+
+	mu        sync.Mutex
+	deadlines []time.Time
+}
+
+func NewClock() *Clock {
+	return &Clock{FakeClock: clockwork.NewFakeClockAt(time.Unix(0, 0))}
+}
+
+// After нужно передать в scheduler.NewScheduler вместо time.After.
+func (c *Clock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// Таймер создаётся под локом, чтобы его срок считался от того же Now, что и в FakeClock.
+	deadline := c.Now().Add(d)
+	i := sort.Search(len(c.deadlines), func(i int) bool { return c.deadlines[i].After(deadline) })
+	c.deadlines = append(c.deadlines, time.Time{})
+	copy(c.deadlines[i+1:], c.deadlines[i:])
+	c.deadlines[i] = deadline
+
+	return c.FakeClock.After(d)
+}
+
+// nextDeadline возвращает ближайший срок таймера позже текущего времени и забывает уже прошедшие.
+//
+// Таймер, который планировщик перестал ждать, остаётся в списке. Симуляция в худшем случае
+// сделает лишний шаг.
+func (c *Clock) nextDeadline() (time.Time, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.Now()
+	for len(c.deadlines) != 0 && !c.deadlines[0].After(now) {
+		c.deadlines = c.deadlines[1:]
+	}
+
+	if len(c.deadlines) == 0 {
+		return time.Time{}, false
+	}
+	return c.deadlines[0], true
+}
@@ -0,0 +1,78 @@
+package sim
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"math/rand"
+	"time"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+)
+
+// GraphConfig описывает синтетический граф сборки.
+type GraphConfig struct {
+	// Seed задаёт граф: одинаковый GraphConfig всегда порождает одинаковый граф.
+	Seed int64
+
+	Jobs int
+
+	// MaxDeps ограничивает число зависимостей одного джоба.
+	MaxDeps int
+
+	// Window - из скольких предыдущих джобов выбираются зависимости. Маленькое окно даёт
+	// длинные цепочки, большое - широкий граф. 0 означает все предыдущие джобы.
+	Window int
+}
+
+// Generate строит ацикличный граф из cfg.Jobs джобов. Зависимости каждого джоба выбираются
+// случайно среди cfg.Window предыдущих.
+func Generate(cfg GraphConfig) build.Graph {
+	rng := rand.New(rand.NewSource(cfg.Seed))
+
+	var g build.Graph
+	for i := 0; i < cfg.Jobs; i++ {
+		job := build.Job{
+			ID:   jobID(cfg.Seed, i),
+			Name: fmt.Sprintf("job-%d", i),
+		}
+
+		lo := 0
+		if cfg.Window > 0 && i > cfg.Window {
+			lo = i - cfg.Window
+		}
+
+		if i > lo && cfg.MaxDeps > 0 {
+			seen := map[int]bool{}
+			for n := rng.Intn(cfg.MaxDeps + 1); n > 0; n-- {
+				dep := lo + rng.Intn(i-lo)
+				if !seen[dep] {
+					seen[dep] = true
+					job.Deps = append(job.Deps, g.Jobs[dep].ID)
+				}
+			}
+		}
+
+		g.Jobs = append(g.Jobs, job)
+	}
+
+	return g
+}
+
+func jobID(seed int64, i int) build.ID {
+	var buf [16]byte
+	binary.LittleEndian.PutUint64(buf[:8], uint64(seed))
+	binary.LittleEndian.PutUint64(buf[8:], uint64(i))
+	return sha1.Sum(buf[:])
+}
+
+// RandomDuration возвращает функцию для Config.Duration, которая выдаёт каждому джобу
+// время выполнения из [lo, hi). Время зависит только от ID джоба.
+func RandomDuration(lo, hi time.Duration) func(job *build.Job) time.Duration {
+	return func(job *build.Job) time.Duration {
+		if hi <= lo {
+			return lo
+		}
+		return lo + time.Duration(binary.LittleEndian.Uint64(job.ID[:8])%uint64(hi-lo))
+	}
+}
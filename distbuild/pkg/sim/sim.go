@@ -0,0 +1,591 @@
+package sim
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+)
+
+// Scheduler - часть интерфейса scheduler.Scheduler, которой пользуется симуляция.
+type Scheduler interface {
+	ScheduleJob(job *api.JobSpec) *scheduler.PendingJob
+	PickJob(ctx context.Context, workerID api.WorkerID) *scheduler.PendingJob
+	OnJobComplete(workerID api.WorkerID, jobID build.ID, res *api.JobResult) bool
+	OnWorkerLost(workerID api.WorkerID)
+	UpdateWorker(workerID api.WorkerID, resources build.Resources)
+}
+
+var _ Scheduler = (*scheduler.Scheduler)(nil)
+
+// ErrStalled возвращается из Run, если остались невыполненные джобы, но в симуляции больше ничего не произойдёт.
+var ErrStalled = errors.New("sim: simulation stalled")
+
+// WorkerConfig описывает фейкового воркера.
+type WorkerConfig struct {
+	ID api.WorkerID
+
+	// Slots - сколько джобов воркер выполняет одновременно. 0 означает 1.
+	Slots int
+
+	// Resources передаются в Scheduler.UpdateWorker, когда воркер подключается.
+	Resources build.Resources
+}
+
+// Action - событие сценария симуляции. Должно быть заполнено ровно одно из полей Join и Stop.
+type Action struct {
+	// At - время события от начала симуляции.
+	At time.Duration
+
+	// Join подключает воркера. Повторный Join того же воркера обновляет его ресурсы, как очередной heartbeat.
+	Join *WorkerConfig
+
+	// Stop останавливает воркера: джобы на нём больше не завершаются, а через Config.HeartbeatTimeout
+	// координатор вызывает Scheduler.OnWorkerLost.
+	Stop api.WorkerID
+}
+
+// Build - сборка, которую клиент отправляет координатору.
+type Build struct {
+	ID       build.ID
+	User     string
+	Priority int
+
+	Graph build.Graph
+
+	// SubmitAt - время от начала симуляции, когда сборка приходит на координатор.
+	SubmitAt time.Duration
+}
+
+type Config struct {
+	// Workers подключаются в начале симуляции.
+	Workers []WorkerConfig
+
+	// Script - дополнительные события: подключение и потеря воркеров.
+	Script []Action
+
+	// HeartbeatTimeout - через сколько после Action.Stop координатор замечает потерю воркера.
+	HeartbeatTimeout time.Duration
+
+	// Duration возвращает время выполнения джоба. nil означает одну секунду на каждый джоб.
+	Duration func(job *build.Job) time.Duration
+
+	// Settle - сколько реального времени воркер ждёт в PickJob, прежде чем решить, что джобов для него нет.
+	// 0 означает 2ms.
+	Settle time.Duration
+
+	// MaxTime ограничивает виртуальное время симуляции. 0 означает отсутствие ограничения.
+	MaxTime time.Duration
+}
+
+// JobRun описывает выполнение одного джоба. Все времена отсчитываются от начала симуляции.
+type JobRun struct {
+	Worker api.WorkerID
+
+	Scheduled, Started, Finished time.Duration
+
+	// Attempts - сколько раз воркеры забирали джоб через PickJob.
+	Attempts int
+
+	// Error не пустой, если джоб завершился с ошибкой или упала одна из его зависимостей.
+	Error string
+}
+
+type EventKind string
+
+const (
+	EventJoin     EventKind = "join"
+	EventStop     EventKind = "stop"
+	EventLost     EventKind = "lost"
+	EventSchedule EventKind = "schedule"
+	EventStart    EventKind = "start"
+	EventFinish   EventKind = "finish"
+	EventFail     EventKind = "fail"
+)
+
+// Event - запись трассы симуляции.
+type Event struct {
+	At     time.Duration
+	Kind   EventKind
+	Worker api.WorkerID
+	Job    string
+}
+
+func (e Event) String() string {
+	return fmt.Sprintf("%12v %-8s %-10s %s", e.At, e.Kind, e.Worker, e.Job)
+}
+
+type Result struct {
+	// Makespan - время от начала симуляции до завершения последнего джоба.
+	Makespan time.Duration
+
+	Jobs map[build.ID]*JobRun
+
+	// Trace содержит все события симуляции в порядке их обработки.
+	//
+	// Для детерминированного планировщика Trace одинаковый при каждом запуске с тем же Config,
+	// поэтому найденную в симуляции ошибку планирования можно воспроизвести.
+	Trace []Event
+
+	// Busy - суммарное время, которое слоты воркера выполняли джобы, включая джобы, потерянные вместе с воркером.
+	Busy map[api.WorkerID]time.Duration
+}
+
+// Failed возвращает число джобов, завершившихся с ошибкой.
+func (r *Result) Failed() int {
+	var n int
+	for _, run := range r.Jobs {
+		if run.Error != "" {
+			n++
+		}
+	}
+	return n
+}
+
+type jobState struct {
+	spec  *api.JobSpec
+	order int
+
+	deps       int
+	dependents []*jobState
+
+	pending *scheduler.PendingJob
+	run     *JobRun
+
+	worker  *workerState
+	attempt int
+	done    bool
+}
+
+type workerState struct {
+	WorkerConfig
+
+	joined, stopped bool
+	running         map[*jobState]struct{}
+}
+
+func (w *workerState) slots() int {
+	if w.Slots <= 0 {
+		return 1
+	}
+	return w.Slots
+}
+
+// timed - событие на временной шкале симуляции. События с одинаковым at выполняются в порядке добавления.
+type timed struct {
+	at time.Time
+	do func() error
+}
+
+// Simulation запускает координатор и фейковых воркеров поверх Scheduler на виртуальных часах.
+//
+// Воркеры не запускают команд: джоб "выполняется" Config.Duration виртуального времени. Симуляция
+// переводит часы сразу к ближайшему событию: завершению джоба, событию сценария или таймеру планировщика.
+// Воркеры вызывают PickJob по очереди, поэтому результат зависит только от Config и планировщика.
+type Simulation struct {
+	sched Scheduler
+	clock *Clock
+	cfg   Config
+
+	start    time.Time
+	jobs     map[build.ID]*jobState
+	workers  map[api.WorkerID]*workerState
+	order    []*workerState
+	timeline []timed
+	round    int
+
+	// waiting - джобы, переданные в ScheduleJob, которые ещё никто не забрал.
+	waiting map[*jobState]struct{}
+	// left - число джобов, которые ещё не завершились.
+	left int
+
+	res *Result
+}
+
+// New создаёт симуляцию. sched должен быть создан с таймерами clock.After.
+func New(sched Scheduler, clock *Clock, cfg Config) *Simulation {
+	if cfg.Duration == nil {
+		cfg.Duration = func(*build.Job) time.Duration { return time.Second }
+	}
+	if cfg.Settle == 0 {
+		cfg.Settle = 2 * time.Millisecond
+	}
+
+	return &Simulation{
+		sched:   sched,
+		clock:   clock,
+		cfg:     cfg,
+		jobs:    map[build.ID]*jobState{},
+		workers: map[api.WorkerID]*workerState{},
+		waiting: map[*jobState]struct{}{},
+		res: &Result{
+			Jobs: map[build.ID]*JobRun{},
+			Busy: map[api.WorkerID]time.Duration{},
+		},
+	}
+}
+
+func (s *Simulation) now() time.Duration {
+	return s.clock.Now().Sub(s.start)
+}
+
+func (s *Simulation) trace(kind EventKind, w *workerState, js *jobState) {
+	e := Event{At: s.now(), Kind: kind}
+	if w != nil {
+		e.Worker = w.ID
+	}
+	if js != nil {
+		e.Job = js.spec.Name
+	}
+	s.res.Trace = append(s.res.Trace, e)
+}
+
+func (s *Simulation) at(d time.Duration, do func() error) {
+	t := timed{at: s.start.Add(d), do: do}
+
+	i := sort.Search(len(s.timeline), func(i int) bool { return s.timeline[i].at.After(t.at) })
+	s.timeline = append(s.timeline, timed{})
+	copy(s.timeline[i+1:], s.timeline[i:])
+	s.timeline[i] = t
+}
+
+// Run выполняет сборки builds и возвращает результат симуляции.
+//
+// Ошибка возвращается, если планировщик нарушил контракт (например, отдал один джоб двум воркерам),
+// если симуляция зависла или если отменён ctx. В этом случае Result содержит трассу до момента ошибки.
+// Неуспешные джобы ошибкой Run не считаются, они описаны в Result.Jobs.
+func (s *Simulation) Run(ctx context.Context, builds ...Build) (*Result, error) {
+	s.start = s.clock.Now()
+
+	for i := range s.cfg.Workers {
+		w := s.cfg.Workers[i]
+		s.at(0, func() error { return s.join(w) })
+	}
+
+	for i := range s.cfg.Script {
+		a := s.cfg.Script[i]
+		switch {
+		case a.Join != nil && a.Stop == "":
+			s.at(a.At, func() error { return s.join(*a.Join) })
+		case a.Join == nil && a.Stop != "":
+			s.at(a.At, func() error { return s.stop(a.Stop) })
+		default:
+			return s.res, fmt.Errorf("sim: action at %v must set exactly one of Join and Stop", a.At)
+		}
+	}
+
+	for i := range builds {
+		b := &builds[i]
+		if err := s.addBuild(b); err != nil {
+			return s.res, err
+		}
+		s.at(b.SubmitAt, func() error { return s.submit(b) })
+	}
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return s.res, err
+		}
+
+		s.collectFailed()
+
+		if _, err := s.poll(ctx); err != nil {
+			return s.res, err
+		}
+
+		if s.left == 0 {
+			return s.res, nil
+		}
+
+		deadline, timer := s.clock.nextDeadline()
+
+		var next time.Time
+		switch {
+		case len(s.timeline) != 0 && (!timer || !deadline.Before(s.timeline[0].at)):
+			next = s.timeline[0].at
+			timer = timer && deadline.Equal(next)
+		case timer:
+			next = deadline
+		default:
+			// Таймеры планировщика могли сработать уже после последнего PickJob.
+			time.Sleep(s.cfg.Settle)
+			if s.collectFailed() {
+				continue
+			}
+
+			picked, err := s.poll(ctx)
+			if err != nil {
+				return s.res, err
+			} else if picked != 0 {
+				continue
+			}
+
+			return s.res, fmt.Errorf("%w: %d jobs left at %v", ErrStalled, s.left, s.now())
+		}
+
+		if s.cfg.MaxTime != 0 && next.Sub(s.start) > s.cfg.MaxTime {
+			return s.res, fmt.Errorf("%w: %d jobs left at MaxTime %v", ErrStalled, s.left, s.cfg.MaxTime)
+		}
+
+		if d := next.Sub(s.clock.Now()); d > 0 {
+			s.clock.Advance(d)
+		}
+
+		if timer {
+			// Даём горутинам планировщика обработать сработавшие таймеры.
+			time.Sleep(s.cfg.Settle)
+		}
+
+		for len(s.timeline) != 0 && !s.timeline[0].at.After(s.clock.Now()) {
+			t := s.timeline[0]
+			s.timeline = s.timeline[1:]
+
+			if err := t.do(); err != nil {
+				return s.res, err
+			}
+		}
+	}
+}
+
+func (s *Simulation) addBuild(b *Build) error {
+	for _, job := range build.TopSort(b.Graph.Jobs) {
+		if _, ok := s.jobs[job.ID]; ok {
+			return fmt.Errorf("sim: duplicate job %s", job.ID)
+		}
+
+		js := &jobState{
+			spec: &api.JobSpec{
+				BuildID:  b.ID,
+				User:     b.User,
+				Priority: b.Priority,
+				Job:      job,
+			},
+			order: len(s.jobs),
+			run:   &JobRun{},
+		}
+
+		for _, dep := range job.Deps {
+			d, ok := s.jobs[dep]
+			if !ok {
+				return fmt.Errorf("sim: job %s depends on unknown job %s", job.Name, dep)
+			}
+
+			js.deps++
+			d.dependents = append(d.dependents, js)
+		}
+
+		s.jobs[job.ID] = js
+		s.res.Jobs[job.ID] = js.run
+		s.left++
+	}
+
+	return nil
+}
+
+func (s *Simulation) submit(b *Build) error {
+	for _, job := range b.Graph.Jobs {
+		if js := s.jobs[job.ID]; js.deps == 0 {
+			s.schedule(js)
+		}
+	}
+	return nil
+}
+
+// schedule передаёт джоб в планировщик, как это делает координатор, когда все зависимости джоба готовы.
+func (s *Simulation) schedule(js *jobState) {
+	js.pending = s.sched.ScheduleJob(js.spec)
+	js.run.Scheduled = s.now()
+	s.waiting[js] = struct{}{}
+	s.trace(EventSchedule, nil, js)
+}
+
+func (s *Simulation) join(cfg WorkerConfig) error {
+	w, ok := s.workers[cfg.ID]
+	if !ok {
+		w = &workerState{running: map[*jobState]struct{}{}}
+		s.workers[cfg.ID] = w
+		s.order = append(s.order, w)
+		sort.Slice(s.order, func(i, j int) bool { return s.order[i].ID < s.order[j].ID })
+	} else if w.stopped && len(w.running) != 0 {
+		return fmt.Errorf("sim: worker %s rejoined before it was declared lost", cfg.ID)
+	}
+
+	w.WorkerConfig = cfg
+	w.joined, w.stopped = true, false
+
+	s.sched.UpdateWorker(w.ID, w.Resources)
+	s.trace(EventJoin, w, nil)
+	return nil
+}
+
+func (s *Simulation) stop(id api.WorkerID) error {
+	w, ok := s.workers[id]
+	if !ok || !w.joined {
+		return fmt.Errorf("sim: stop of unknown worker %s", id)
+	}
+
+	w.joined, w.stopped = false, true
+	s.trace(EventStop, w, nil)
+
+	for js := range w.running {
+		s.res.Busy[w.ID] += s.now() - js.run.Started
+	}
+
+	s.at(s.now()+s.cfg.HeartbeatTimeout, func() error {
+		if !w.stopped {
+			return nil
+		}
+
+		// Незавершённые джобы планировщик должен поставить в очередь заново.
+		for js := range w.running {
+			js.worker = nil
+			s.waiting[js] = struct{}{}
+		}
+		w.running = map[*jobState]struct{}{}
+		w.stopped = false
+
+		s.sched.OnWorkerLost(w.ID)
+		s.trace(EventLost, w, nil)
+		return nil
+	})
+
+	return nil
+}
+
+// poll опрашивает свободных воркеров, начиная каждый раз со следующего, чтобы не отдавать предпочтения одному из них.
+// Возвращает число забранных джобов.
+func (s *Simulation) poll(ctx context.Context) (int, error) {
+	if len(s.order) == 0 {
+		return 0, nil
+	}
+
+	var picked int
+
+	s.round++
+	for k := range s.order {
+		w := s.order[(s.round+k)%len(s.order)]
+
+		for w.joined && len(w.running) < w.slots() && len(s.waiting) != 0 {
+			pickCtx, cancel := context.WithTimeout(ctx, s.cfg.Settle)
+			pending := s.sched.PickJob(pickCtx, w.ID)
+			cancel()
+
+			if pending == nil {
+				break
+			}
+
+			if err := s.started(w, pending); err != nil {
+				return picked, err
+			}
+			picked++
+		}
+	}
+
+	return picked, nil
+}
+
+func (s *Simulation) started(w *workerState, pending *scheduler.PendingJob) error {
+	js, ok := s.jobs[pending.Job.ID]
+	switch {
+	case !ok:
+		return fmt.Errorf("sim: worker %s picked unknown job %s", w.ID, pending.Job.ID)
+	case js.pending == nil:
+		return fmt.Errorf("sim: worker %s picked job %s before it was scheduled", w.ID, js.spec.Name)
+	case js.done:
+		return fmt.Errorf("sim: worker %s picked finished job %s", w.ID, js.spec.Name)
+	case js.worker != nil:
+		return fmt.Errorf("sim: worker %s picked job %s already running on %s", w.ID, js.spec.Name, js.worker.ID)
+	}
+
+	js.worker = w
+	js.attempt++
+	js.run.Worker = w.ID
+	js.run.Started = s.now()
+	js.run.Attempts++
+	w.running[js] = struct{}{}
+	delete(s.waiting, js)
+	s.trace(EventStart, w, js)
+
+	attempt := js.attempt
+	s.at(s.now()+s.cfg.Duration(&js.spec.Job), func() error {
+		if js.worker != w || js.attempt != attempt || w.stopped {
+			return nil
+		}
+		return s.finished(w, js)
+	})
+
+	return nil
+}
+
+func (s *Simulation) finished(w *workerState, js *jobState) error {
+	delete(w.running, js)
+	js.worker = nil
+	s.res.Busy[w.ID] += s.now() - js.run.Started
+
+	s.sched.OnJobComplete(w.ID, js.spec.ID, &api.JobResult{ID: js.spec.ID})
+
+	s.done(js, "")
+	s.trace(EventFinish, w, js)
+
+	for _, d := range js.dependents {
+		d.deps--
+		if d.deps == 0 && !d.done {
+			s.schedule(d)
+		}
+	}
+	return nil
+}
+
+func (s *Simulation) done(js *jobState, err string) {
+	js.done = true
+	js.run.Finished = s.now()
+	js.run.Error = err
+	s.left--
+
+	if s.now() > s.res.Makespan {
+		s.res.Makespan = s.now()
+	}
+}
+
+// collectFailed находит джобы, которые планировщик завершил сам, например с ErrWorkerLost или ErrNoSuitableWorker.
+// Зависимые от них джобы тоже считаются упавшими. Возвращает true, если такие джобы нашлись.
+func (s *Simulation) collectFailed() bool {
+	var failed []*jobState
+	for js := range s.waiting {
+		select {
+		case <-js.pending.Finished:
+			failed = append(failed, js)
+		default:
+		}
+	}
+
+	sort.Slice(failed, func(i, j int) bool { return failed[i].order < failed[j].order })
+
+	for _, js := range failed {
+		err := "job finished without result"
+		if r := js.pending.Result; r != nil && r.Error != nil {
+			err = *r.Error
+		}
+
+		delete(s.waiting, js)
+		s.fail(js, err)
+	}
+
+	return len(failed) != 0
+}
+
+func (s *Simulation) fail(js *jobState, err string) {
+	s.done(js, err)
+	s.trace(EventFail, nil, js)
+
+	for _, d := range js.dependents {
+		if !d.done {
+			s.fail(d, fmt.Sprintf("dependency %s failed", js.spec.Name))
+		}
+	}
+}
@@ -0,0 +1,392 @@
+package sim_test
+
+import (
+	"bytes"
+	"context"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"gitlab.com/slon/shad-go/distbuild/pkg/api"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
+	"gitlab.com/slon/shad-go/distbuild/pkg/scheduler"
+	"gitlab.com/slon/shad-go/distbuild/pkg/sim"
+)
+
+// testScheduler - планировщик с одной очередью, политикой и учётом ресурсов.
+//
+// Если delay не нулевой, джоб попадает в очередь только через delay после ScheduleJob.
+type testScheduler struct {
+	timeAfter func(d time.Duration) <-chan time.Time
+	delay     time.Duration
+
+	policy     scheduler.Policy
+	pool       *scheduler.Pool
+	maxRetries int
+
+	mu        sync.Mutex
+	queue     []*scheduler.PendingJob
+	running   map[build.ID]*running
+	retries   map[build.ID]int
+	artifacts map[api.WorkerID]map[build.ID]bool
+	changed   chan struct{}
+}
+
+type running struct {
+	worker api.WorkerID
+	job    *scheduler.PendingJob
+}
+
+func newTestScheduler(clock *sim.Clock, policy func(scheduler.Placement) scheduler.Policy) *testScheduler {
+	s := &testScheduler{
+		timeAfter:  clock.After,
+		pool:       scheduler.NewPool(),
+		maxRetries: 1,
+		running:    map[build.ID]*running{},
+		retries:    map[build.ID]int{},
+		artifacts:  map[api.WorkerID]map[build.ID]bool{},
+		changed:    make(chan struct{}),
+	}
+	s.policy = policy(s)
+	return s
+}
+
+func fifo(scheduler.Placement) scheduler.Policy { return scheduler.FIFOPolicy{} }
+
+func fair(p scheduler.Placement) scheduler.Policy { return scheduler.NewFairPolicy(p) }
+
+func (s *testScheduler) HasArtifact(workerID api.WorkerID, id build.ID) bool {
+	return s.artifacts[workerID][id]
+}
+
+func (s *testScheduler) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+func finish(job *scheduler.PendingJob, err error) {
+	msg := err.Error()
+	job.Result = &api.JobResult{ID: job.Job.ID, Error: &msg}
+	close(job.Finished)
+}
+
+func (s *testScheduler) ScheduleJob(spec *api.JobSpec) *scheduler.PendingJob {
+	job := &scheduler.PendingJob{Job: spec, Finished: make(chan struct{})}
+
+	if !s.pool.Satisfiable(spec.Requirements) {
+		finish(job, scheduler.ErrNoSuitableWorker)
+		return job
+	}
+
+	enqueue := func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.queue = append(s.queue, job)
+		s.notify()
+	}
+
+	if s.delay == 0 {
+		enqueue()
+	} else {
+		timer := s.timeAfter(s.delay)
+		go func() {
+			<-timer
+			enqueue()
+		}()
+	}
+
+	return job
+}
+
+func (s *testScheduler) PickJob(ctx context.Context, workerID api.WorkerID) *scheduler.PendingJob {
+	for {
+		s.mu.Lock()
+
+		var fits []*scheduler.PendingJob
+		for _, job := range s.queue {
+			if s.pool.Fits(workerID, job.Job.Requirements) {
+				fits = append(fits, job)
+			}
+		}
+
+		if job := s.policy.Pick(workerID, fits); job != nil {
+			for i := range s.queue {
+				if s.queue[i] == job {
+					s.queue = append(s.queue[:i], s.queue[i+1:]...)
+					break
+				}
+			}
+
+			s.pool.Acquire(workerID, job.Job.Requirements)
+			s.policy.Started(job)
+			s.running[job.Job.ID] = &running{worker: workerID, job: job}
+			s.mu.Unlock()
+			return job
+		}
+
+		changed := s.changed
+		s.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
+
+func (s *testScheduler) OnJobComplete(workerID api.WorkerID, jobID build.ID, res *api.JobResult) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.artifacts[workerID] == nil {
+		s.artifacts[workerID] = map[build.ID]bool{}
+	}
+	s.artifacts[workerID][jobID] = true
+
+	r, ok := s.running[jobID]
+	if !ok {
+		return false
+	}
+
+	delete(s.running, jobID)
+	s.pool.Release(workerID, r.job.Job.Requirements)
+	s.policy.Finished(r.job)
+
+	r.job.Result = res
+	close(r.job.Finished)
+	s.notify()
+	return true
+}
+
+func (s *testScheduler) OnWorkerLost(workerID api.WorkerID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pool.Remove(workerID)
+	delete(s.artifacts, workerID)
+
+	var lost []*scheduler.PendingJob
+	for id, r := range s.running {
+		if r.worker == workerID {
+			delete(s.running, id)
+			lost = append(lost, r.job)
+		}
+	}
+
+	// Порядок обхода map случайный, а планировщик в симуляции должен быть детерминированным.
+	sort.Slice(lost, func(i, j int) bool { return bytes.Compare(lost[i].Job.ID[:], lost[j].Job.ID[:]) < 0 })
+
+	var requeue []*scheduler.PendingJob
+	for _, job := range lost {
+		s.policy.Finished(job)
+
+		s.retries[job.Job.ID]++
+		if s.retries[job.Job.ID] > s.maxRetries {
+			finish(job, scheduler.ErrWorkerLost)
+		} else {
+			requeue = append(requeue, job)
+		}
+	}
+
+	s.queue = append(requeue, s.queue...)
+	s.notify()
+}
+
+func (s *testScheduler) UpdateWorker(workerID api.WorkerID, resources build.Resources) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.pool.Update(workerID, resources)
+	s.notify()
+}
+
+var _ sim.Scheduler = (*testScheduler)(nil)
+
+func chain(names ...string) build.Graph {
+	var g build.Graph
+	for i, name := range names {
+		job := build.Job{ID: build.ID{byte(i + 1)}, Name: name}
+		if i > 0 {
+			job.Deps = []build.ID{g.Jobs[i-1].ID}
+		}
+		g.Jobs = append(g.Jobs, job)
+	}
+	return g
+}
+
+func workers(n, slots int) []sim.WorkerConfig {
+	var w []sim.WorkerConfig
+	for i := 0; i < n; i++ {
+		w = append(w, sim.WorkerConfig{ID: api.WorkerID(string(rune('a' + i))), Slots: slots})
+	}
+	return w
+}
+
+func run(t testing.TB, config sim.Config, policy func(scheduler.Placement) scheduler.Policy, builds ...sim.Build) *sim.Result {
+	clock := sim.NewClock()
+	s := sim.New(newTestScheduler(clock, policy), clock, config)
+
+	res, err := s.Run(context.Background(), builds...)
+	require.NoError(t, err)
+	return res
+}
+
+func TestChain(t *testing.T) {
+	res := run(t, sim.Config{Workers: workers(2, 1)}, fifo, sim.Build{Graph: chain("a", "b", "c")})
+
+	require.Equal(t, 3*time.Second, res.Makespan)
+	require.Zero(t, res.Failed())
+
+	var busy time.Duration
+	for _, d := range res.Busy {
+		busy += d
+	}
+	require.Equal(t, 3*time.Second, busy)
+
+	for _, e := range res.Trace {
+		t.Log(e)
+	}
+}
+
+func TestParallel(t *testing.T) {
+	g := sim.Generate(sim.GraphConfig{Jobs: 8})
+
+	res := run(t, sim.Config{Workers: workers(2, 2)}, fifo, sim.Build{Graph: g})
+	require.Equal(t, 2*time.Second, res.Makespan)
+	require.Equal(t, map[api.WorkerID]time.Duration{"a": 4 * time.Second, "b": 4 * time.Second}, res.Busy)
+}
+
+func TestWorkerLost(t *testing.T) {
+	config := sim.Config{
+		Workers:          workers(1, 1),
+		HeartbeatTimeout: 5 * time.Second,
+		Script: []sim.Action{
+			{At: 1500 * time.Millisecond, Stop: "a"},
+			{At: 10 * time.Second, Join: &sim.WorkerConfig{ID: "b"}},
+		},
+	}
+
+	res := run(t, config, fifo, sim.Build{Graph: chain("a", "b", "c")})
+	require.Zero(t, res.Failed())
+
+	b := res.Jobs[build.ID{2}]
+	require.Equal(t, api.WorkerID("b"), b.Worker)
+	require.Equal(t, 2, b.Attempts)
+	require.Equal(t, 12*time.Second, res.Makespan)
+}
+
+func TestWorkerLostRetriesExhausted(t *testing.T) {
+	config := sim.Config{
+		Workers: workers(1, 1),
+		Script: []sim.Action{
+			{At: 500 * time.Millisecond, Stop: "a"},
+			{At: time.Second, Join: &sim.WorkerConfig{ID: "a"}},
+			{At: 1500 * time.Millisecond, Stop: "a"},
+			{At: 2 * time.Second, Join: &sim.WorkerConfig{ID: "a"}},
+		},
+	}
+
+	res := run(t, config, fifo, sim.Build{Graph: chain("a", "b")})
+	require.Equal(t, 2, res.Failed())
+	require.Equal(t, scheduler.ErrWorkerLost.Error(), res.Jobs[build.ID{1}].Error)
+	require.Contains(t, res.Jobs[build.ID{2}].Error, "dependency a failed")
+}
+
+func TestRequirements(t *testing.T) {
+	g := chain("a", "b")
+	g.Jobs[1].Requirements = build.Resources{CPU: 8}
+	g.Jobs = append(g.Jobs, build.Job{ID: build.ID{3}, Name: "c", Requirements: build.Resources{Tags: []string{"gpu"}}})
+
+	config := sim.Config{
+		Workers: []sim.WorkerConfig{
+			{ID: "small", Resources: build.Resources{CPU: 1}},
+			{ID: "large", Resources: build.Resources{CPU: 8}},
+		},
+	}
+
+	res := run(t, config, fifo, sim.Build{Graph: g})
+	require.Equal(t, api.WorkerID("large"), res.Jobs[build.ID{2}].Worker)
+	require.Equal(t, scheduler.ErrNoSuitableWorker.Error(), res.Jobs[build.ID{3}].Error)
+}
+
+func TestSchedulerTimers(t *testing.T) {
+	clock := sim.NewClock()
+	sched := newTestScheduler(clock, fifo)
+	sched.delay = time.Minute
+
+	s := sim.New(sched, clock, sim.Config{Workers: workers(1, 1)})
+	res, err := s.Run(context.Background(), sim.Build{Graph: chain("a", "b")})
+	require.NoError(t, err)
+	require.Equal(t, 2*time.Minute+2*time.Second, res.Makespan)
+}
+
+func TestStalled(t *testing.T) {
+	clock := sim.NewClock()
+	s := sim.New(newTestScheduler(clock, fifo), clock, sim.Config{})
+
+	_, err := s.Run(context.Background(), sim.Build{Graph: chain("a")})
+	require.ErrorIs(t, err, sim.ErrStalled)
+}
+
+func TestDeterministic(t *testing.T) {
+	g := sim.Generate(sim.GraphConfig{Seed: 1, Jobs: 1000, MaxDeps: 3, Window: 50})
+	require.NoError(t, build.Validate(g))
+
+	config := sim.Config{
+		Workers:          workers(4, 3),
+		Duration:         sim.RandomDuration(time.Second, time.Minute),
+		HeartbeatTimeout: time.Minute,
+		Script: []sim.Action{
+			{At: 10 * time.Minute, Stop: "b"},
+			{At: 20 * time.Minute, Join: &sim.WorkerConfig{ID: "b", Slots: 3}},
+		},
+	}
+
+	first := run(t, config, fair, sim.Build{Graph: g})
+	second := run(t, config, fair, sim.Build{Graph: g})
+
+	require.Zero(t, first.Failed())
+	require.Equal(t, first.Trace, second.Trace)
+	require.Equal(t, first.Makespan, second.Makespan)
+}
+
+func TestFairPolicy(t *testing.T) {
+	small := sim.Build{ID: build.ID{'s'}, User: "small", Graph: sim.Generate(sim.GraphConfig{Seed: 1, Jobs: 4})}
+	large := sim.Build{ID: build.ID{'l'}, User: "large", Graph: sim.Generate(sim.GraphConfig{Seed: 2, Jobs: 100})}
+
+	finished := func(res *sim.Result) time.Duration {
+		var last time.Duration
+		for _, job := range small.Graph.Jobs {
+			if f := res.Jobs[job.ID].Finished; f > last {
+				last = f
+			}
+		}
+		return last
+	}
+
+	config := sim.Config{Workers: workers(2, 1)}
+
+	require.Equal(t, 52*time.Second, finished(run(t, config, fifo, large, small)))
+	require.Equal(t, 4*time.Second, finished(run(t, config, fair, large, small)))
+}
+
+func benchmarkPolicy(b *testing.B, policy func(scheduler.Placement) scheduler.Policy) {
+	g := sim.Generate(sim.GraphConfig{Seed: 1, Jobs: 2000, MaxDeps: 4, Window: 100})
+	config := sim.Config{
+		Workers:  workers(8, 4),
+		Duration: sim.RandomDuration(time.Second, time.Minute),
+	}
+
+	for i := 0; i < b.N; i++ {
+		res := run(b, config, policy, sim.Build{Graph: g})
+		b.ReportMetric(res.Makespan.Seconds(), "makespan-s")
+	}
+}
+
+func BenchmarkFIFOPolicy(b *testing.B) { benchmarkPolicy(b, fifo) }
+func BenchmarkFairPolicy(b *testing.B) { benchmarkPolicy(b, fair) }
@@ -2,16 +2,72 @@ package tarstream
 
 import (
 	"archive/tar"
+	"errors"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 )
 
+// ModTime - время модификации, которое Send записывает для всех файлов.
+//
+// Настоящее время модификации в поток не попадает, поэтому поток для одинакового
+// содержимого директории всегда одинаковый.
+var ModTime = time.Unix(0, 0)
+
+var (
+	// ErrUnsafePath возвращается, если запись потока указывает за пределы директории.
+	ErrUnsafePath = errors.New("tarstream: unsafe path")
+
+	// ErrLimitExceeded возвращается, если поток превысил ограничения Limits.
+	ErrLimitExceeded = errors.New("tarstream: limit exceeded")
+)
+
+// Limits ограничивает поток, который принимает Receive. Нулевое значение поля означает отсутствие ограничения.
+type Limits struct {
+	// MaxEntries ограничивает число файлов, директорий и ссылок в потоке.
+	MaxEntries int
+
+	// MaxSize ограничивает суммарный размер содержимого файлов в байтах.
+	MaxSize int64
+}
+
+// DefaultLimits используются функцией Receive.
+var DefaultLimits = Limits{
+	MaxEntries: 1 << 20,
+	MaxSize:    64 << 30,
+}
+
+// fileMode возвращает права, с которыми файл передаётся в потоке. Из прав сохраняется только бит исполнения.
+func fileMode(mode fs.FileMode) int64 {
+	if mode&0o111 != 0 {
+		return 0o755
+	}
+	return 0o644
+}
+
+// checkLink проверяет, что симлинк name с целью target указывает внутрь директории.
+func checkLink(name, target string) error {
+	if filepath.IsAbs(target) || !filepath.IsLocal(filepath.Join(filepath.Dir(name), target)) {
+		return fmt.Errorf("%w: symlink %s points to %s", ErrUnsafePath, name, target)
+	}
+	return nil
+}
+
 // Send рекурсивно обходит директорию и сериализует её содержимое в поток w.
+//
+// Файлы обходятся в лексикографическом порядке. Симлинки передаются как симлинки, файлы
+// с несколькими жёсткими ссылками внутри dir - как жёсткие ссылки на первый из них.
+// Send возвращает ошибку, если dir содержит специальные файлы или симлинки, указывающие за пределы dir.
 func Send(dir string, w io.Writer) error {
 	tw := tar.NewWriter(w)
 
-	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+	links := map[inode]string{}
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err
 		}
@@ -25,19 +81,59 @@ func Send(dir string, w io.Writer) error {
 			return nil
 		}
 
+		name := filepath.ToSlash(rel)
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
 		switch {
 		case info.IsDir():
 			return tw.WriteHeader(&tar.Header{
-				Name:     rel,
+				Name:     name,
 				Typeflag: tar.TypeDir,
+				Mode:     0o755,
+				ModTime:  ModTime,
 			})
 
-		default:
+		case info.Mode()&fs.ModeSymlink != 0:
+			target, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+
+			if err := checkLink(rel, target); err != nil {
+				return err
+			}
+
+			return tw.WriteHeader(&tar.Header{
+				Name:     name,
+				Typeflag: tar.TypeSymlink,
+				Linkname: filepath.ToSlash(target),
+				Mode:     0o777,
+				ModTime:  ModTime,
+			})
+
+		case info.Mode().IsRegular():
+			if key, ok := fileInode(info); ok {
+				if first, ok := links[key]; ok {
+					return tw.WriteHeader(&tar.Header{
+						Name:     name,
+						Typeflag: tar.TypeLink,
+						Linkname: first,
+						ModTime:  ModTime,
+					})
+				}
+				links[key] = name
+			}
+
 			h := &tar.Header{
 				Typeflag: tar.TypeReg,
-				Name:     rel,
+				Name:     name,
 				Size:     info.Size(),
-				Mode:     int64(info.Mode()),
+				Mode:     fileMode(info.Mode()),
+				ModTime:  ModTime,
 			}
 
 			if err := tw.WriteHeader(h); err != nil {
@@ -52,6 +148,9 @@ func Send(dir string, w io.Writer) error {
 
 			_, err = io.Copy(tw, f)
 			return err
+
+		default:
+			return fmt.Errorf("%s: unsupported file type %s", rel, info.Mode().Type())
 		}
 	})
 
@@ -62,39 +161,237 @@ func Send(dir string, w io.Writer) error {
 	return tw.Close()
 }
 
-// Receive читает поток r и материализует содержимое потока внутри dir.
+// Receive читает поток r и материализует содержимое потока внутри dir, используя DefaultLimits.
 func Receive(dir string, r io.Reader) error {
+	return DefaultLimits.Receive(dir, r)
+}
+
+// receiver хранит состояние одного вызова Receive.
+type receiver struct {
+	dir    string
+	limits Limits
+
+	entries int
+	size    int64
+
+	// files и symlinks - полученные файлы и симлинки, dirs - директории в порядке получения.
+	files    map[string]struct{}
+	symlinks map[string]struct{}
+	dirs     []*tar.Header
+}
+
+// Receive читает поток r и материализует содержимое потока внутри dir.
+//
+// Receive отклоняет записи с путями вне dir, симлинки, указывающие за пределы dir,
+// жёсткие ссылки на файлы, которых нет в потоке, и записи, путь к которым проходит через симлинк.
+// Время модификации всех записей выставляется из потока.
+func (l Limits) Receive(dir string, r io.Reader) error {
+	rc := &receiver{
+		dir:      dir,
+		limits:   l,
+		files:    map[string]struct{}{},
+		symlinks: map[string]struct{}{},
+	}
+
 	tr := tar.NewReader(r)
 
 	for {
 		h, err := tr.Next()
 		if err == io.EOF {
-			return nil
+			break
 		} else if err != nil {
 			return err
 		}
 
-		absPath := filepath.Join(dir, h.Name)
+		if err := rc.receive(h, tr); err != nil {
+			return err
+		}
+	}
+
+	if err := rc.checkSymlinks(); err != nil {
+		return err
+	}
+
+	// Время модификации директорий выставляется в конце, потому что создание файлов внутри его меняет.
+	for i := len(rc.dirs) - 1; i >= 0; i-- {
+		h := rc.dirs[i]
+		if err := os.Chtimes(filepath.Join(dir, h.Name), h.ModTime, h.ModTime); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (rc *receiver) receive(h *tar.Header, tr *tar.Reader) error {
+	rc.entries++
+	if rc.limits.MaxEntries != 0 && rc.entries > rc.limits.MaxEntries {
+		return fmt.Errorf("%w: more than %d entries", ErrLimitExceeded, rc.limits.MaxEntries)
+	}
+
+	name := filepath.Clean(filepath.FromSlash(h.Name))
+	if name == "." || !filepath.IsLocal(name) {
+		return fmt.Errorf("%w: %q", ErrUnsafePath, h.Name)
+	}
 
-		if h.Typeflag == tar.TypeDir {
-			if err := os.Mkdir(absPath, 0777); err != nil {
+	if err := rc.checkParents(name); err != nil {
+		return err
+	}
+
+	absPath := filepath.Join(rc.dir, name)
+
+	switch h.Typeflag {
+	case tar.TypeDir:
+		if err := os.Mkdir(absPath, 0777); err != nil {
+			return err
+		}
+
+		h.Name = name
+		rc.dirs = append(rc.dirs, h)
+		return nil
+
+	case tar.TypeReg:
+		if h.Size < 0 {
+			return fmt.Errorf("%s: invalid size %d", name, h.Size)
+		}
+
+		rc.size += h.Size
+		if rc.limits.MaxSize != 0 && rc.size > rc.limits.MaxSize {
+			return fmt.Errorf("%w: more than %d bytes", ErrLimitExceeded, rc.limits.MaxSize)
+		}
+
+		mode := fs.FileMode(fileMode(fs.FileMode(h.Mode)))
+
+		writeFile := func() error {
+			f, err := os.OpenFile(absPath, os.O_CREATE|os.O_EXCL|os.O_WRONLY, mode)
+			if err != nil {
 				return err
 			}
-		} else {
-			writeFile := func() error {
-				f, err := os.OpenFile(absPath, os.O_CREATE|os.O_WRONLY, os.FileMode(h.Mode))
-				if err != nil {
-					return err
-				}
-				defer f.Close()
+			defer f.Close()
 
-				_, err = io.Copy(f, tr)
+			if err := f.Chmod(mode); err != nil {
 				return err
 			}
 
-			if err := writeFile(); err != nil {
+			if _, err := io.CopyN(f, tr, h.Size); err != nil {
 				return err
 			}
+			return f.Close()
+		}
+
+		if err := writeFile(); err != nil {
+			return err
+		}
+
+		rc.files[name] = struct{}{}
+		return os.Chtimes(absPath, h.ModTime, h.ModTime)
+
+	case tar.TypeSymlink:
+		target := filepath.FromSlash(h.Linkname)
+		if err := checkLink(name, target); err != nil {
+			return err
+		}
+
+		if err := os.Symlink(target, absPath); err != nil {
+			return err
+		}
+
+		rc.symlinks[name] = struct{}{}
+
+		return symlinkChtimes(absPath, h.ModTime)
+
+	case tar.TypeLink:
+		target := filepath.Clean(filepath.FromSlash(h.Linkname))
+		if _, ok := rc.files[target]; !ok {
+			return fmt.Errorf("%w: hard link %s points to %s, which is not a file in the stream", ErrUnsafePath, name, h.Linkname)
+		}
+
+		if err := os.Link(filepath.Join(rc.dir, target), absPath); err != nil {
+			return err
+		}
+
+		rc.files[name] = struct{}{}
+		return nil
+
+	default:
+		return fmt.Errorf("%s: unsupported entry type %q", name, h.Typeflag)
+	}
+}
+
+// checkParents проверяет, что путь к записи name не проходит через полученный ранее симлинк.
+func (rc *receiver) checkParents(name string) error {
+	for dir := filepath.Dir(name); dir != "."; dir = filepath.Dir(dir) {
+		if _, ok := rc.symlinks[dir]; ok {
+			return fmt.Errorf("%w: %s is inside symlink %s", ErrUnsafePath, name, dir)
+		}
+	}
+	return nil
+}
+
+// maxLinkFollows ограничивает число симлинков, через которые проходит разрешение одного пути.
+const maxLinkFollows = 255
+
+// checkSymlinks проверяет, что полученные симлинки после разрешения всей цепочки остаются внутри dir.
+//
+// checkLink проверяет каждый симлинк по отдельности, но цепочка симлинков с .. может выйти за пределы dir.
+// Цепочка разрешается покомпонентно внутри dir, поэтому висячие симлинки тоже проверяются.
+func (rc *receiver) checkSymlinks() error {
+	for name := range rc.symlinks {
+		if err := rc.resolve(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolve разрешает путь name относительно dir так же, как это делает ядро, но без выхода за пределы dir.
+//
+// Несуществующие компоненты пути разрешаются лексически. resolve возвращает ErrUnsafePath,
+// если на каком-то шаге путь выходит за пределы dir.
+func (rc *receiver) resolve(name string) error {
+	var resolved []string
+	pending := strings.Split(name, string(filepath.Separator))
+
+	follows := 0
+	for len(pending) > 0 {
+		c := pending[0]
+		pending = pending[1:]
+
+		switch c {
+		case "", ".":
+			continue
+		case "..":
+			if len(resolved) == 0 {
+				return fmt.Errorf("%w: symlink %s points outside of the directory", ErrUnsafePath, name)
+			}
+			resolved = resolved[:len(resolved)-1]
+			continue
+		}
+
+		absPath := filepath.Join(rc.dir, filepath.Join(resolved...), c)
+		info, err := os.Lstat(absPath)
+		if errors.Is(err, fs.ErrNotExist) || err == nil && info.Mode()&fs.ModeSymlink == 0 {
+			resolved = append(resolved, c)
+			continue
+		} else if err != nil {
+			return err
+		}
+
+		follows++
+		if follows > maxLinkFollows {
+			return fmt.Errorf("%w: too many levels of symlinks in %s", ErrUnsafePath, name)
+		}
+
+		target, err := os.Readlink(absPath)
+		if err != nil {
+			return err
+		}
+		if filepath.IsAbs(target) {
+			return fmt.Errorf("%w: symlink %s points to %s", ErrUnsafePath, name, target)
 		}
+
+		pending = append(strings.Split(target, string(filepath.Separator)), pending...)
 	}
+
+	return nil
 }
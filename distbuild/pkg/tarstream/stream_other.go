@@ -0,0 +1,20 @@
+//go:build !unix
+
+package tarstream
+
+import (
+	"io/fs"
+	"time"
+)
+
+type inode struct{}
+
+// fileInode всегда возвращает false: без inode жёсткие ссылки передаются как отдельные файлы.
+func fileInode(info fs.FileInfo) (inode, bool) {
+	return inode{}, false
+}
+
+// symlinkChtimes ничего не делает: время модификации симлинка на этой платформе не выставляется.
+func symlinkChtimes(path string, mtime time.Time) error {
+	return nil
+}
@@ -1,13 +1,14 @@
 package tarstream_test
 
 import (
+	"archive/tar"
 	"bytes"
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
-	"golang.org/x/sys/unix"
 
 	"gitlab.com/slon/shad-go/distbuild/pkg/tarstream"
 )
@@ -31,6 +32,10 @@ func TestTarStream(t *testing.T) {
 	require.NoError(t, os.WriteFile(filepath.Join(from, "a", "x.bin"), []byte("xxx"), 0777))
 	require.NoError(t, os.WriteFile(filepath.Join(from, "b", "c", "y.txt"), []byte("yyy"), 0666))
 
+	// Права не должны зависеть от umask процесса.
+	require.NoError(t, os.Chmod(filepath.Join(from, "a", "x.bin"), 0777))
+	require.NoError(t, os.Chmod(filepath.Join(from, "b", "c", "y.txt"), 0666))
+
 	require.NoError(t, tarstream.Send(from, &buf))
 
 	require.NoError(t, tarstream.Receive(to, &buf))
@@ -61,6 +66,219 @@ func TestTarStream(t *testing.T) {
 	checkFile(filepath.Join(to, "b", "c", "y.txt"), []byte("yyy"), 0644)
 }
 
-func init() {
-	unix.Umask(0022)
+func TestTarStreamLinks(t *testing.T) {
+	from := t.TempDir()
+	to := t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(from, "bin"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(from, "bin", "tool"), []byte("#!/bin/sh"), 0700))
+	require.NoError(t, os.Chmod(filepath.Join(from, "bin", "tool"), 0700))
+	require.NoError(t, os.Link(filepath.Join(from, "bin", "tool"), filepath.Join(from, "tool2")))
+	require.NoError(t, os.Symlink("bin/tool", filepath.Join(from, "tool")))
+	require.NoError(t, os.Symlink("..", filepath.Join(from, "bin", "root")))
+
+	var buf bytes.Buffer
+	require.NoError(t, tarstream.Send(from, &buf))
+	require.NoError(t, tarstream.Receive(to, &buf))
+
+	target, err := os.Readlink(filepath.Join(to, "tool"))
+	require.NoError(t, err)
+	require.Equal(t, "bin/tool", target)
+
+	target, err = os.Readlink(filepath.Join(to, "bin", "root"))
+	require.NoError(t, err)
+	require.Equal(t, "..", target)
+
+	st1, err := os.Stat(filepath.Join(to, "bin", "tool"))
+	require.NoError(t, err)
+	st2, err := os.Stat(filepath.Join(to, "tool2"))
+	require.NoError(t, err)
+	require.True(t, os.SameFile(st1, st2))
+	require.Equal(t, os.FileMode(0755).String(), st1.Mode().String())
+
+	for _, name := range []string{"bin", "bin/tool", "tool"} {
+		st, err := os.Lstat(filepath.Join(to, name))
+		require.NoError(t, err)
+		require.True(t, st.ModTime().Equal(tarstream.ModTime), "%s: %v", name, st.ModTime())
+	}
+}
+
+func TestSendDeterministic(t *testing.T) {
+	send := func(fileMode os.FileMode) []byte {
+		dir := t.TempDir()
+		require.NoError(t, os.Mkdir(filepath.Join(dir, "b"), 0700))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "b", "x"), []byte("xxx"), fileMode))
+		require.NoError(t, os.Chmod(filepath.Join(dir, "b", "x"), fileMode))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "a"), []byte("aaa"), 0600))
+		require.NoError(t, os.Chtimes(filepath.Join(dir, "a"), time.Now(), time.Now().Add(-time.Hour)))
+
+		var buf bytes.Buffer
+		require.NoError(t, tarstream.Send(dir, &buf))
+		return buf.Bytes()
+	}
+
+	require.Equal(t, send(0700), send(0755))
+	require.NotEqual(t, send(0700), send(0644))
+}
+
+func TestSendRejectsUnsafeSymlinks(t *testing.T) {
+	for _, target := range []string{"/etc/passwd", "..", "a/../../x"} {
+		dir := t.TempDir()
+		require.NoError(t, os.Symlink(target, filepath.Join(dir, "link")))
+
+		err := tarstream.Send(dir, &bytes.Buffer{})
+		require.ErrorIs(t, err, tarstream.ErrUnsafePath, target)
+	}
+}
+
+type entry struct {
+	tar.Header
+	content string
+}
+
+func file(name, content string) entry {
+	return entry{Header: tar.Header{Typeflag: tar.TypeReg, Name: name, Mode: 0644, Size: int64(len(content))}, content: content}
+}
+
+func dir(name string) entry {
+	return entry{Header: tar.Header{Typeflag: tar.TypeDir, Name: name, Mode: 0755}}
+}
+
+func symlink(name, target string) entry {
+	return entry{Header: tar.Header{Typeflag: tar.TypeSymlink, Name: name, Linkname: target}}
+}
+
+func hardlink(name, target string) entry {
+	return entry{Header: tar.Header{Typeflag: tar.TypeLink, Name: name, Linkname: target}}
+}
+
+func makeTar(t testing.TB, entries ...entry) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		require.NoError(t, tw.WriteHeader(&e.Header))
+		_, err := tw.Write([]byte(e.content))
+		require.NoError(t, err)
+	}
+	require.NoError(t, tw.Close())
+	return buf.Bytes()
+}
+
+func TestReceiveRejectsUnsafeEntries(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		entries []entry
+	}{
+		{"dotdot", []entry{file("../x", "x")}},
+		{"nested_dotdot", []entry{dir("a"), file("a/../../x", "x")}},
+		{"absolute", []entry{file("/tmp/x", "x")}},
+		{"root", []entry{dir(".")}},
+		{"absolute_symlink", []entry{symlink("l", "/etc")}},
+		{"escaping_symlink", []entry{dir("a"), symlink("a/l", "../../x")}},
+		{"symlink_chain", []entry{
+			dir("p"), dir("p/q"), dir("z"),
+			symlink("p/q/c", "../../z"),
+			symlink("p/q/l", "c/../.."),
+		}},
+		{"dangling_symlink_chain", []entry{
+			dir("a"), dir("a/b"),
+			symlink("a/b/s", "../.."),
+			symlink("a/b/l", "s/../escaped"),
+		}},
+		{"symlink_loop", []entry{symlink("x", "y"), symlink("y", "x")}},
+		{"write_through_symlink", []entry{dir("a"), symlink("l", "a"), file("l/x", "x")}},
+		{"hardlink_outside", []entry{hardlink("x", "../x")}},
+		{"hardlink_missing", []entry{hardlink("x", "y")}},
+		{"hardlink_to_dir", []entry{dir("a"), hardlink("x", "a")}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			root := t.TempDir()
+			to := filepath.Join(root, "to")
+			require.NoError(t, os.Mkdir(to, 0777))
+
+			err := tarstream.Receive(to, bytes.NewReader(makeTar(t, tc.entries...)))
+			require.ErrorIs(t, err, tarstream.ErrUnsafePath)
+			requireOnlyChild(t, root, "to")
+		})
+	}
+}
+
+func TestReceiveRejectsSpecialFiles(t *testing.T) {
+	stream := makeTar(t, entry{Header: tar.Header{Typeflag: tar.TypeFifo, Name: "fifo"}})
+	require.Error(t, tarstream.Receive(t.TempDir(), bytes.NewReader(stream)))
+}
+
+func TestReceiveLimits(t *testing.T) {
+	stream := makeTar(t, dir("a"), file("a/x", "xxxx"), file("y", "yyyy"))
+
+	require.NoError(t, tarstream.Limits{MaxEntries: 3, MaxSize: 8}.Receive(t.TempDir(), bytes.NewReader(stream)))
+
+	err := tarstream.Limits{MaxEntries: 2}.Receive(t.TempDir(), bytes.NewReader(stream))
+	require.ErrorIs(t, err, tarstream.ErrLimitExceeded)
+
+	err = tarstream.Limits{MaxSize: 7}.Receive(t.TempDir(), bytes.NewReader(stream))
+	require.ErrorIs(t, err, tarstream.ErrLimitExceeded)
+}
+
+func requireOnlyChild(t testing.TB, root, name string) {
+	t.Helper()
+
+	entries, err := os.ReadDir(root)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	require.Equal(t, name, entries[0].Name())
+}
+
+// requireInside проверяет, что все симлинки внутри dir после разрешения указывают внутрь dir.
+func requireInside(t testing.TB, dir string) {
+	t.Helper()
+
+	root, err := filepath.EvalSymlinks(dir)
+	require.NoError(t, err)
+
+	err = filepath.WalkDir(dir, func(path string, d os.DirEntry, err error) error {
+		require.NoError(t, err)
+		if d.Type()&os.ModeSymlink == 0 {
+			return nil
+		}
+
+		resolved, err := filepath.EvalSymlinks(path)
+		if err != nil {
+			return nil
+		}
+
+		rel, err := filepath.Rel(root, resolved)
+		require.NoError(t, err)
+		require.True(t, filepath.IsLocal(rel), "%s resolves to %s", path, resolved)
+		return nil
+	})
+	require.NoError(t, err)
+}
+
+func FuzzReceive(f *testing.F) {
+	f.Add(makeTar(f, dir("a"), file("a/x", "xxx"), symlink("l", "a/x"), hardlink("h", "a/x")))
+	f.Add(makeTar(f, file("../x", "x")))
+	f.Add(makeTar(f, dir("a"), symlink("a/l", ".."), file("a/l/x", "x")))
+	f.Add(makeTar(f, dir("p"), dir("p/q"), dir("z"), symlink("p/q/c", "../../z"), symlink("p/q/l", "c/../..")))
+	f.Add(makeTar(f, dir("a"), dir("a/b"), symlink("a/b/s", "../.."), symlink("a/b/l", "s/../escaped")))
+
+	f.Fuzz(func(t *testing.T, stream []byte) {
+		root := t.TempDir()
+		to := filepath.Join(root, "to")
+		require.NoError(t, os.Mkdir(to, 0777))
+
+		limits := tarstream.Limits{MaxEntries: 64, MaxSize: 1 << 20}
+		if err := limits.Receive(to, bytes.NewReader(stream)); err != nil {
+			requireOnlyChild(t, root, "to")
+			return
+		}
+
+		requireOnlyChild(t, root, "to")
+		requireInside(t, to)
+
+		// Принятая директория должна передаваться дальше без ошибок.
+		var buf bytes.Buffer
+		require.NoError(t, tarstream.Send(to, &buf))
+		require.NoError(t, tarstream.Receive(t.TempDir(), &buf))
+	})
 }
@@ -0,0 +1,30 @@
+//go:build unix
+
+package tarstream
+
+import (
+	"io/fs"
+	"syscall"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+type inode struct {
+	dev, ino uint64
+}
+
+// fileInode возвращает inode файла, если у него несколько жёстких ссылок.
+func fileInode(info fs.FileInfo) (inode, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Nlink <= 1 {
+		return inode{}, false
+	}
+	return inode{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
+
+// symlinkChtimes выставляет время модификации самого симлинка, а не файла, на который он указывает.
+func symlinkChtimes(path string, mtime time.Time) error {
+	ts := []unix.Timespec{unix.NsecToTimespec(mtime.UnixNano()), unix.NsecToTimespec(mtime.UnixNano())}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, path, ts, unix.AT_SYMLINK_NOFOLLOW)
+}
@@ -0,0 +1,51 @@
+package worker
+
+import (
+	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+	"gitlab.com/slon/shad-go/distbuild/pkg/metrics"
+)
+
+// JobDurationBuckets - границы бакетов гистограммы времени работы джобов.
+var JobDurationBuckets = []float64{.1, .5, 1, 2.5, 5, 10, 30, 60, 120, 300, 600}
+
+// Metrics содержит метрики воркера. Registry нужно отдавать на /metrics.
+type Metrics struct {
+	Registry *metrics.Registry
+
+	// HTTP оборачивает handler-ы воркера и считает объём артефактов, отданных другим воркерам.
+	HTTP *metrics.HTTPMetrics
+
+	// Jobs считает завершившиеся джобы, метка status принимает значения ok, failed и canceled.
+	Jobs        *metrics.CounterVec
+	JobDuration *metrics.Histogram
+	FreeSlots   *metrics.Gauge
+
+	// Downloaded считает размер скачанных данных, метка kind принимает значения file и artifact.
+	Downloaded *metrics.CounterVec
+
+	Heartbeats      *metrics.Counter
+	HeartbeatErrors *metrics.Counter
+}
+
+func NewMetrics(fileCache *filecache.Cache, artifacts *artifact.Cache) *Metrics {
+	r := metrics.NewRegistry()
+
+	m := &Metrics{
+		Registry: r,
+		HTTP:     metrics.NewHTTPMetrics(r, "distbuild_worker_http"),
+
+		Jobs:        r.CounterVec("distbuild_worker_jobs_total", "Finished jobs.", "status"),
+		JobDuration: r.Histogram("distbuild_worker_job_duration_seconds", "Job execution time.", JobDurationBuckets),
+		FreeSlots:   r.Gauge("distbuild_worker_free_slots", "Free job slots."),
+
+		Downloaded: r.CounterVec("distbuild_worker_downloaded_bytes_total", "Bytes downloaded from coordinator and other workers.", "kind"),
+
+		Heartbeats:      r.Counter("distbuild_worker_heartbeats_total", "Sent heartbeats."),
+		HeartbeatErrors: r.Counter("distbuild_worker_heartbeat_errors_total", "Failed heartbeats."),
+	}
+
+	fileCache.RegisterMetrics(r, "distbuild_worker_filecache")
+	artifacts.RegisterMetrics(r, "distbuild_worker_artifact_cache")
+	return m
+}
@@ -10,7 +10,10 @@ import (
 
 	"gitlab.com/slon/shad-go/distbuild/pkg/api"
 	"gitlab.com/slon/shad-go/distbuild/pkg/artifact"
+	"gitlab.com/slon/shad-go/distbuild/pkg/auth"
+	"gitlab.com/slon/shad-go/distbuild/pkg/build"
 	"gitlab.com/slon/shad-go/distbuild/pkg/filecache"
+	"gitlab.com/slon/shad-go/distbuild/pkg/sandbox"
 )
 
 type Worker struct {
@@ -26,6 +29,38 @@ func New(
 	panic("implement me")
 }
 
+// SetResources задаёт ресурсы, которые воркер сообщает координатору в HeartbeatRequest.Resources.
+//
+// Метод вызывается до Run. Нулевое значение означает, что воркер может выполнять только джобы без требований.
+func (w *Worker) SetResources(resources build.Resources) {
+	panic("implement me")
+}
+
+// SetSandbox включает запуск команд джобов через config.Run.
+//
+// Метод вызывается до Run. Без SetSandbox команды запускаются через cmd.Run без ограничений.
+func (w *Worker) SetSandbox(config sandbox.Config) {
+	panic("implement me")
+}
+
+// SetCacheBudget задаёт бюджет в байтах на размер кеша артефактов и кеша файлов.
+// После завершения каждого джоба воркер вызывает Evict у обоих кешей, см. README.
+//
+// Метод вызывается до Run. Ноль означает, что размер кеша не ограничен.
+func (w *Worker) SetCacheBudget(artifacts, files int64) {
+	panic("implement me")
+}
+
+// SetAuth задаёт creds, с которыми воркер обращается к координатору и к другим воркерам,
+// и checker, которым воркер проверяет запросы к своим endpoint-ам. nil checker отключает проверку.
+//
+// Токен из creds отправляется только координатору, к другим воркерам воркер ходит через creds.PeerHTTPClient.
+//
+// Метод вызывается до Run и ServeHTTP.
+func (w *Worker) SetAuth(creds auth.Credentials, checker auth.TokenChecker) {
+	panic("implement me")
+}
+
 func (w *Worker) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 	panic("implement me")
 }
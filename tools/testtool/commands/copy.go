@@ -0,0 +1,186 @@
+package commands
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// copier copies files and directories preserving their paths relative to the base directory
+// and permissions, like rsync -prR does.
+//
+// Only regular files and directories are copied, symlinks and other special files are skipped.
+// Files are cloned on filesystems that support copy-on-write and copied otherwise.
+type copier struct {
+	// hardlink allows to link files into destination instead of copying them.
+	//
+	// Copies are never modified in place, existing destination files are removed before copying.
+	// World-writable files are always copied, so that the process that can't write the source
+	// can't write its copy either.
+	hardlink bool
+
+	// exclude lists names of files and directories that are skipped at any depth.
+	exclude []string
+}
+
+// copyDir recursively copies src directory to dst.
+//
+// Does nothing if src does not exist.
+func (c *copier) copyDir(baseDir, src, dst string) error {
+	_, err := os.Stat(filepath.Join(baseDir, src))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return c.copyPath(baseDir, src, dst)
+}
+
+// copyContents recursively copies src contents to dst.
+func (c *copier) copyContents(baseDir, src, dst string) error {
+	return c.copyPath(baseDir, src, dst)
+}
+
+// copyFiles copies files preserving directory structure relative to baseDir.
+//
+// Existing files get replaced.
+func (c *copier) copyFiles(baseDir string, relPaths []string, dst string) error {
+	for _, p := range relPaths {
+		if err := c.copyPath(baseDir, p, dst); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// copyPath copies baseDir/rel to dst/rel.
+//
+// Missing parent directories are created with permissions of the source ones.
+func (c *copier) copyPath(baseDir, rel, dst string) error {
+	rel = filepath.Clean(rel)
+	if filepath.IsAbs(rel) || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("copy %s: path is not relative to %s", rel, baseDir)
+	}
+
+	if dir := filepath.Dir(rel); dir != "." {
+		var prefix string
+		for _, name := range strings.Split(dir, string(filepath.Separator)) {
+			prefix = filepath.Join(prefix, name)
+			if err := c.mkdir(filepath.Join(baseDir, prefix), filepath.Join(dst, prefix)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return c.copyTree(filepath.Join(baseDir, rel), filepath.Join(dst, rel))
+}
+
+func (c *copier) excluded(name string) bool {
+	for _, e := range c.exclude {
+		if name == e {
+			return true
+		}
+	}
+	return false
+}
+
+// mkdir creates dst directory with permissions of src, if dst does not exist.
+func (c *copier) mkdir(src, dst string) error {
+	if fi, err := os.Stat(dst); err == nil && fi.IsDir() {
+		return nil
+	}
+
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+	if err := os.Mkdir(dst, 0700); err != nil {
+		return err
+	}
+	return os.Chmod(dst, fi.Mode().Perm())
+}
+
+// copyTree recursively copies src to dst.
+func (c *copier) copyTree(src, dst string) error {
+	fi, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+
+	if c.excluded(fi.Name()) {
+		return nil
+	}
+
+	switch {
+	case fi.Mode().IsRegular():
+		return c.copyFile(src, dst, fi)
+	case !fi.IsDir():
+		return nil
+	}
+
+	if dstInfo, err := os.Lstat(dst); err == nil && !dstInfo.IsDir() {
+		if err := os.Remove(dst); err != nil {
+			return err
+		}
+	}
+	if err := os.Mkdir(dst, 0700); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	entries, err := os.ReadDir(src)
+	if err != nil {
+		return err
+	}
+
+	for _, e := range entries {
+		if err := c.copyTree(filepath.Join(src, e.Name()), filepath.Join(dst, e.Name())); err != nil {
+			return err
+		}
+	}
+
+	// Permissions are set after copying contents, so that read-only directories can be copied too.
+	return os.Chmod(dst, fi.Mode().Perm())
+}
+
+// copyFile replaces dst with the copy of regular file src.
+//
+// Only permission bits are preserved. Setuid and setgid bits are dropped.
+func (c *copier) copyFile(src, dst string, fi os.FileInfo) error {
+	if err := os.RemoveAll(dst); err != nil {
+		return err
+	}
+
+	if c.hardlink && fi.Mode().Perm()&0o002 == 0 {
+		if err := os.Link(src, dst); err == nil {
+			return nil
+		}
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = in.Close() }()
+
+	out, err := os.OpenFile(dst, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+
+	if err := cloneFile(out, in); err != nil {
+		_, err = io.Copy(out, in)
+		if err != nil {
+			_ = out.Close()
+			return err
+		}
+	}
+
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chmod(dst, fi.Mode().Perm())
+}
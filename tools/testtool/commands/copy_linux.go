@@ -0,0 +1,16 @@
+//go:build linux
+
+package commands
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// cloneFile makes dst a copy-on-write clone of src.
+//
+// Fails on filesystems without reflink support and when files are on different filesystems.
+func cloneFile(dst, src *os.File) error {
+	return unix.IoctlFileClone(int(dst.Fd()), int(src.Fd()))
+}
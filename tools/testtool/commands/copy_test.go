@@ -0,0 +1,142 @@
+package commands
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func requireSameContent(t *testing.T, expected, actual string) {
+	t.Helper()
+
+	expectedData, err := os.ReadFile(expected)
+	require.NoError(t, err)
+	actualData, err := os.ReadFile(actual)
+	require.NoError(t, err)
+	require.Equal(t, string(expectedData), string(actualData), actual)
+}
+
+func Test_copier_submission(t *testing.T) {
+	const problem = "sum"
+
+	studentRepo, err := filepath.Abs("../testdata/submissions/correct/sum/student")
+	require.NoError(t, err)
+	privateRepo, err := filepath.Abs("../testdata/submissions/correct/sum/private")
+	require.NoError(t, err)
+	privateProblem := path.Join(privateRepo, problem)
+
+	for _, hardlink := range []bool{false, true} {
+		dst := t.TempDir()
+		c := &copier{hardlink: hardlink, exclude: []string{".git"}}
+
+		require.NoError(t, c.copyContents(studentRepo, ".", dst))
+		require.NoError(t, c.copyFiles(privateRepo, relPaths(privateRepo, listTestFiles(privateProblem)), dst))
+		require.NoError(t, c.copyFiles(privateRepo, relPaths(privateRepo, listProtectedFiles(privateProblem)), dst))
+		require.NoError(t, c.copyDir(privateRepo, path.Join(problem, testdataDir), dst))
+		require.NoError(t, c.copyDir(privateRepo, path.Join(problem, "missing"), dst))
+		require.NoError(t, c.copyFiles(privateRepo, []string{"go.mod", "go.sum", ".golangci.yml"}, dst))
+
+		for _, f := range []string{"sum/sum.go", "sum/pkg/f.go"} {
+			requireSameContent(t, filepath.Join(studentRepo, f), filepath.Join(dst, f))
+		}
+		for _, f := range []string{"sum/sum_test.go", "sum/sum_private_test.go", "sum/testdata/tests.csv", "go.mod", ".golangci.yml"} {
+			requireSameContent(t, filepath.Join(privateRepo, f), filepath.Join(dst, f))
+		}
+		require.NoFileExists(t, filepath.Join(dst, "sum/sum_solution.go"))
+		require.NoDirExists(t, filepath.Join(dst, "sum/missing"))
+
+		// Private tests replaced student ones in the copy, but not in the student repo.
+		require.NotEqual(t, readFile(t, filepath.Join(studentRepo, "sum/sum_test.go")), readFile(t, filepath.Join(dst, "sum/sum_test.go")))
+		require.NotEqual(t, readFile(t, filepath.Join(studentRepo, "sum/sum_test.go")), readFile(t, filepath.Join(privateRepo, "sum/sum_test.go")))
+	}
+}
+
+func readFile(t *testing.T, name string) string {
+	t.Helper()
+
+	data, err := os.ReadFile(name)
+	require.NoError(t, err)
+	return string(data)
+}
+
+func Test_copier_tree(t *testing.T) {
+	src := t.TempDir()
+
+	require.NoError(t, os.MkdirAll(filepath.Join(src, ".git/objects"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, ".git/HEAD"), []byte("ref"), 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "task/sub/.git"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "task/run.sh"), []byte("#!/bin/sh"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "task/secret"), []byte("secret"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "task/sub/data"), []byte("data"), 0644))
+	require.NoError(t, os.Symlink("/etc/passwd", filepath.Join(src, "task/passwd")))
+	require.NoError(t, os.Chmod(filepath.Join(src, "task/sub"), 0555))
+	defer func() { _ = os.Chmod(filepath.Join(src, "task/sub"), 0755) }()
+
+	dst := t.TempDir()
+	c := &copier{exclude: []string{".git"}}
+	require.NoError(t, c.copyContents(src, ".", dst))
+	defer func() { _ = os.Chmod(filepath.Join(dst, "task/sub"), 0755) }()
+
+	require.NoDirExists(t, filepath.Join(dst, ".git"))
+	require.NoDirExists(t, filepath.Join(dst, "task/sub/.git"))
+	require.Equal(t, "data", readFile(t, filepath.Join(dst, "task/sub/data")))
+
+	_, err := os.Lstat(filepath.Join(dst, "task/passwd"))
+	require.True(t, os.IsNotExist(err), "symlinks are skipped")
+
+	for name, mode := range map[string]os.FileMode{
+		"task/run.sh": 0755,
+		"task/secret": 0600,
+		"task/sub":    0555 | os.ModeDir,
+	} {
+		fi, err := os.Stat(filepath.Join(dst, name))
+		require.NoError(t, err)
+		require.Equal(t, mode, fi.Mode(), name)
+	}
+
+	// Single file with implied parent directories.
+	other := t.TempDir()
+	require.NoError(t, c.copyFiles(src, []string{"task/sub/data"}, other))
+	require.Equal(t, "data", readFile(t, filepath.Join(other, "task/sub/data")))
+	fi, err := os.Stat(filepath.Join(other, "task/sub"))
+	require.NoError(t, err)
+	require.Equal(t, 0555|os.ModeDir, fi.Mode())
+	require.NoError(t, os.Chmod(filepath.Join(other, "task/sub"), 0755))
+
+	require.Error(t, c.copyFiles(src, []string{"../etc/passwd"}, other))
+	require.Error(t, c.copyFiles(src, []string{"task/missing"}, other))
+}
+
+func Test_copier_hardlink(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(src, "original"), []byte("original"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "shared"), []byte("shared"), 0666))
+	require.NoError(t, os.Chmod(filepath.Join(src, "shared"), 0666))
+
+	override := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(override, "original"), []byte("override"), 0644))
+
+	dst := t.TempDir()
+	c := &copier{hardlink: true}
+	require.NoError(t, c.copyFiles(src, []string{"original", "shared"}, dst))
+
+	srcInfo, err := os.Stat(filepath.Join(src, "original"))
+	require.NoError(t, err)
+	dstInfo, err := os.Stat(filepath.Join(dst, "original"))
+	require.NoError(t, err)
+	require.True(t, os.SameFile(srcInfo, dstInfo))
+
+	srcInfo, err = os.Stat(filepath.Join(src, "shared"))
+	require.NoError(t, err)
+	dstInfo, err = os.Stat(filepath.Join(dst, "shared"))
+	require.NoError(t, err)
+	require.False(t, os.SameFile(srcInfo, dstInfo), "world-writable files are copied")
+
+	// Replacing the linked file does not modify the source.
+	require.NoError(t, c.copyFiles(override, []string{"original"}, dst))
+	require.Equal(t, "override", readFile(t, filepath.Join(dst, "original")))
+	require.Equal(t, "original", readFile(t, filepath.Join(src, "original")))
+}
@@ -2,48 +2,154 @@ package commands
 
 import (
 	"fmt"
+	"go/ast"
 	"go/parser"
 	"go/token"
+	"path"
+	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 
 	"golang.org/x/tools/cover"
 )
 
-// coverageCommentPrefix is a prefix of coverage comment.
+// Coverage comments specify test coverage requirements of the problem.
 //
-// Coverage comment has the following form:
+// Minimum coverage of all listed packages together, relative to the problem directory:
 //
-// // min coverage: 80.5%
-const coverageCommentPrefix = "min coverage: "
+// // min coverage: .,subpkg 80.5%
+//
+// Minimum coverage of each listed function of the package. Methods are named Type.Method:
+//
+// // min func coverage: . Sum,Stack.Push 100%
+//
+// Files excluded from coverage, as path.Match patterns relative to the problem directory.
+// Pattern without '/' matches the file name in any directory:
+//
+// // coverage exclude: subpkg/generated.go,*_mock.go
+const (
+	coverageCommentPrefix        = "min coverage: "
+	funcCoverageCommentPrefix    = "min func coverage: "
+	coverageExcludeCommentPrefix = "coverage exclude: "
+)
 
 type CoverageRequirements struct {
-	Enabled  bool
-	Percent  float64
+	Enabled bool
+
+	// Percent is the minimum coverage of the first min coverage comment.
+	Percent float64
+
+	// Packages are all packages mentioned in coverage comments. Coverage is measured for them only.
 	Packages []string
+
+	// Thresholds are minimum coverages of package groups, one per min coverage comment.
+	Thresholds []PackageCoverage
+
+	// Functions are minimum coverages of single functions.
+	Functions []FuncCoverage
+
+	// Exclude are patterns of files excluded from coverage.
+	Exclude []string
+}
+
+// PackageCoverage is a minimum coverage of all listed packages together.
+type PackageCoverage struct {
+	Packages []string
+	Percent  float64
+}
+
+// FuncCoverage is a minimum coverage of a single function.
+type FuncCoverage struct {
+	Package string
+	Func    string
+	Percent float64
 }
 
-// getCoverageRequirements searches for comment in test files
-// that specifies test coverage requirements.
+// getCoverageRequirements collects coverage comments from all test files.
 //
-// Stops on first matching comment.
+// If several min coverage comments mention the same packages, the first one is used.
 func getCoverageRequirements(rootPackage string) *CoverageRequirements {
-	files := listTestFiles(rootPackage)
+	r := &CoverageRequirements{}
 
-	for _, f := range files {
-		if r, _ := searchCoverageComment(f); r.Enabled {
-			return r
+	for _, f := range listTestFiles(rootPackage) {
+		fileReq, err := searchCoverageComment(f)
+		if err != nil {
+			continue
 		}
+		r.merge(fileReq)
 	}
 
-	return &CoverageRequirements{}
+	return r
 }
 
-// searchCoverageComment searches for the first occurrence of the comment of the form
-//
-// // min coverage: 80.5%
+func (r *CoverageRequirements) merge(other *CoverageRequirements) {
+	for _, t := range other.Thresholds {
+		if r.hasPackages(t.Packages) {
+			continue
+		}
+		if len(r.Thresholds) == 0 {
+			r.Percent = t.Percent
+		}
+		r.Thresholds = append(r.Thresholds, t)
+		r.addPackages(t.Packages...)
+	}
+
+	for _, f := range other.Functions {
+		if r.hasFunc(f.Package, f.Func) {
+			continue
+		}
+		r.Functions = append(r.Functions, f)
+		r.addPackages(f.Package)
+	}
+
+	r.Exclude = append(r.Exclude, other.Exclude...)
+	r.Enabled = len(r.Thresholds) != 0 || len(r.Functions) != 0
+}
+
+// hasPackages reports whether some threshold is set for exactly the same pkgs.
+func (r *CoverageRequirements) hasPackages(pkgs []string) bool {
+	key := func(pkgs []string) string {
+		clean := make([]string, len(pkgs))
+		for i, p := range pkgs {
+			clean[i] = path.Clean(p)
+		}
+		sort.Strings(clean)
+		return strings.Join(clean, ",")
+	}
+
+	for _, t := range r.Thresholds {
+		if key(t.Packages) == key(pkgs) {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *CoverageRequirements) hasFunc(pkg, name string) bool {
+	for _, f := range r.Functions {
+		if path.Clean(f.Package) == path.Clean(pkg) && f.Func == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (r *CoverageRequirements) addPackages(pkgs ...string) {
+	for _, pkg := range pkgs {
+		found := false
+		for _, p := range r.Packages {
+			found = found || path.Clean(p) == path.Clean(pkg)
+		}
+		if !found {
+			r.Packages = append(r.Packages, pkg)
+		}
+	}
+}
+
+// searchCoverageComment collects coverage comments of the file.
 //
-// Stops on the first matching comment.
+// Malformed comments are ignored.
 func searchCoverageComment(fname string) (*CoverageRequirements, error) {
 	fset := token.NewFileSet()
 
@@ -52,56 +158,115 @@ func searchCoverageComment(fname string) (*CoverageRequirements, error) {
 		return nil, err
 	}
 
+	r := &CoverageRequirements{}
 	for _, c := range f.Comments {
-		t := c.Text()
-		if !strings.HasPrefix(t, coverageCommentPrefix) || !strings.HasSuffix(t, "%\n") {
-			continue
-		}
-		t = strings.TrimPrefix(t, coverageCommentPrefix)
-		t = strings.TrimSuffix(t, "%\n")
+		for _, line := range strings.Split(c.Text(), "\n") {
+			switch {
+			case strings.HasPrefix(line, coverageCommentPrefix):
+				fields, percent, ok := parseCoverageComment(strings.TrimPrefix(line, coverageCommentPrefix), 1)
+				if ok {
+					r.merge(&CoverageRequirements{Thresholds: []PackageCoverage{{
+						Packages: strings.Split(fields[0], ","),
+						Percent:  percent,
+					}}})
+				}
 
-		parts := strings.Split(t, " ")
-		if len(parts) != 2 {
-			continue
-		}
+			case strings.HasPrefix(line, funcCoverageCommentPrefix):
+				fields, percent, ok := parseCoverageComment(strings.TrimPrefix(line, funcCoverageCommentPrefix), 2)
+				if ok {
+					for _, name := range strings.Split(fields[1], ",") {
+						r.merge(&CoverageRequirements{Functions: []FuncCoverage{{
+							Package: fields[0],
+							Func:    name,
+							Percent: percent,
+						}}})
+					}
+				}
 
-		percent, err := strconv.ParseFloat(parts[1], 64)
-		if err != nil {
-			continue
+			case strings.HasPrefix(line, coverageExcludeCommentPrefix):
+				patterns := strings.TrimPrefix(line, coverageExcludeCommentPrefix)
+				if patterns == "" || strings.Contains(patterns, " ") {
+					continue
+				}
+				for _, p := range strings.Split(patterns, ",") {
+					if _, err := path.Match(p, ""); err == nil && p != "" {
+						r.Exclude = append(r.Exclude, p)
+					}
+				}
+			}
 		}
-		if percent < 0 || percent > 100.0 {
-			continue
+	}
+
+	return r, nil
+}
+
+// parseCoverageComment parses comment of the form "field1 ... fieldN 80.5%".
+func parseCoverageComment(t string, n int) (fields []string, percent float64, ok bool) {
+	if !strings.HasSuffix(t, "%") {
+		return nil, 0, false
+	}
+
+	parts := strings.Split(strings.TrimSuffix(t, "%"), " ")
+	if len(parts) != n+1 {
+		return nil, 0, false
+	}
+	for _, p := range parts[:n] {
+		if p == "" {
+			return nil, 0, false
 		}
+	}
+
+	percent, err := strconv.ParseFloat(parts[n], 64)
+	if err != nil || percent < 0 || percent > 100.0 {
+		return nil, 0, false
+	}
+
+	return parts[:n], percent, true
+}
+
+// coverageBlock is a block of the coverage profile merged from all test runs.
+type coverageBlock struct {
+	// file is a slash-separated path relative to the problem directory.
+	file                string
+	startLine, startCol int
+	endLine, endCol     int
+	numStmt             int
+	count               int
+}
 
-		return &CoverageRequirements{
-			Enabled:  true,
-			Percent:  percent,
-			Packages: strings.Split(parts[0], ","),
-		}, nil
+// position returns position of the block in the form of problem/file.go:line.
+func (b *coverageBlock) position(problem string) string {
+	if b.startLine == b.endLine {
+		return fmt.Sprintf("%s:%d", path.Join(problem, b.file), b.startLine)
 	}
+	return fmt.Sprintf("%s:%d-%d", path.Join(problem, b.file), b.startLine, b.endLine)
+}
 
-	return &CoverageRequirements{}, nil
+// coverage is a coverage of the problem packages merged from several coverage profiles.
+type coverage struct {
+	problem string
+	blocks  []coverageBlock
 }
 
-// calCoverage calculates coverage percent for given coverage profile.
-func calCoverage(fileNames []string) (float64, error) {
-	type block struct {
+// loadCoverage parses coverage profiles and sums counts of the same blocks.
+func loadCoverage(problem string, fileNames []string) (*coverage, error) {
+	type key struct {
 		fileName            string
 		startLine, startCol int
 		endLine, endCol     int
 		numStmt             int
 	}
-	counts := map[block]int{}
+	counts := map[key]int{}
 
 	for _, f := range fileNames {
 		profiles, err := cover.ParseProfiles(f)
 		if err != nil {
-			return 0.0, fmt.Errorf("cannot parse coverage profile file %s: %w", f, err)
+			return nil, fmt.Errorf("cannot parse coverage profile file %s: %w", f, err)
 		}
 
 		for _, p := range profiles {
 			for _, b := range p.Blocks {
-				counts[block{
+				counts[key{
 					p.FileName,
 					b.StartLine, b.StartCol,
 					b.EndLine, b.EndCol,
@@ -111,17 +276,178 @@ func calCoverage(fileNames []string) (float64, error) {
 		}
 	}
 
+	problemPrefix := path.Join(moduleImportPath, problem) + "/"
+
+	c := &coverage{problem: problem}
+	for k, count := range counts {
+		c.blocks = append(c.blocks, coverageBlock{
+			file:      strings.TrimPrefix(k.fileName, problemPrefix),
+			startLine: k.startLine, startCol: k.startCol,
+			endLine: k.endLine, endCol: k.endCol,
+			numStmt: k.numStmt,
+			count:   count,
+		})
+	}
+
+	sort.Slice(c.blocks, func(i, j int) bool {
+		a, b := c.blocks[i], c.blocks[j]
+		if a.file != b.file {
+			return a.file < b.file
+		}
+		if a.startLine != b.startLine {
+			return a.startLine < b.startLine
+		}
+		return a.startCol < b.startCol
+	})
+
+	return c, nil
+}
+
+// exclude drops blocks of the files matching any of patterns.
+func (c *coverage) exclude(patterns []string) {
+	blocks := c.blocks[:0]
+	for _, b := range c.blocks {
+		excluded := false
+		for _, p := range patterns {
+			if excludePatternMatch(p, b.file) {
+				excluded = true
+			}
+		}
+		if !excluded {
+			blocks = append(blocks, b)
+		}
+	}
+	c.blocks = blocks
+}
+
+// excludePatternMatch reports whether file relative to the problem directory matches exclude pattern.
+func excludePatternMatch(pattern, file string) bool {
+	if !strings.Contains(pattern, "/") {
+		file = path.Base(file)
+	}
+	ok, _ := path.Match(pattern, file)
+	return ok
+}
+
+// percent calculates coverage percent of the blocks matching filter.
+//
+// Returns positions of uncovered blocks.
+func (c *coverage) percent(filter func(b *coverageBlock) bool) (percent float64, uncovered []string) {
 	var total, covered int
-	for b, count := range counts {
+	for i := range c.blocks {
+		b := &c.blocks[i]
+		if !filter(b) {
+			continue
+		}
+
 		total += b.numStmt
-		if count > 0 {
+		if b.count > 0 {
 			covered += b.numStmt
+		} else {
+			uncovered = append(uncovered, b.position(c.problem))
 		}
 	}
 
 	if total == 0 {
-		return 0.0, nil
+		return 0.0, uncovered
+	}
+
+	return float64(covered) / float64(total) * 100, uncovered
+}
+
+// total calculates coverage percent of all blocks.
+func (c *coverage) total() float64 {
+	percent, _ := c.percent(func(*coverageBlock) bool { return true })
+	return percent
+}
+
+// check checks coverage requirements.
+//
+// srcDir is a directory of the problem sources, that are parsed to find function boundaries.
+// Uncovered blocks are listed for failed checks only.
+func (c *coverage) check(req *CoverageRequirements, srcDir string) ([]CoverageCheck, error) {
+	var checks []CoverageCheck
+
+	for _, t := range req.Thresholds {
+		pkgs := map[string]bool{}
+		for _, pkg := range t.Packages {
+			pkgs[path.Clean(pkg)] = true
+		}
+
+		percent, uncovered := c.percent(func(b *coverageBlock) bool {
+			return pkgs[path.Dir(b.file)]
+		})
+		checks = append(checks, newCoverageCheck("packages "+strings.Join(t.Packages, ","), percent, t.Percent, uncovered))
+	}
+
+	for _, f := range req.Functions {
+		inFunc, err := c.funcFilter(srcDir, path.Clean(f.Package), f.Func)
+		if err != nil {
+			return nil, err
+		}
+
+		percent, uncovered := c.percent(inFunc)
+		checks = append(checks, newCoverageCheck("function "+path.Join(f.Package, f.Func), percent, f.Percent, uncovered))
+	}
+
+	return checks, nil
+}
+
+// funcFilter returns filter of the blocks that belong to function name of package pkg.
+func (c *coverage) funcFilter(srcDir, pkg, name string) (func(b *coverageBlock) bool, error) {
+	parsed := map[string]bool{}
+	for _, b := range c.blocks {
+		if path.Dir(b.file) != pkg || parsed[b.file] {
+			continue
+		}
+		parsed[b.file] = true
+
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, filepath.Join(srcDir, filepath.FromSlash(b.file)), nil, 0)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, d := range f.Decls {
+			fn, ok := d.(*ast.FuncDecl)
+			if !ok || funcName(fn) != name {
+				continue
+			}
+
+			file := b.file
+			start, end := fset.Position(fn.Pos()), fset.Position(fn.End())
+			return func(b *coverageBlock) bool {
+				return b.file == file &&
+					(b.startLine > start.Line || b.startLine == start.Line && b.startCol >= start.Column) &&
+					(b.endLine < end.Line || b.endLine == end.Line && b.endCol <= end.Column)
+			}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("function %s is not found in package %s", name, pkg)
+}
+
+// funcName returns name of the function, or Type.Method for methods.
+func funcName(fn *ast.FuncDecl) string {
+	if fn.Recv == nil || len(fn.Recv.List) == 0 {
+		return fn.Name.Name
 	}
 
-	return float64(covered) / float64(total) * 100, nil
+	typ := fn.Recv.List[0].Type
+	for {
+		switch t := typ.(type) {
+		case *ast.StarExpr:
+			typ = t.X
+			continue
+		case *ast.IndexExpr:
+			typ = t.X
+			continue
+		case *ast.IndexListExpr:
+			typ = t.X
+			continue
+		case *ast.Ident:
+			return t.Name + "." + fn.Name.Name
+		}
+		return fn.Name.Name
+	}
 }
@@ -1,6 +1,7 @@
 package commands
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -12,3 +13,76 @@ func Test_getCoverageRequirements(t *testing.T) {
 	require.Equal(t, 90.0, r.Percent)
 	require.Equal(t, []string{"."}, r.Packages)
 }
+
+func Test_getCoverageRequirements_directives(t *testing.T) {
+	r := getCoverageRequirements("../testdata/coverage/directives")
+	require.True(t, r.Enabled)
+	require.Equal(t, 70.0, r.Percent)
+	require.Equal(t, []string{".", "subpkg"}, r.Packages)
+	require.Equal(t, []PackageCoverage{
+		{Packages: []string{".", "subpkg"}, Percent: 70},
+		{Packages: []string{"subpkg"}, Percent: 100},
+	}, r.Thresholds)
+	require.Equal(t, []FuncCoverage{
+		{Package: ".", Func: "Abs", Percent: 100},
+		{Package: ".", Func: "Stack.Push", Percent: 100},
+	}, r.Functions)
+	require.Equal(t, []string{"gen.go"}, r.Exclude)
+}
+
+func Test_excludePatternMatch(t *testing.T) {
+	for _, tc := range []struct {
+		pattern, file string
+		match         bool
+	}{
+		{"*_mock.go", "a_mock.go", true},
+		{"*_mock.go", "subpkg/a_mock.go", true},
+		{"*_mock.go", "subpkg/a.go", false},
+		{"subpkg/*.go", "subpkg/a.go", true},
+		{"subpkg/*.go", "other/subpkg/a.go", false},
+		{"*/gen.go", "subpkg/gen.go", true},
+		{"*/gen.go", "gen.go", false},
+	} {
+		require.Equal(t, tc.match, excludePatternMatch(tc.pattern, tc.file), "%s %s", tc.pattern, tc.file)
+	}
+}
+
+func Test_coverage_check(t *testing.T) {
+	dir := "../testdata/coverage/directives"
+
+	c, err := loadCoverage("directives", []string{filepath.Join(dir, "a.out"), filepath.Join(dir, "b.out")})
+	require.NoError(t, err)
+	c.exclude([]string{"gen.go"})
+
+	require.InDelta(t, 60.0, c.total(), 1e-9)
+
+	checks, err := c.check(&CoverageRequirements{
+		Thresholds: []PackageCoverage{
+			{Packages: []string{".", "subpkg"}, Percent: 70},
+			{Packages: []string{"subpkg"}, Percent: 100},
+		},
+		Functions: []FuncCoverage{
+			{Package: ".", Func: "Abs", Percent: 100},
+			{Package: ".", Func: "Stack.Push", Percent: 100},
+		},
+	}, dir)
+	require.NoError(t, err)
+	require.Len(t, checks, 4)
+
+	require.Equal(t, "packages .,subpkg", checks[0].Name)
+	require.False(t, checks[0].Passed)
+	require.InDelta(t, 60.0, checks[0].Percent, 1e-9)
+	require.Equal(t, []string{"directives/directives.go:4-6", "directives/directives.go:18-22"}, checks[0].Uncovered)
+
+	require.Equal(t, CoverageCheck{Name: "packages subpkg", Percent: 100, Required: 100, Passed: true}, checks[1])
+
+	require.Equal(t, "function Abs", checks[2].Name)
+	require.False(t, checks[2].Passed)
+	require.InDelta(t, 200.0/3, checks[2].Percent, 1e-9)
+	require.Equal(t, []string{"directives/directives.go:4-6"}, checks[2].Uncovered)
+
+	require.Equal(t, CoverageCheck{Name: "function Stack.Push", Percent: 100, Required: 100, Passed: true}, checks[3])
+
+	_, err = c.check(&CoverageRequirements{Functions: []FuncCoverage{{Package: "subpkg", Func: "Min", Percent: 100}}}, dir)
+	require.Error(t, err)
+}
@@ -1,11 +1,14 @@
 package commands
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sync"
 
 	"github.com/spf13/cobra"
 )
@@ -13,9 +16,14 @@ import (
 const (
 	privateRepoRoot = "/opt/shad"
 	manytaskYML     = ".manytask.yml"
+
+	jobsFlag = "jobs"
 )
 
-func grade() error {
+// grade tests all changed tasks using at most jobs concurrent workers.
+//
+// If reportOpts is not nil, results of all tasks are written into single report.
+func grade(jobs int, reportOpts *reportOptions) error {
 	userID := os.Getenv("GITLAB_USER_ID")
 	testerToken := os.Getenv("TESTER_TOKEN")
 	submitRoot := os.Getenv("CI_PROJECT_DIR")
@@ -33,13 +41,40 @@ func grade() error {
 	changedTasks := findChangedTasks(deadlines, changedFiles)
 	log.Printf("detected change in tasks %v", changedTasks)
 
-	var failed bool
+	// Tasks are kept in the order of changedTasks, regardless of the order of completion.
+	report := &Report{}
+	taskReports := make(map[string]*TaskReport)
 	for _, task := range changedTasks {
-		log.Printf("testing task %s", task)
+		if taskReport := reportOpts.newTaskReport(task); taskReport != nil {
+			report.Tasks = append(report.Tasks, taskReport)
+			taskReports[task] = taskReport
+		}
+	}
+	if reportOpts != nil {
+		defer func() {
+			if err := reportOpts.write(report); err != nil {
+				log.Print(err)
+			}
+		}()
+	}
 
-		var testFailed bool
+	test := func(task string, stdout, stderr io.Writer, logger *log.Logger) error {
+		s := &submission{
+			studentRepo: submitRoot,
+			privateRepo: privateRepoRoot,
+			problem:     task,
+			report:      taskReports[task],
+			stdout:      stdout,
+			stderr:      stderr,
+			log:         logger,
+		}
+		return s.test()
+	}
 
-		err := testSubmission(submitRoot, privateRepoRoot, task)
+	var failed bool
+	var errs []error
+	testTasks(changedTasks, jobs, os.Stdout, os.Stderr, test, func(task string, err error) {
+		var testFailed bool
 		if err != nil {
 			log.Printf("task %s failed: %s", task, err)
 			failed = true
@@ -48,29 +83,96 @@ func grade() error {
 			testFailed = errors.As(err, &testFailedErr)
 
 			if !testFailed {
-				continue
+				return
 			}
 		} else {
 			log.Printf("task %s passed", task)
 		}
 
 		if err := reportTestResults(testerToken, task, userID, testFailed); err != nil {
-			log.Fatal(err)
+			errs = append(errs, fmt.Errorf("reporting task %s: %w", task, err))
 		}
-	}
+	})
 
 	if failed {
-		return fmt.Errorf("some tasks failed")
+		errs = append(errs, fmt.Errorf("some tasks failed"))
+	}
+
+	return errors.Join(errs...)
+}
+
+// testTasks tests tasks using at most jobs concurrent workers.
+//
+// done is called from the calling goroutine in the order tasks finish.
+//
+// With single worker output of the task goes to stdout and stderr as is. Otherwise output
+// of each task is buffered and printed to stdout after the task is finished,
+// so that output of the tasks tested concurrently does not interleave.
+func testTasks(
+	tasks []string,
+	jobs int,
+	stdout, stderr io.Writer,
+	test func(task string, stdout, stderr io.Writer, logger *log.Logger) error,
+	done func(task string, err error),
+) {
+	if jobs <= 1 {
+		logger := log.New(stderr, log.Prefix(), log.Flags())
+		for _, task := range tasks {
+			logger.Printf("testing task %s", task)
+			done(task, test(task, stdout, stderr, logger))
+		}
+		return
+	}
+
+	type result struct {
+		task   string
+		err    error
+		output *bytes.Buffer
+	}
+
+	results := make(chan result)
+	workers := make(chan struct{}, jobs)
+	for _, task := range tasks {
+		go func(task string) {
+			workers <- struct{}{}
+			defer func() { <-workers }()
+
+			var output bytes.Buffer
+			w := &syncWriter{w: &output}
+			logger := log.New(w, log.Prefix(), log.Flags())
+
+			logger.Printf("testing task %s", task)
+			err := test(task, w, w, logger)
+			results <- result{task: task, err: err, output: &output}
+		}(task)
 	}
 
-	return nil
+	for range tasks {
+		r := <-results
+
+		_, _ = fmt.Fprintf(stdout, "===== %s =====\n", r.task)
+		_, _ = r.output.WriteTo(stdout)
+		_, _ = fmt.Fprintf(stdout, "===== end of %s =====\n", r.task)
+
+		done(r.task, r.err)
+	}
 }
 
 var gradeCmd = &cobra.Command{
 	Use:   "grade",
 	Short: "test all tasks in the last commit",
 	Run: func(cmd *cobra.Command, args []string) {
-		if err := grade(); err != nil {
+		reportOpts, err := parseReportFlags(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		jobs, err := cmd.Flags().GetInt(jobsFlag)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		if err := grade(jobs, reportOpts); err != nil {
 			fmt.Fprintf(os.Stderr, "%v\n", err)
 			os.Exit(1)
 		}
@@ -79,4 +181,21 @@ var gradeCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(gradeCmd)
+	addReportFlags(gradeCmd)
+
+	gradeCmd.Flags().IntP(jobsFlag, "j", 1, "number of tasks tested concurrently; "+
+		"benchmarks of concurrent tasks affect each other, so the comparison with baseline becomes noisier; "+
+		"all tests run as nobody, so concurrent tasks also share the limit on the number of processes")
+}
+
+// syncWriter serializes writes to w.
+type syncWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func (w *syncWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.w.Write(p)
 }
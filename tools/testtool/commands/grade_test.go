@@ -0,0 +1,83 @@
+package commands
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"log"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestTasks(t *testing.T) {
+	tasks := []string{"sum", "wordcount", "fetchall", "hotelbusiness"}
+
+	for _, jobs := range []int{1, 2, 4} {
+		t.Run(fmt.Sprint(jobs), func(t *testing.T) {
+			var (
+				mu         sync.Mutex
+				running    int
+				maxRunning int
+			)
+
+			test := func(task string, stdout, stderr io.Writer, logger *log.Logger) error {
+				mu.Lock()
+				running++
+				if running > maxRunning {
+					maxRunning = running
+				}
+				mu.Unlock()
+
+				for i := 0; i < 100; i++ {
+					_, _ = fmt.Fprintf(stdout, "%s stdout\n", task)
+					logger.Printf("%s log", task)
+				}
+
+				mu.Lock()
+				running--
+				mu.Unlock()
+
+				if task == "fetchall" {
+					return fmt.Errorf("%s failed", task)
+				}
+				return nil
+			}
+
+			var stdout, stderr bytes.Buffer
+			results := map[string]error{}
+			testTasks(tasks, jobs, &stdout, &stderr, test, func(task string, err error) {
+				results[task] = err
+			})
+
+			require.Len(t, results, len(tasks))
+			require.NoError(t, results["sum"])
+			require.EqualError(t, results["fetchall"], "fetchall failed")
+			require.LessOrEqual(t, maxRunning, jobs)
+
+			if jobs == 1 {
+				return
+			}
+
+			// Output of each task is printed as a single block.
+			var current string
+			var blocks []string
+			for _, line := range strings.Split(strings.TrimSuffix(stdout.String(), "\n"), "\n") {
+				switch {
+				case strings.HasPrefix(line, "===== end of "):
+					require.Equal(t, "===== end of "+current+" =====", line)
+					current = ""
+				case strings.HasPrefix(line, "===== "):
+					require.Empty(t, current)
+					current = strings.Trim(line, "= ")
+					blocks = append(blocks, current)
+				default:
+					require.Contains(t, line, current)
+				}
+			}
+			require.ElementsMatch(t, tasks, blocks)
+		})
+	}
+}
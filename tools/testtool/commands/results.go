@@ -0,0 +1,573 @@
+package commands
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/perf/benchstat"
+)
+
+const (
+	reportFlag     = "report"
+	reportFileFlag = "report-file"
+
+	reportFormatJSON  = "json"
+	reportFormatJUnit = "junit"
+)
+
+// Names of the steps of submission testing that might fail.
+const (
+	StepSetup     = "setup"
+	StepBuild     = "build"
+	StepTest      = "test"
+	StepRace      = "race"
+	StepBenchmark = "benchmark"
+	StepCoverage  = "coverage"
+	StepLint      = "lint"
+)
+
+// Test statuses.
+const (
+	TestPass = "pass"
+	TestFail = "fail"
+	TestSkip = "skip"
+)
+
+// Report is a machine-readable result of testing one or more tasks.
+type Report struct {
+	Tasks []*TaskReport `json:"tasks"`
+}
+
+// TaskReport is a result of testing single task.
+//
+// Methods of TaskReport that record results are no-op on nil receiver,
+// so testing code does not need to check whether report was requested.
+type TaskReport struct {
+	Task     string        `json:"task"`
+	Passed   bool          `json:"passed"`
+	Duration time.Duration `json:"duration_ns"`
+
+	// Step is the step that failed. Empty if task passed.
+	Step  string `json:"failed_step,omitempty"`
+	Error string `json:"error,omitempty"`
+
+	Tests      []TestResult      `json:"tests,omitempty"`
+	Races      []RaceReport      `json:"races,omitempty"`
+	Benchmarks []BenchmarkResult `json:"benchmarks,omitempty"`
+	Coverage   *CoverageResult   `json:"coverage,omitempty"`
+	Lint       []LintIssue       `json:"lint,omitempty"`
+}
+
+// TestResult is a result of single test function run.
+type TestResult struct {
+	Package  string        `json:"package"`
+	Name     string        `json:"name"`
+	Status   string        `json:"status"`
+	Duration time.Duration `json:"duration_ns"`
+
+	// Race is true for runs of the test binary built with race detector.
+	Race bool `json:"race,omitempty"`
+
+	// Output contains test log of failed test.
+	Output string `json:"output,omitempty"`
+}
+
+// RaceReport is a single data race detected by race detector.
+type RaceReport struct {
+	Package string `json:"package"`
+	Test    string `json:"test,omitempty"`
+	Report  string `json:"report"`
+}
+
+// BenchmarkResult is a comparison of the solution benchmark with the baseline.
+type BenchmarkResult struct {
+	Package   string  `json:"package"`
+	Name      string  `json:"name"`
+	Unit      string  `json:"unit"`
+	Baseline  float64 `json:"baseline"`
+	Solution  float64 `json:"solution"`
+	Delta     string  `json:"delta"`
+	Regressed bool    `json:"regressed"`
+}
+
+// CoverageResult is a test coverage of the packages listed in coverage comments.
+type CoverageResult struct {
+	Packages []string        `json:"packages"`
+	Percent  float64         `json:"percent"`
+	Required float64         `json:"required"`
+	Checks   []CoverageCheck `json:"checks,omitempty"`
+}
+
+// CoverageCheck is a result of a single coverage requirement.
+type CoverageCheck struct {
+	Name     string  `json:"name"`
+	Percent  float64 `json:"percent"`
+	Required float64 `json:"required"`
+	Passed   bool    `json:"passed"`
+
+	// Uncovered lists uncovered blocks of the failed check as file:line.
+	Uncovered []string `json:"uncovered,omitempty"`
+}
+
+func newCoverageCheck(name string, percent, required float64, uncovered []string) CoverageCheck {
+	c := CoverageCheck{Name: name, Percent: percent, Required: required, Passed: percent >= required}
+	if !c.Passed {
+		c.Uncovered = uncovered
+	}
+	return c
+}
+
+func (c *CoverageCheck) failure() string {
+	return fmt.Sprintf("poor coverage of %s %.2f%%; expected at least %.2f%%", c.Name, c.Percent, c.Required)
+}
+
+// LintIssue is a single golangci-lint finding.
+type LintIssue struct {
+	Linter string `json:"linter"`
+	File   string `json:"file"`
+	Line   int    `json:"line"`
+	Column int    `json:"column"`
+	Text   string `json:"text"`
+}
+
+// fail records the step that failed and returns err unchanged.
+func (r *TaskReport) fail(step string, err error) error {
+	if r == nil || err == nil {
+		return err
+	}
+
+	if r.Step == "" {
+		r.Step = step
+		r.Error = err.Error()
+	}
+	return err
+}
+
+// finish fills overall task status.
+func (r *TaskReport) finish(started time.Time, err error) {
+	if r == nil {
+		return
+	}
+
+	r.Duration = time.Since(started)
+	r.Passed = err == nil
+	if err != nil && r.Error == "" {
+		r.Step = StepSetup
+		r.Error = err.Error()
+	}
+}
+
+// addTestOutput parses verbose output of the test binary.
+func (r *TaskReport) addTestOutput(pkg string, race bool, output []byte) {
+	if r == nil {
+		return
+	}
+
+	tests, races := parseTestOutput(pkg, race, output)
+	r.Tests = append(r.Tests, tests...)
+	r.Races = append(r.Races, races...)
+}
+
+// addBenchmarks records benchstat comparison.
+func (r *TaskReport) addBenchmarks(pkg string, tables []*benchstat.Table) {
+	if r == nil {
+		return
+	}
+
+	for _, t := range tables {
+		for _, row := range t.Rows {
+			if len(row.Metrics) != 2 {
+				continue
+			}
+
+			r.Benchmarks = append(r.Benchmarks, BenchmarkResult{
+				Package:   pkg,
+				Name:      row.Benchmark,
+				Unit:      row.Metrics[0].Unit,
+				Baseline:  row.Metrics[0].Mean,
+				Solution:  row.Metrics[1].Mean,
+				Delta:     row.Delta,
+				Regressed: row.Change == -1,
+			})
+		}
+	}
+}
+
+// setCoverage records measured coverage of all packages and results of the coverage checks.
+func (r *TaskReport) setCoverage(req *CoverageRequirements, percent float64, checks []CoverageCheck) {
+	if r == nil {
+		return
+	}
+
+	r.Coverage = &CoverageResult{
+		Packages: req.Packages,
+		Percent:  percent,
+		Required: req.Percent,
+		Checks:   checks,
+	}
+}
+
+// addLintOutput parses json output of golangci-lint.
+func (r *TaskReport) addLintOutput(output []byte) error {
+	if r == nil || len(output) == 0 {
+		return nil
+	}
+
+	var out struct {
+		Issues []struct {
+			FromLinter string
+			Text       string
+			Pos        struct {
+				Filename string
+				Line     int
+				Column   int
+			}
+		}
+	}
+	if err := json.Unmarshal(output, &out); err != nil {
+		return fmt.Errorf("invalid golangci-lint output: %w", err)
+	}
+
+	for _, i := range out.Issues {
+		r.Lint = append(r.Lint, LintIssue{
+			Linter: i.FromLinter,
+			File:   i.Pos.Filename,
+			Line:   i.Pos.Line,
+			Column: i.Pos.Column,
+			Text:   i.Text,
+		})
+	}
+	return nil
+}
+
+var (
+	testRunRe    = regexp.MustCompile(`^=== (?:RUN|CONT|NAME|PAUSE)\s+(\S+)`)
+	testResultRe = regexp.MustCompile(`^\s*--- (PASS|FAIL|SKIP): (\S+) \(([0-9.]+)s\)`)
+)
+
+const (
+	raceHeader    = "WARNING: DATA RACE"
+	raceDelimiter = "=================="
+)
+
+// parseTestOutput extracts test results and data races from -test.v output of the test binary.
+//
+// Test log is streamed between "=== RUN" and "--- FAIL" lines, so output is collected
+// for the test that is currently running and attached to failed and skipped tests.
+func parseTestOutput(pkg string, race bool, output []byte) ([]TestResult, []RaceReport) {
+	var (
+		tests []TestResult
+		races []RaceReport
+
+		current string
+		logs    = map[string]*strings.Builder{}
+
+		inRace bool
+		report strings.Builder
+	)
+
+	s := bufio.NewScanner(bytes.NewReader(output))
+	s.Buffer(nil, 1<<20)
+	for s.Scan() {
+		line := s.Text()
+
+		if inRace {
+			if line == raceDelimiter {
+				races = append(races, RaceReport{Package: pkg, Test: current, Report: report.String()})
+				inRace = false
+				report.Reset()
+				continue
+			}
+
+			report.WriteString(line)
+			report.WriteString("\n")
+			continue
+		}
+
+		switch {
+		case line == raceDelimiter:
+			continue
+		case line == raceHeader:
+			inRace = true
+			continue
+		}
+
+		if m := testRunRe.FindStringSubmatch(line); m != nil {
+			current = m[1]
+			continue
+		}
+
+		if m := testResultRe.FindStringSubmatch(line); m != nil {
+			seconds, _ := strconv.ParseFloat(m[3], 64)
+			t := TestResult{
+				Package:  pkg,
+				Name:     m[2],
+				Status:   strings.ToLower(m[1]),
+				Duration: time.Duration(seconds * float64(time.Second)),
+				Race:     race,
+			}
+			if log, ok := logs[t.Name]; ok && t.Status != TestPass {
+				t.Output = log.String()
+			}
+			delete(logs, t.Name)
+
+			tests = append(tests, t)
+			continue
+		}
+
+		if current == "" || !strings.HasPrefix(line, "    ") {
+			continue
+		}
+
+		log, ok := logs[current]
+		if !ok {
+			log = &strings.Builder{}
+			logs[current] = log
+		}
+		log.WriteString(strings.TrimPrefix(line, "    "))
+		log.WriteString("\n")
+	}
+
+	return tests, races
+}
+
+// WriteJSON writes report in JSON format.
+func (r *Report) WriteJSON(w io.Writer) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(r)
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Skipped  int             `xml:"skipped,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	ClassName string        `xml:"classname,attr"`
+	Name      string        `xml:"name,attr"`
+	Time      string        `xml:"time,attr"`
+	Failure   *junitMessage `xml:"failure,omitempty"`
+	Skipped   *junitMessage `xml:"skipped,omitempty"`
+}
+
+type junitMessage struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func junitTime(d time.Duration) string {
+	return strconv.FormatFloat(d.Seconds(), 'f', 3, 64)
+}
+
+// junitSuite converts task report to JUnit test suite.
+//
+// Every test becomes a test case. Races, benchmarks, coverage and linter
+// are reported as additional test cases, so that CI shows why the task failed.
+func (r *TaskReport) junitSuite() junitTestSuite {
+	suite := junitTestSuite{Name: r.Task, Time: junitTime(r.Duration)}
+
+	add := func(c junitTestCase) {
+		suite.Tests++
+		if c.Failure != nil {
+			suite.Failures++
+		}
+		if c.Skipped != nil {
+			suite.Skipped++
+		}
+		suite.Cases = append(suite.Cases, c)
+	}
+
+	for _, t := range r.Tests {
+		c := junitTestCase{ClassName: t.Package, Name: t.Name, Time: junitTime(t.Duration)}
+		if t.Race {
+			c.ClassName += " (race)"
+		}
+
+		switch t.Status {
+		case TestFail:
+			c.Failure = &junitMessage{Message: "test failed", Text: t.Output}
+		case TestSkip:
+			c.Skipped = &junitMessage{Message: "test skipped", Text: t.Output}
+		}
+		add(c)
+	}
+
+	for _, race := range r.Races {
+		add(junitTestCase{
+			ClassName: race.Package + " (race)",
+			Name:      "DataRace/" + race.Test,
+			Time:      junitTime(0),
+			Failure:   &junitMessage{Message: "data race detected", Text: race.Report},
+		})
+	}
+
+	for _, b := range r.Benchmarks {
+		c := junitTestCase{ClassName: b.Package + " (benchmark)", Name: b.Name, Time: junitTime(0)}
+		if b.Regressed {
+			c.Failure = &junitMessage{
+				Message: fmt.Sprintf("solution is worse than baseline: %g %s vs %g %s", b.Solution, b.Unit, b.Baseline, b.Unit),
+				Text:    b.Delta,
+			}
+		}
+		add(c)
+	}
+
+	if r.Coverage != nil {
+		for _, check := range r.Coverage.Checks {
+			c := junitTestCase{ClassName: r.Task + " (coverage)", Name: check.Name, Time: junitTime(0)}
+			if !check.Passed {
+				c.Failure = &junitMessage{
+					Message: check.failure(),
+					Text:    strings.Join(check.Uncovered, "\n"),
+				}
+			}
+			add(c)
+		}
+	}
+
+	if r.Coverage != nil && len(r.Coverage.Checks) == 0 {
+		c := junitTestCase{ClassName: r.Task, Name: "Coverage", Time: junitTime(0)}
+		if r.Coverage.Percent < r.Coverage.Required {
+			c.Failure = &junitMessage{
+				Message: fmt.Sprintf("poor coverage %.2f%%; expected at least %.2f%%", r.Coverage.Percent, r.Coverage.Required),
+			}
+		}
+		add(c)
+	}
+
+	for _, i := range r.Lint {
+		add(junitTestCase{
+			ClassName: r.Task + " (lint)",
+			Name:      fmt.Sprintf("%s:%d:%d", i.File, i.Line, i.Column),
+			Time:      junitTime(0),
+			Failure:   &junitMessage{Message: i.Linter, Text: i.Text},
+		})
+	}
+
+	// Failure not attributed to any test case, e.g. build error.
+	if !r.Passed && suite.Failures == 0 {
+		add(junitTestCase{
+			ClassName: r.Task,
+			Name:      r.Step,
+			Time:      junitTime(0),
+			Failure:   &junitMessage{Message: r.Step + " failed", Text: r.Error},
+		})
+	}
+
+	return suite
+}
+
+// WriteJUnit writes report in JUnit XML format. Each task becomes a separate test suite.
+func (r *Report) WriteJUnit(w io.Writer) error {
+	suites := junitTestSuites{}
+	for _, t := range r.Tasks {
+		suites.Suites = append(suites.Suites, t.junitSuite())
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suites); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// addReportFlags registers report flags of the command.
+func addReportFlags(cmd *cobra.Command) {
+	cmd.Flags().String(reportFlag, "", "write machine-readable report in given format (json|junit)")
+	cmd.Flags().String(reportFileFlag, "", "path to report file (default report.json or report.xml)")
+}
+
+// reportOptions are parsed report flags.
+type reportOptions struct {
+	format string
+	path   string
+}
+
+// parseReportFlags parses report flags of the command.
+//
+// Returns nil if report was not requested.
+func parseReportFlags(cmd *cobra.Command) (*reportOptions, error) {
+	format, err := cmd.Flags().GetString(reportFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	reportPath, err := cmd.Flags().GetString(reportFileFlag)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case "":
+		return nil, nil
+	case reportFormatJSON:
+		if reportPath == "" {
+			reportPath = "report.json"
+		}
+	case reportFormatJUnit:
+		if reportPath == "" {
+			reportPath = "report.xml"
+		}
+	default:
+		return nil, fmt.Errorf("unknown report format %q; expected %s or %s", format, reportFormatJSON, reportFormatJUnit)
+	}
+
+	return &reportOptions{format: format, path: reportPath}, nil
+}
+
+// write writes report to the file in requested format.
+func (o *reportOptions) write(r *Report) error {
+	f, err := os.Create(o.path)
+	if err != nil {
+		return err
+	}
+
+	switch o.format {
+	case reportFormatJUnit:
+		err = r.WriteJUnit(f)
+	default:
+		err = r.WriteJSON(f)
+	}
+
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return fmt.Errorf("error writing report: %w", err)
+	}
+	return nil
+}
+
+// newTaskReport returns report for the task or nil if report was not requested.
+func (o *reportOptions) newTaskReport(task string) *TaskReport {
+	if o == nil {
+		return nil
+	}
+	return &TaskReport{Task: task}
+}
@@ -0,0 +1,152 @@
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func Test_parseTestOutput(t *testing.T) {
+	output, err := os.ReadFile("../testdata/report/test_output.txt")
+	require.NoError(t, err)
+
+	tests, races := parseTestOutput("sum", true, output)
+
+	status := map[string]string{}
+	for _, r := range tests {
+		require.Equal(t, "sum", r.Package)
+		require.True(t, r.Race)
+		status[r.Name] = r.Status
+	}
+	require.Equal(t, map[string]string{
+		"TestOK":       TestPass,
+		"TestFail":     TestFail,
+		"TestFail/Sub": TestFail,
+		"TestSkip":     TestSkip,
+		"TestRace":     TestFail,
+	}, status)
+
+	for _, r := range tests {
+		switch r.Name {
+		case "TestOK":
+			require.Empty(t, r.Output)
+		case "TestFail":
+			require.Equal(t, "r_test.go:8: some log\n", r.Output)
+		case "TestFail/Sub":
+			require.Equal(t, "r_test.go:9: broken\n    multiline\n", r.Output)
+		case "TestRace":
+			require.Contains(t, r.Output, "race detected during execution of test")
+		}
+	}
+
+	require.Len(t, races, 1)
+	require.Equal(t, "TestRace", races[0].Test)
+	require.Contains(t, races[0].Report, "r_test.go:17")
+}
+
+const golangCIOutput = `{
+  "Issues": [
+    {
+      "FromLinter": "errcheck",
+      "Text": "Error return value is not checked",
+      "Pos": {"Filename": "sum/sum.go", "Offset": 10, "Line": 12, "Column": 2}
+    }
+  ],
+  "Report": {}
+}`
+
+func testReport(t *testing.T) *Report {
+	passed := &TaskReport{Task: "sum"}
+	passed.addTestOutput("sum", false, []byte("=== RUN   TestSum\n--- PASS: TestSum (1.50s)\n"))
+	passed.setCoverage(&CoverageRequirements{Enabled: true, Percent: 80, Packages: []string{"."}}, 95, []CoverageCheck{
+		newCoverageCheck("packages .", 95, 80, []string{"sum/sum.go:12"}),
+	})
+	passed.finish(time.Now(), nil)
+
+	failed := &TaskReport{Task: "wordcount"}
+	require.NoError(t, failed.addLintOutput([]byte(golangCIOutput)))
+	_ = failed.fail(StepLint, errors.New("linter failed: exit status 1"))
+	failed.finish(time.Now(), errors.New("linter failed: exit status 1"))
+
+	broken := &TaskReport{Task: "fetchall"}
+	_ = broken.fail(StepBuild, errors.New("error building test in fetchall"))
+	broken.finish(time.Now(), errors.New("error building test in fetchall"))
+
+	return &Report{Tasks: []*TaskReport{passed, failed, broken}}
+}
+
+func TestReportJSON(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, testReport(t).WriteJSON(&buf))
+
+	var decoded Report
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Len(t, decoded.Tasks, 3)
+
+	sum := decoded.Tasks[0]
+	require.True(t, sum.Passed)
+	require.Empty(t, sum.Step)
+	require.Equal(t, []TestResult{{Package: "sum", Name: "TestSum", Status: TestPass, Duration: 1500 * time.Millisecond}}, sum.Tests)
+	require.Equal(t, &CoverageResult{
+		Packages: []string{"."},
+		Percent:  95,
+		Required: 80,
+		Checks:   []CoverageCheck{{Name: "packages .", Percent: 95, Required: 80, Passed: true}},
+	}, sum.Coverage)
+
+	wordcount := decoded.Tasks[1]
+	require.False(t, wordcount.Passed)
+	require.Equal(t, StepLint, wordcount.Step)
+	require.Equal(t, []LintIssue{{
+		Linter: "errcheck",
+		File:   "sum/sum.go",
+		Line:   12,
+		Column: 2,
+		Text:   "Error return value is not checked",
+	}}, wordcount.Lint)
+}
+
+func TestReportJUnit(t *testing.T) {
+	var buf bytes.Buffer
+	require.NoError(t, testReport(t).WriteJUnit(&buf))
+
+	var suites junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &suites))
+	require.Len(t, suites.Suites, 3)
+
+	sum := suites.Suites[0]
+	require.Equal(t, "sum", sum.Name)
+	require.Equal(t, 2, sum.Tests)
+	require.Equal(t, 0, sum.Failures)
+	require.Equal(t, "TestSum", sum.Cases[0].Name)
+	require.Equal(t, "1.500", sum.Cases[0].Time)
+	require.Equal(t, "packages .", sum.Cases[1].Name)
+	require.Nil(t, sum.Cases[1].Failure)
+
+	wordcount := suites.Suites[1]
+	require.Equal(t, 1, wordcount.Failures)
+	require.Equal(t, "sum/sum.go:12:2", wordcount.Cases[0].Name)
+	require.Equal(t, "errcheck", wordcount.Cases[0].Failure.Message)
+
+	fetchall := suites.Suites[2]
+	require.Equal(t, 1, fetchall.Failures)
+	require.Equal(t, StepBuild, fetchall.Cases[0].Name)
+	require.Equal(t, "error building test in fetchall", fetchall.Cases[0].Failure.Text)
+}
+
+func TestNilTaskReport(t *testing.T) {
+	var r *TaskReport
+
+	err := errors.New("test failed")
+	require.Equal(t, err, r.fail(StepTest, err))
+	r.addTestOutput("sum", false, []byte("--- PASS: TestSum (0.00s)\n"))
+	r.setCoverage(&CoverageRequirements{}, 0, nil)
+	require.NoError(t, r.addLintOutput([]byte("{")))
+	r.finish(time.Now(), err)
+}
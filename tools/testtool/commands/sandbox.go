@@ -1,34 +1,150 @@
 package commands
 
 import (
+	"errors"
+	"fmt"
+	"log"
 	"os"
 	"os/exec"
-	"os/user"
-	"strconv"
-	"syscall"
+	"sync/atomic"
+	"time"
+
+	"github.com/spf13/cobra"
 )
 
 func currentUserIsRoot() bool {
 	return os.Getuid() == 0
 }
 
-func sandbox(cmd *exec.Cmd) error {
-	nobody, err := user.Lookup("nobody")
-	if err != nil {
+// sandboxLimits are resource limits of the test binary.
+//
+// Zero value of the field means no limit.
+type sandboxLimits struct {
+	// CPUTime limits cpu time of each process.
+	CPUTime time.Duration
+
+	// AddressSpace limits virtual memory of each process in bytes.
+	AddressSpace uint64
+
+	// OpenFiles limits number of file descriptors of each process.
+	OpenFiles uint64
+
+	// Processes limits number of processes and threads of the sandbox user.
+	//
+	// RLIMIT_NPROC is checked against all processes of the uid, and all tests run as nobody.
+	// So the limit is shared by all tests that are running concurrently, including tests
+	// of the other tasks with grade -j. A test that hits the limit fails tests of other tasks too.
+	Processes uint64
+
+	// TmpfsSize limits size of the temporary directory of the test in bytes.
+	TmpfsSize uint64
+
+	// WallClock limits running time of the test binary.
+	WallClock time.Duration
+}
+
+// testLimits are limits of the test binaries.
+//
+// WallClock is greater than -test.timeout, so that test binary
+// is normally able to report stuck test itself.
+var testLimits = sandboxLimits{
+	CPUTime:      5 * time.Minute,
+	AddressSpace: 16 << 30,
+	OpenFiles:    4096,
+	Processes:    2048,
+	TmpfsSize:    1 << 30,
+	WallClock:    2 * time.Minute,
+}
+
+// raceLimits returns limits of the test binaries built with race detector.
+//
+// Race detector reserves terabytes of virtual memory for shadow memory, so address space is not limited.
+func raceLimits(limits sandboxLimits) sandboxLimits {
+	limits.AddressSpace = 0
+	return limits
+}
+
+// LimitError is a reason of the test failure, if test binary was killed for exceeding the limit.
+type LimitError struct {
+	Limit string
+	Value string
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("%s limit exceeded (%s)", e.Limit, e.Value)
+}
+
+var errSandboxSetup = errors.New("sandbox setup failed")
+
+// runTestCommand runs test binary and waits for it to finish.
+//
+// When testtool runs as root, test binary runs in sandbox. Test binary and
+// all its children are killed after limits.WallClock.
+//
+// Failure of the test is returned as *TestFailedError. If test binary was killed
+// because of the limit, *LimitError is the reason of the failure.
+func runTestCommand(cmd *exec.Cmd, limits sandboxLimits) error {
+	checkSetup := func() error { return nil }
+	if currentUserIsRoot() {
+		cleanup, check, err := sandbox(cmd, limits)
+		if err != nil {
+			return err
+		}
+		defer cleanup()
+		checkSetup = check
+	} else {
+		setProcessGroup(cmd)
+	}
+
+	if err := cmd.Start(); err != nil {
 		return err
 	}
 
-	uid, _ := strconv.Atoi(nobody.Uid)
-	gid, _ := strconv.Atoi(nobody.Gid)
+	// Setup error is reported out of band, exit code belongs to the test binary.
+	if err := checkSetup(); err != nil {
+		killProcessGroup(cmd)
+		_ = cmd.Wait()
+		return err
+	}
+
+	var timedOut atomic.Bool
+	if limits.WallClock != 0 {
+		timer := time.AfterFunc(limits.WallClock, func() {
+			timedOut.Store(true)
+			killProcessGroup(cmd)
+		})
+		defer timer.Stop()
+	}
 
-	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Credential: &syscall.Credential{
-			Uid: uint32(uid),
-			Gid: uint32(gid),
-		},
+	err := cmd.Wait()
+
+	switch {
+	case timedOut.Load():
+		return &TestFailedError{E: &LimitError{Limit: "wall-clock", Value: limits.WallClock.String()}}
+	case err != nil && cpuLimitExceeded(cmd, limits):
+		return &TestFailedError{E: &LimitError{Limit: "cpu time", Value: limits.CPUTime.String()}}
+	case err != nil:
+		return &TestFailedError{E: err}
+	default:
+		return nil
 	}
+}
 
-	cmd.Env = []string{}
+// sandboxExecCmd prepares sandbox and executes the test binary.
+//
+// testtool runs itself with this command to set up sandbox
+// after the new process entered private namespaces.
+var sandboxExecCmd = &cobra.Command{
+	Use:                "sandbox-exec",
+	Hidden:             true,
+	DisableFlagParsing: true,
+	Run: func(cmd *cobra.Command, args []string) {
+		if err := sandboxExec(args); err != nil {
+			log.Fatalf("sandbox: %v", err)
+		}
+	},
+}
 
-	return nil
+func init() {
+	rootCmd.AddCommand(sandboxExecCmd)
 }
@@ -0,0 +1,332 @@
+//go:build linux
+
+package commands
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"os/exec"
+	"os/user"
+	"strconv"
+	"sync"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// sandboxConfig is passed from testtool to sandbox-exec command.
+type sandboxConfig struct {
+	UID int `json:"uid"`
+	GID int `json:"gid"`
+
+	// Namespaces enables private mount and network namespaces.
+	Namespaces bool `json:"namespaces"`
+
+	// TmpDir is a temporary directory of the test.
+	// With namespaces, tmpfs is mounted there.
+	TmpDir string `json:"tmp_dir"`
+
+	Limits sandboxLimits `json:"limits"`
+
+	// StatusFD is a descriptor, where sandbox-exec writes the setup error.
+	// It is closed on exec of the test binary, so empty status means success.
+	// Zero means that the error is only logged.
+	StatusFD int `json:"status_fd"`
+}
+
+const sandboxCloneflags = syscall.CLONE_NEWNS | syscall.CLONE_NEWNET
+
+var (
+	namespacesOnce      sync.Once
+	namespacesAvailable bool
+)
+
+// privateNamespaces checks once whether sandbox is able to use private namespaces.
+//
+// Namespaces require CAP_SYS_ADMIN, that is usually missing in unprivileged containers.
+func privateNamespaces(config sandboxConfig) bool {
+	namespacesOnce.Do(func() {
+		config.Namespaces = true
+
+		cmd, err := sandboxExecCommand(config)
+		if err != nil {
+			log.Printf("sandbox: %v", err)
+			return
+		}
+		cmd.SysProcAttr = &syscall.SysProcAttr{Cloneflags: sandboxCloneflags}
+
+		if out, err := cmd.CombinedOutput(); err != nil {
+			log.Printf("sandbox: private namespaces are not available, running tests without them: %v %s", err, out)
+			return
+		}
+		namespacesAvailable = true
+	})
+
+	return namespacesAvailable
+}
+
+// sandboxExecCommand creates sandbox-exec command that prepares sandbox and executes
+// binary with args. args include argv[0].
+//
+// Without binary, sandbox-exec only checks that sandbox can be set up.
+func sandboxExecCommand(config sandboxConfig, binaryAndArgs ...string) (*exec.Cmd, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return nil, err
+	}
+
+	configJSON, err := json.Marshal(config)
+	if err != nil {
+		return nil, err
+	}
+
+	return exec.Command(self, append([]string{sandboxExecCmd.Use, string(configJSON)}, binaryAndArgs...)...), nil
+}
+
+// sandbox makes cmd run as nobody with resource limits, in private mount and network
+// namespaces when they are available.
+//
+// cmd is replaced with sandbox-exec command, that sets up sandbox and executes
+// the original command. Returned cleanup function removes temporary directory of the test.
+//
+// checkSetup must be called after cmd is started. It waits until the test binary is executed
+// and returns the setup error reported by sandbox-exec.
+func sandbox(cmd *exec.Cmd, limits sandboxLimits) (cleanup func(), checkSetup func() error, err error) {
+	nobody, err := user.Lookup("nobody")
+	if err != nil {
+		return nil, nil, err
+	}
+
+	config := sandboxConfig{Limits: limits}
+	config.UID, _ = strconv.Atoi(nobody.Uid)
+	config.GID, _ = strconv.Atoi(nobody.Gid)
+
+	config.TmpDir, err = os.MkdirTemp("/tmp", "sandbox-")
+	if err != nil {
+		return nil, nil, err
+	}
+	removeTmpDir := func() { _ = os.RemoveAll(config.TmpDir) }
+
+	if err := os.Chown(config.TmpDir, config.UID, config.GID); err != nil {
+		removeTmpDir()
+		return nil, nil, err
+	}
+
+	config.Namespaces = privateNamespaces(config)
+
+	status, statusW, err := os.Pipe()
+	if err != nil {
+		removeTmpDir()
+		return nil, nil, err
+	}
+	cleanup = func() {
+		_ = status.Close()
+		_ = statusW.Close()
+		removeTmpDir()
+	}
+
+	config.StatusFD = 3 + len(cmd.ExtraFiles)
+	cmd.ExtraFiles = append(cmd.ExtraFiles, statusW)
+
+	wrapper, err := sandboxExecCommand(config, append([]string{cmd.Path}, cmd.Args...)...)
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	cmd.Path = wrapper.Path
+	cmd.Args = wrapper.Args
+	cmd.Err = nil
+
+	if cmd.Env == nil {
+		cmd.Env = []string{}
+	}
+
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}
+	if config.Namespaces {
+		cmd.SysProcAttr.Cloneflags = sandboxCloneflags
+	}
+
+	checkSetup = func() error {
+		_ = statusW.Close()
+
+		msg, err := io.ReadAll(status)
+		if err != nil {
+			return err
+		}
+		if len(msg) != 0 {
+			return fmt.Errorf("%w: %s", errSandboxSetup, msg)
+		}
+		return nil
+	}
+
+	return cleanup, checkSetup, nil
+}
+
+// sandboxExec sets up sandbox in the current process and executes the test binary.
+//
+// args are json encoded sandboxConfig, path to the test binary and its argv.
+func sandboxExec(args []string) (err error) {
+	if len(args) == 0 {
+		return errors.New("sandbox config is missing")
+	}
+
+	var config sandboxConfig
+	if err := json.Unmarshal([]byte(args[0]), &config); err != nil {
+		return fmt.Errorf("invalid sandbox config: %w", err)
+	}
+
+	if config.StatusFD != 0 {
+		unix.CloseOnExec(config.StatusFD)
+		status := os.NewFile(uintptr(config.StatusFD), "status")
+		defer func() {
+			if err != nil {
+				_, _ = io.WriteString(status, err.Error())
+			}
+		}()
+	}
+
+	if config.Namespaces {
+		// Mounts must not propagate to the parent namespace.
+		if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+			return fmt.Errorf("remount /: %w", err)
+		}
+
+		options := fmt.Sprintf("mode=0700,uid=%d,gid=%d", config.UID, config.GID)
+		if config.Limits.TmpfsSize != 0 {
+			options += fmt.Sprintf(",size=%d", config.Limits.TmpfsSize)
+		}
+		if err := unix.Mount("tmpfs", config.TmpDir, "tmpfs", unix.MS_NOSUID|unix.MS_NODEV, options); err != nil {
+			return fmt.Errorf("mount tmpfs: %w", err)
+		}
+
+		// Network namespace has only loopback interface, that is down initially.
+		if err := loopbackUp(); err != nil {
+			return fmt.Errorf("loopback up: %w", err)
+		}
+	}
+
+	if err := setLimits(config.Limits); err != nil {
+		return err
+	}
+
+	if err := syscall.Setgroups(nil); err != nil {
+		return err
+	}
+	if err := syscall.Setgid(config.GID); err != nil {
+		return err
+	}
+	if err := syscall.Setuid(config.UID); err != nil {
+		return err
+	}
+
+	// Parent death signal is reset on credentials change.
+	if err := unix.Prctl(unix.PR_SET_PDEATHSIG, uintptr(unix.SIGKILL), 0, 0, 0); err != nil {
+		return err
+	}
+
+	if len(args) == 1 {
+		return nil
+	}
+	if len(args) == 2 {
+		return errors.New("test binary argv is missing")
+	}
+
+	env := append(os.Environ(), "TMPDIR="+config.TmpDir)
+	return syscall.Exec(args[1], args[2:], env)
+}
+
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = unix.Close(fd) }()
+
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
+
+// setLimits sets rlimits of the current process, that are inherited by the test binary.
+func setLimits(limits sandboxLimits) error {
+	set := func(name string, resource int, cur, max uint64) error {
+		if err := unix.Setrlimit(resource, &unix.Rlimit{Cur: cur, Max: max}); err != nil {
+			return fmt.Errorf("set %s limit: %w", name, err)
+		}
+		return nil
+	}
+
+	if limits.CPUTime != 0 {
+		// Process gets SIGXCPU on soft limit and SIGKILL on hard limit.
+		seconds := uint64((limits.CPUTime + 999_999_999) / 1_000_000_000)
+		if err := set("cpu", unix.RLIMIT_CPU, seconds, seconds+1); err != nil {
+			return err
+		}
+	}
+
+	if limits.AddressSpace != 0 {
+		if err := set("address space", unix.RLIMIT_AS, limits.AddressSpace, limits.AddressSpace); err != nil {
+			return err
+		}
+	}
+
+	if limits.OpenFiles != 0 {
+		if err := set("open files", unix.RLIMIT_NOFILE, limits.OpenFiles, limits.OpenFiles); err != nil {
+			return err
+		}
+	}
+
+	if limits.Processes != 0 {
+		if err := set("processes", unix.RLIMIT_NPROC, limits.Processes, limits.Processes); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func setProcessGroup(cmd *exec.Cmd) {
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	cmd.SysProcAttr.Setpgid = true
+}
+
+func killProcessGroup(cmd *exec.Cmd) {
+	_ = syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
+
+func cpuLimitExceeded(cmd *exec.Cmd, limits sandboxLimits) bool {
+	if limits.CPUTime == 0 || cmd.ProcessState == nil {
+		return false
+	}
+
+	status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus)
+	if !ok || !status.Signaled() {
+		return false
+	}
+
+	// SIGXCPU is sent only on soft limit, accounted cpu time might be slightly less than the limit.
+	switch status.Signal() {
+	case syscall.SIGXCPU:
+		return true
+	case syscall.SIGKILL:
+		return cmd.ProcessState.UserTime()+cmd.ProcessState.SystemTime() >= limits.CPUTime
+	default:
+		return false
+	}
+}
@@ -0,0 +1,182 @@
+//go:build linux
+
+package commands
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sys/unix"
+)
+
+const sandboxHelperEnv = "TESTTOOL_SANDBOX_HELPER"
+
+// TestSandboxHelper checks sandbox from the inside, when started by TestSandbox.
+func TestSandboxHelper(t *testing.T) {
+	if os.Getenv(sandboxHelperEnv) == "" {
+		t.Skip("started by TestSandbox")
+	}
+
+	nobody, err := user.Lookup("nobody")
+	require.NoError(t, err)
+	require.Equal(t, nobody.Uid, strconv.Itoa(os.Getuid()))
+	require.Equal(t, nobody.Gid, strconv.Itoa(os.Getgid()))
+
+	groups, err := os.Getgroups()
+	require.NoError(t, err)
+	require.Empty(t, groups)
+
+	var limit unix.Rlimit
+	require.NoError(t, unix.Getrlimit(unix.RLIMIT_NOFILE, &limit))
+	require.Equal(t, testLimits.OpenFiles, limit.Cur)
+	require.NoError(t, unix.Getrlimit(unix.RLIMIT_NPROC, &limit))
+	require.Equal(t, testLimits.Processes, limit.Cur)
+	require.NoError(t, unix.Getrlimit(unix.RLIMIT_AS, &limit))
+	require.Equal(t, testLimits.AddressSpace, limit.Cur)
+
+	tmp := os.TempDir()
+	require.NotEqual(t, "/tmp", tmp)
+	require.NoError(t, os.WriteFile(filepath.Join(tmp, "file"), []byte("data"), 0644))
+
+	if os.Getenv(sandboxHelperEnv) != "namespaces" {
+		return
+	}
+
+	var fs unix.Statfs_t
+	require.NoError(t, unix.Statfs(tmp, &fs))
+	require.Equal(t, int64(unix.TMPFS_MAGIC), int64(fs.Type))
+
+	// tmpfs size is limited.
+	f, err := os.Create(filepath.Join(tmp, "large"))
+	require.NoError(t, err)
+	_, err = io.Copy(f, io.LimitReader(zeroReader{}, 2<<20))
+	require.ErrorIs(t, err, unix.ENOSPC)
+	require.NoError(t, f.Close())
+
+	interfaces, err := net.Interfaces()
+	require.NoError(t, err)
+	require.Len(t, interfaces, 1)
+	require.Equal(t, "lo", interfaces[0].Name)
+
+	lsn, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	conn, err := net.Dial("tcp", lsn.Addr().String())
+	require.NoError(t, err)
+	_ = conn.Close()
+	_ = lsn.Close()
+}
+
+type zeroReader struct{}
+
+func (zeroReader) Read(p []byte) (int, error) {
+	clear(p)
+	return len(p), nil
+}
+
+// testBinaryCopy copies test binary to the directory accessible by nobody.
+func testBinaryCopy(t *testing.T) string {
+	self, err := os.Executable()
+	require.NoError(t, err)
+
+	dir, err := os.MkdirTemp("/tmp", "sandbox-test-")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = os.RemoveAll(dir) })
+	require.NoError(t, os.Chmod(dir, 0755))
+
+	binary := filepath.Join(dir, "test")
+	require.NoError(t, (&copier{}).copyFiles(filepath.Dir(self), []string{filepath.Base(self)}, dir))
+	require.NoError(t, os.Rename(filepath.Join(dir, filepath.Base(self)), binary))
+	require.NoError(t, os.Chmod(binary, 0755))
+	return binary
+}
+
+func TestSandbox(t *testing.T) {
+	if !currentUserIsRoot() {
+		t.Skip("sandbox requires root")
+	}
+
+	mode := "rlimits"
+	if privateNamespaces(sandboxConfig{TmpDir: t.TempDir()}) {
+		mode = "namespaces"
+	}
+	t.Logf("testing sandbox with %s", mode)
+
+	limits := testLimits
+	limits.TmpfsSize = 1 << 20
+
+	var output bytes.Buffer
+	cmd := exec.Command(testBinaryCopy(t), "-test.run=^TestSandboxHelper$", "-test.v")
+	cmd.Env = []string{sandboxHelperEnv + "=" + mode}
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+
+	err := runTestCommand(cmd, limits)
+	require.NoError(t, err, output.String())
+	require.Contains(t, output.String(), "--- PASS: TestSandboxHelper")
+	require.Equal(t, sandboxExecCmd.Use, cmd.Args[1])
+}
+
+func TestSandboxCredentials(t *testing.T) {
+	if !currentUserIsRoot() {
+		t.Skip("sandbox requires root")
+	}
+
+	cmd := exec.Command("/bin/true")
+	cleanup, _, err := sandbox(cmd, testLimits)
+	require.NoError(t, err)
+	defer cleanup()
+
+	var config sandboxConfig
+	require.NoError(t, json.Unmarshal([]byte(cmd.Args[2]), &config))
+	require.True(t, config.UID > 0)
+	require.True(t, config.GID > 0)
+}
+
+func TestSandboxCPULimit(t *testing.T) {
+	if !currentUserIsRoot() {
+		t.Skip("sandbox requires root")
+	}
+
+	cmd := exec.Command("sh", "-c", "while :; do :; done")
+	err := runTestCommand(cmd, sandboxLimits{CPUTime: time.Second, WallClock: time.Minute})
+
+	var limitErr *LimitError
+	require.True(t, errors.As(err, &limitErr), fmt.Sprint(err))
+	require.Equal(t, "cpu time", limitErr.Limit)
+}
+
+func TestSandboxSetupFailure(t *testing.T) {
+	if !currentUserIsRoot() {
+		t.Skip("sandbox requires root")
+	}
+
+	err := runTestCommand(exec.Command("/nonexistent"), testLimits)
+	require.ErrorIs(t, err, errSandboxSetup)
+}
+
+func TestSandboxTestExitCode(t *testing.T) {
+	if !currentUserIsRoot() {
+		t.Skip("sandbox requires root")
+	}
+
+	// Any exit code of the test binary is a test failure, even if sandbox-exec might use it.
+	for _, code := range []string{"1", "125", "126"} {
+		err := runTestCommand(exec.Command("/bin/sh", "-c", "exit "+code), testLimits)
+		require.NotErrorIs(t, err, errSandboxSetup)
+
+		var testFailed *TestFailedError
+		require.True(t, errors.As(err, &testFailed), fmt.Sprint(err))
+	}
+}
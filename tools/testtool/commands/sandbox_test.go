@@ -1,16 +1,47 @@
 package commands
 
 import (
+	"errors"
+	"os"
 	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
-func TestSandbox(t *testing.T) {
-	var cmd exec.Cmd
+func TestMain(m *testing.M) {
+	// Sandboxed tests are executed by sandbox-exec command of the current binary.
+	if len(os.Args) > 1 && os.Args[1] == sandboxExecCmd.Use {
+		Execute()
+		os.Exit(0)
+	}
 
-	require.NoError(t, sandbox(&cmd))
-	require.True(t, cmd.SysProcAttr.Credential.Uid > 0)
-	require.True(t, cmd.SysProcAttr.Credential.Gid > 0)
+	os.Exit(m.Run())
+}
+
+func TestRunTestCommandWallClock(t *testing.T) {
+	cmd := exec.Command("sh", "-c", "sleep 10 & sleep 10")
+	cmd.Env = []string{"PATH=" + os.Getenv("PATH")}
+
+	start := time.Now()
+	err := runTestCommand(cmd, sandboxLimits{WallClock: 200 * time.Millisecond})
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	var testFailed *TestFailedError
+	require.True(t, errors.As(err, &testFailed))
+
+	var limitErr *LimitError
+	require.True(t, errors.As(err, &limitErr))
+	require.Equal(t, "test failed: wall-clock limit exceeded (200ms)", err.Error())
+}
+
+func TestRunTestCommandFailure(t *testing.T) {
+	err := runTestCommand(exec.Command("sh", "-c", "exit 1"), testLimits)
+
+	var testFailed *TestFailedError
+	require.True(t, errors.As(err, &testFailed))
+
+	var limitErr *LimitError
+	require.False(t, errors.As(err, &limitErr))
 }
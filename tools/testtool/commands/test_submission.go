@@ -5,7 +5,9 @@ import (
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"os"
 	"os/exec"
@@ -13,6 +15,7 @@ import (
 	"path/filepath"
 	"strings"
 	"sync"
+	"time"
 
 	"github.com/spf13/cobra"
 	"golang.org/x/perf/benchstat"
@@ -48,7 +51,19 @@ var testSubmissionCmd = &cobra.Command{
 			log.Fatalf("%s does not have %s directory", privateRepo, problem)
 		}
 
-		if err := testSubmission(studentRepo, privateRepo, problem); err != nil {
+		reportOpts, err := parseReportFlags(cmd)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		report := reportOpts.newTaskReport(problem)
+		err = testSubmission(studentRepo, privateRepo, problem, report)
+		if reportOpts != nil {
+			if err := reportOpts.write(&Report{Tasks: []*TaskReport{report}}); err != nil {
+				log.Fatal(err)
+			}
+		}
+		if err != nil {
 			log.Fatal(err)
 		}
 	},
@@ -62,6 +77,7 @@ func init() {
 
 	testSubmissionCmd.Flags().String(studentRepoFlag, ".", "path to student repo root")
 	testSubmissionCmd.Flags().String(privateRepoFlag, ".", "path to shad-go-private repo root")
+	addReportFlags(testSubmissionCmd)
 }
 
 // mustParseDirFlag parses string directory flag with given name.
@@ -88,7 +104,45 @@ func problemDirExists(repo, problem string) bool {
 	return info.IsDir()
 }
 
-func testSubmission(studentRepo, privateRepo, problem string) error {
+// submission is a state of testing single task.
+//
+// Several submissions might be tested concurrently, so all output
+// of the submission goes to its own writers.
+type submission struct {
+	studentRepo string
+	privateRepo string
+	problem     string
+
+	// report might be nil.
+	report *TaskReport
+
+	stdout io.Writer
+	stderr io.Writer
+	log    *log.Logger
+}
+
+// testSubmission tests solution of the problem and records results into report.
+//
+// report might be nil.
+func testSubmission(studentRepo, privateRepo, problem string, report *TaskReport) error {
+	s := &submission{
+		studentRepo: studentRepo,
+		privateRepo: privateRepo,
+		problem:     problem,
+		report:      report,
+		stdout:      os.Stdout,
+		stderr:      os.Stderr,
+		log:         log.Default(),
+	}
+	return s.test()
+}
+
+func (s *submission) test() (err error) {
+	started := time.Now()
+	defer func() { s.report.finish(started, err) }()
+
+	problem, privateRepo := s.problem, s.privateRepo
+
 	// Create temp directory to store all files required to test the solution.
 	tmpRepo, err := os.MkdirTemp("/tmp", problem+"-")
 	if err != nil {
@@ -98,84 +152,59 @@ func testSubmission(studentRepo, privateRepo, problem string) error {
 		log.Fatal(err)
 	}
 	defer func() { _ = os.RemoveAll(tmpRepo) }()
-	log.Printf("testing submission in %s", tmpRepo)
+	s.log.Printf("testing submission in %s", tmpRepo)
 
 	// Path to private problem folder.
 	privateProblem := path.Join(privateRepo, problem)
 
+	// Sandboxed tests run as nobody and can't modify sources through hardlinks.
+	c := &copier{hardlink: currentUserIsRoot(), exclude: []string{".git"}}
+
 	// Copy student repo files to temp dir.
-	log.Printf("copying student repo")
-	copyContents(studentRepo, ".", tmpRepo)
+	s.log.Printf("copying student repo")
+	if err := c.copyContents(s.studentRepo, ".", tmpRepo); err != nil {
+		return fmt.Errorf("student repo copying failed: %w", err)
+	}
 
 	// Copy tests from private repo to temp dir.
-	log.Printf("copying tests")
+	s.log.Printf("copying tests")
 	tests := listTestFiles(privateProblem)
-	copyFiles(privateRepo, relPaths(privateRepo, tests), tmpRepo)
+	if err := c.copyFiles(privateRepo, relPaths(privateRepo, tests), tmpRepo); err != nil {
+		return fmt.Errorf("tests copying failed: %w", err)
+	}
 
 	// Copy !change files from private repo to temp dir.
-	log.Printf("copying !change files")
+	s.log.Printf("copying !change files")
 	protected := listProtectedFiles(privateProblem)
-	copyFiles(privateRepo, relPaths(privateRepo, protected), tmpRepo)
+	if err := c.copyFiles(privateRepo, relPaths(privateRepo, protected), tmpRepo); err != nil {
+		return fmt.Errorf("!change files copying failed: %w", err)
+	}
 
 	// Copy testdata directory from private repo to temp dir.
-	log.Printf("copying testdata directory")
-	copyDir(privateRepo, path.Join(problem, testdataDir), tmpRepo)
+	s.log.Printf("copying testdata directory")
+	if err := c.copyDir(privateRepo, path.Join(problem, testdataDir), tmpRepo); err != nil {
+		return fmt.Errorf("testdata copying failed: %w", err)
+	}
 
 	// Copy go.mod and go.sum from private repo to temp dir.
-	log.Printf("copying go.mod, go.sum and .golangci.yml")
-	copyFiles(privateRepo, []string{"go.mod", "go.sum", ".golangci.yml"}, tmpRepo)
+	s.log.Printf("copying go.mod, go.sum and .golangci.yml")
+	if err := c.copyFiles(privateRepo, []string{"go.mod", "go.sum", ".golangci.yml"}, tmpRepo); err != nil {
+		return fmt.Errorf("go.mod copying failed: %w", err)
+	}
 
-	log.Printf("running tests")
-	if err := runTests(tmpRepo, privateRepo, problem); err != nil {
+	s.log.Printf("running tests")
+	if err := s.runTests(tmpRepo); err != nil {
 		return err
 	}
 
-	log.Printf("running linter")
-	if err := runLinter(tmpRepo, problem); err != nil {
+	s.log.Printf("running linter")
+	if err := s.runLinter(tmpRepo); err != nil {
 		return err
 	}
 
 	return nil
 }
 
-// copyDir recursively copies src directory to dst.
-func copyDir(baseDir, src, dst string) {
-	_, err := os.Stat(filepath.Join(baseDir, src))
-	if os.IsNotExist(err) {
-		return
-	}
-
-	cmd := exec.Command("rsync", "-prR", src, dst)
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-	cmd.Dir = baseDir
-
-	if err := cmd.Run(); err != nil {
-		log.Fatalf("directory copying failed: %s", err)
-	}
-}
-
-// copyContents recursively copies src contents to dst.
-func copyContents(baseDir, src, dst string) {
-	copyDir(baseDir, src+"/", dst)
-}
-
-// copyFiles copies files preserving directory structure relative to baseDir.
-//
-// Existing files get replaced.
-func copyFiles(baseDir string, relPaths []string, dst string) {
-	for _, p := range relPaths {
-		cmd := exec.Command("rsync", "-prR", p, dst)
-		cmd.Dir = baseDir
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
-
-		if err := cmd.Run(); err != nil {
-			log.Fatalf("file copying failed: %s", err)
-		}
-	}
-}
-
 func randomName() string {
 	var raw [8]byte
 	_, _ = rand.Read(raw[:])
@@ -196,24 +225,52 @@ func (e *TestFailedError) Unwrap() error {
 
 var golangCILock sync.Mutex
 
-func runLinter(testDir, problem string) error {
+func (s *submission) runLinter(testDir string) error {
 	golangCILock.Lock()
 	defer golangCILock.Unlock()
 
-	cmd := exec.Command("golangci-lint", "run", "--modules-download-mode", "readonly", "--build-tags", "private", fmt.Sprintf("./%s/...", problem))
+	args := []string{"run", "--modules-download-mode", "readonly", "--build-tags", "private"}
+
+	// Human-readable output goes to stdout, json output is parsed into report.
+	var jsonOutput string
+	if s.report != nil {
+		jsonOutput = path.Join(os.TempDir(), randomName()+".json")
+		defer func() { _ = os.Remove(jsonOutput) }()
+
+		args = append(args, "--out-format", "colored-line-number,json:"+jsonOutput)
+	}
+	args = append(args, fmt.Sprintf("./%s/...", s.problem))
+
+	cmd := exec.Command("golangci-lint", args...)
 	cmd.Dir = testDir
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
+	cmd.Stdout = s.stdout
+	cmd.Stderr = s.stderr
+
+	runErr := cmd.Run()
+
+	if s.report != nil {
+		output, err := os.ReadFile(jsonOutput)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := s.report.addLintOutput(output); err != nil {
+			return err
+		}
+	}
 
-	if err := cmd.Run(); err != nil {
-		return fmt.Errorf("linter failed: %w", err)
+	if runErr != nil {
+		return s.report.fail(StepLint, fmt.Errorf("linter failed: %w", runErr))
 	}
 
 	return nil
 }
 
 // runTests runs all tests in directory with race detector.
-func runTests(testDir, privateRepo, problem string) error {
+//
+// Results of each step are recorded into report, if it is not nil.
+func (s *submission) runTests(testDir string) error {
+	problem, privateRepo, report := s.problem, s.privateRepo, s.report
+
 	binCache, err := os.MkdirTemp("/tmp", "bincache")
 	if err != nil {
 		log.Fatal(err)
@@ -221,24 +278,26 @@ func runTests(testDir, privateRepo, problem string) error {
 	if err = os.Chmod(binCache, 0755); err != nil {
 		log.Fatal(err)
 	}
+	defer func() { _ = os.RemoveAll(binCache) }()
 
-	var goCache string
-	goCache, err = os.MkdirTemp("/tmp", "gocache")
+	// Each task gets its own GOCACHE, so that tests of one task can't poison the cache of the others.
+	goCache, err := os.MkdirTemp("/tmp", "gocache")
 	if err != nil {
 		log.Fatal(err)
 	}
 	if err = os.Chmod(goCache, 0777); err != nil {
 		log.Fatal(err)
 	}
+	defer func() { _ = os.RemoveAll(goCache) }()
 
 	runGo := func(arg ...string) error {
-		log.Printf("> go %s", strings.Join(arg, " "))
+		s.log.Printf("> go %s", strings.Join(arg, " "))
 
 		cmd := exec.Command("go", arg...)
 		cmd.Env = append(os.Environ(), "GOFLAGS=")
 		cmd.Dir = testDir
-		cmd.Stdout = os.Stdout
-		cmd.Stderr = os.Stderr
+		cmd.Stdout = s.stdout
+		cmd.Stderr = s.stderr
 		return cmd.Run()
 	}
 
@@ -250,7 +309,12 @@ func runTests(testDir, privateRepo, problem string) error {
 
 	coverageReq := getCoverageRequirements(path.Join(privateRepo, problem))
 	if coverageReq.Enabled {
-		log.Printf("required coverage: %.2f%%", coverageReq.Percent)
+		for _, t := range coverageReq.Thresholds {
+			s.log.Printf("required coverage of %s: %.2f%%", strings.Join(t.Packages, ","), t.Percent)
+		}
+		for _, f := range coverageReq.Functions {
+			s.log.Printf("required coverage of %s: %.2f%%", path.Join(f.Package, f.Func), f.Percent)
+		}
 	}
 
 	testListDir := testDir
@@ -262,19 +326,16 @@ func runTests(testDir, privateRepo, problem string) error {
 	binPkgs, testPkgs := listTestsAndBinaries(filepath.Join(testListDir, problem), []string{"-tags", "private"})
 	for binaryPkg := range binPkgs {
 		binPath := filepath.Join(binCache, randomName())
-		binaries[binaryPkg] = binPath
-
 		if err := runGo("build", "-mod", "readonly", "-tags", "private", "-o", binPath, binaryPkg); err != nil {
-			return fmt.Errorf("error building binary in %s: %w", binaryPkg, err)
+			return report.fail(StepBuild, fmt.Errorf("error building binary in %s: %w", binaryPkg, err))
 		}
+		binaries[binaryPkg] = binPath
 	}
 
 	binariesJSON, _ := json.Marshal(binaries)
 
 	for testPkg := range testPkgs {
 		testPath := filepath.Join(binCache, randomName())
-		testBinaries[testPkg] = testPath
-
 		cmd := []string{"test", "-mod", "readonly", "-tags", "private", "-c", "-o", testPath, testPkg}
 		if coverageReq.Enabled {
 			pkgs := make([]string, len(coverageReq.Packages))
@@ -284,16 +345,22 @@ func runTests(testDir, privateRepo, problem string) error {
 			cmd = append(cmd, "-cover", "-coverpkg", strings.Join(pkgs, ","))
 		}
 		if err := runGo(cmd...); err != nil {
-			return fmt.Errorf("error building test in %s: %w", testPkg, err)
+			return report.fail(StepBuild, fmt.Errorf("error building test in %s: %w", testPkg, err))
 		}
+		testBinaries[testPkg] = testPath
 
 		racePath := filepath.Join(binCache, randomName())
+		if err := runGo("test", "-mod", "readonly", "-race", "-tags", "private", "-c", "-o", racePath, testPkg); err != nil {
+			return report.fail(StepBuild, fmt.Errorf("error building test in %s: %w", testPkg, err))
+		}
 		raceBinaries[testPkg] = racePath
+	}
 
-		cmd = []string{"test", "-mod", "readonly", "-race", "-tags", "private", "-c", "-o", racePath, testPkg}
-		if err := runGo(cmd...); err != nil {
-			return fmt.Errorf("error building test in %s: %w", testPkg, err)
-		}
+	testEnv := []string{
+		testtool.BinariesEnv + "=" + string(binariesJSON),
+		"PATH=" + os.Getenv("PATH"),
+		"HOME=" + os.Getenv("HOME"),
+		"GOCACHE=" + goCache,
 	}
 
 	coverProfiles := []string{}
@@ -306,31 +373,29 @@ func runTests(testDir, privateRepo, problem string) error {
 				"-test.timeout=1m",
 			}
 
+			// Verbose output is required to report individual tests.
+			if report != nil {
+				args = append(args, "-test.v")
+			}
+
 			if coverageReq.Enabled {
 				args = append(args, "-test.coverprofile", coverProfile)
 				coverProfiles = append(coverProfiles, coverProfile)
 			}
 
 			cmd := exec.Command(testBinary, args...)
-			if currentUserIsRoot() {
-				if err := sandbox(cmd); err != nil {
-					log.Fatal(err)
-				}
-			}
-
 			cmd.Dir = filepath.Join(testDir, relPath)
-			cmd.Env = []string{
-				testtool.BinariesEnv + "=" + string(binariesJSON),
-				"PATH=" + os.Getenv("PATH"),
-				"HOME=" + os.Getenv("HOME"),
-				"GOCACHE=" + goCache,
-			}
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
+			cmd.Env = testEnv
+
+			var output bytes.Buffer
+			cmd.Stdout = io.MultiWriter(s.stdout, &output)
+			cmd.Stderr = s.stderr
 
-			log.Printf("> %s", strings.Join(cmd.Args, " "))
-			if err := cmd.Run(); err != nil {
-				return &TestFailedError{E: err}
+			s.log.Printf("> %s", strings.Join(cmd.Args, " "))
+			err := runTestCommand(cmd, testLimits)
+			report.addTestOutput(testPkg, false, output.Bytes())
+			if err != nil {
+				return report.fail(StepTest, err)
 			}
 		}
 
@@ -340,26 +405,25 @@ func runTests(testDir, privateRepo, problem string) error {
 				"-test.timeout=1m",
 			}
 
-			cmd := exec.Command(raceBinaries[testPkg], args...)
-			if currentUserIsRoot() {
-				if err := sandbox(cmd); err != nil {
-					log.Fatal(err)
-				}
+			if report != nil {
+				args = append(args, "-test.v")
 			}
 
+			cmd := exec.Command(raceBinaries[testPkg], args...)
 			cmd.Dir = filepath.Join(testDir, relPath)
-			cmd.Env = []string{
-				testtool.BinariesEnv + "=" + string(binariesJSON),
-				"PATH=" + os.Getenv("PATH"),
-				"HOME=" + os.Getenv("HOME"),
-				"GOCACHE=" + goCache,
-			}
-			cmd.Stdout = os.Stdout
-			cmd.Stderr = os.Stderr
-
-			log.Printf("> %s", strings.Join(cmd.Args, " "))
-			if err := cmd.Run(); err != nil {
-				return &TestFailedError{E: err}
+			cmd.Env = testEnv
+
+			// Race detector writes reports to stderr.
+			var output bytes.Buffer
+			outputWriter := &syncWriter{w: &output}
+			cmd.Stdout = io.MultiWriter(s.stdout, outputWriter)
+			cmd.Stderr = io.MultiWriter(s.stderr, outputWriter)
+
+			s.log.Printf("> %s", strings.Join(cmd.Args, " "))
+			err := runTestCommand(cmd, raceLimits(testLimits))
+			report.addTestOutput(testPkg, true, output.Bytes())
+			if err != nil {
+				return report.fail(StepRace, err)
 			}
 		}
 
@@ -371,51 +435,65 @@ func runTests(testDir, privateRepo, problem string) error {
 			}
 
 			benchCmd := exec.Command(testBinary, args...)
-			if currentUserIsRoot() {
-				if err := sandbox(benchCmd); err != nil {
-					log.Fatal(err)
-				}
-			}
 
 			var buf bytes.Buffer
 
 			benchCmd.Dir = filepath.Join(testDir, relPath)
-			benchCmd.Env = []string{
-				testtool.BinariesEnv + "=" + string(binariesJSON),
-				"PATH=" + os.Getenv("PATH"),
-				"HOME=" + os.Getenv("HOME"),
-				"GOCACHE=" + goCache,
-			}
+			benchCmd.Env = testEnv
 			benchCmd.Stdout = &buf
-			benchCmd.Stderr = os.Stderr
+			benchCmd.Stderr = s.stderr
 
-			log.Printf("> %s", strings.Join(benchCmd.Args, " "))
-			if err := benchCmd.Run(); err != nil {
-				return &TestFailedError{E: err}
+			s.log.Printf("> %s", strings.Join(benchCmd.Args, " "))
+			if err := runTestCommand(benchCmd, testLimits); err != nil {
+				return report.fail(StepBenchmark, err)
 			}
 
 			if strings.Contains(buf.String(), "no tests to run") {
 				continue
 			}
 
-			if err := compareToBaseline(testPkg, privateRepo, buf.Bytes()); err != nil {
-				return err
+			if err := s.compareToBaseline(testPkg, buf.Bytes()); err != nil {
+				return report.fail(StepBenchmark, err)
 			}
 		}
 	}
 
 	if coverageReq.Enabled {
-		log.Printf("checking coverage is at least %.2f%%...", coverageReq.Percent)
+		s.log.Printf("checking coverage...")
 
-		percent, err := calCoverage(coverProfiles)
+		cov, err := loadCoverage(problem, coverProfiles)
 		if err != nil {
-			return err
+			return report.fail(StepCoverage, err)
+		}
+		cov.exclude(coverageReq.Exclude)
+
+		checks, err := cov.check(coverageReq, filepath.Join(testDir, problem))
+		if err != nil {
+			return report.fail(StepCoverage, err)
+		}
+
+		percent := cov.total()
+		s.log.Printf("coverage is %.2f%%", percent)
+		report.setCoverage(coverageReq, percent, checks)
+
+		var failed *CoverageCheck
+		for i, c := range checks {
+			s.log.Printf("coverage of %s is %.2f%%; required %.2f%%", c.Name, c.Percent, c.Required)
+			if c.Passed {
+				continue
+			}
+
+			s.log.Printf("uncovered blocks of %s:", c.Name)
+			for _, b := range c.Uncovered {
+				s.log.Printf("\t%s", b)
+			}
+			if failed == nil {
+				failed = &checks[i]
+			}
 		}
-		log.Printf("coverage is %.2f%%", percent)
 
-		if percent < coverageReq.Percent {
-			return fmt.Errorf("poor coverage %.2f%%; expected at least %.2f%%",
-				percent, coverageReq.Percent)
+		if failed != nil {
+			return report.fail(StepCoverage, errors.New(failed.failure()))
 		}
 	}
 
@@ -430,13 +508,13 @@ func noMoreThanTwoTimesWorse(old, new *benchstat.Metrics) (float64, error) {
 	return 1.0, nil
 }
 
-func compareToBaseline(testPkg, privateRepo string, run []byte) error {
+func (s *submission) compareToBaseline(testPkg string, run []byte) error {
 	var buf bytes.Buffer
 
 	goTest := exec.Command("go", "test", "-tags", "private,solution", "-bench=.", "-run=^$", testPkg)
-	goTest.Dir = privateRepo
+	goTest.Dir = s.privateRepo
 	goTest.Stdout = &buf
-	goTest.Stderr = os.Stderr
+	goTest.Stderr = s.stderr
 	if err := goTest.Run(); err != nil {
 		return fmt.Errorf("baseline benchmark failed: %w", err)
 	}
@@ -448,7 +526,8 @@ func compareToBaseline(testPkg, privateRepo string, run []byte) error {
 	c.AddConfig("new.txt", run)
 
 	tables := c.Tables()
-	benchstat.FormatText(os.Stderr, tables)
+	benchstat.FormatText(s.stderr, tables)
+	s.report.addBenchmarks(testPkg, tables)
 
 	for _, c := range tables {
 		for _, r := range c.Rows {
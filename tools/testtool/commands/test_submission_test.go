@@ -55,7 +55,7 @@ func doTestSubmission(t *testing.T, studentRepo, privateRepo, problem string) er
 	// defer annotate(">>> STDERR >>>", &os.Stderr)()
 	// defer t.Logf("=== testing finished ===")
 
-	return testSubmission(studentRepo, privateRepo, problem)
+	return testSubmission(studentRepo, privateRepo, problem, nil)
 }
 
 func Test_testSubmission_correct(t *testing.T) {
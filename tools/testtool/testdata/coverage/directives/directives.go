@@ -0,0 +1,22 @@
+package directives
+
+func Abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
+}
+
+type Stack struct {
+	items []int
+}
+
+func (s *Stack) Push(x int) {
+	s.items = append(s.items, x)
+}
+
+func (s *Stack) Pop() int {
+	x := s.items[len(s.items)-1]
+	s.items = s.items[:len(s.items)-1]
+	return x
+}
@@ -0,0 +1,14 @@
+package directives
+
+// min coverage: .,subpkg 70%
+
+// Several directives might be put into the same comment.
+
+// min coverage: subpkg 100%
+// min func coverage: . Abs,Stack.Push 100%
+// coverage exclude: gen.go
+
+// Testtool uses first matching comment.
+
+// min coverage: subpkg 50%
+// min func coverage: . Abs 50%
@@ -0,0 +1,5 @@
+package directives
+
+func generated() int {
+	return 42
+}